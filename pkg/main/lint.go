@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/claudiolor/textfsmgo/pkg/textfsmgo"
+)
+
+// runLint([]string) implements the lint subcommand: it analyses the given templates and
+// writes the problems found. The exit code is 1 when a template is invalid.
+func runLint(args []string) {
+	lint_flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := lint_flags.String("f", textfsmgo.LINT_FORMAT_TEXT, "Output format: text, json or sarif")
+	python_regex := lint_flags.Bool("p", false, "Use the backtracking regex engine supporting the Python syntax")
+	lint_flags.Usage = func() {
+		fmt.Printf("Usage: %s lint [..args] TEMPLATE_FILE [TEMPLATE_FILE..]\n", os.Args[0])
+		fmt.Println("Args:")
+		lint_flags.PrintDefaults()
+	}
+	lint_flags.Parse(args)
+
+	if lint_flags.NArg() == 0 {
+		lint_flags.Usage()
+		os.Exit(1)
+	}
+
+	opts := []textfsmgo.ParserOption{}
+	if *python_regex {
+		opts = append(opts, textfsmgo.WithRegexEngine(textfsmgo.PythonRegexEngine{}))
+	}
+
+	diags := textfsmgo.TemplateErrors{}
+	for _, tmpl_file := range lint_flags.Args() {
+		t_file, err := os.Open(tmpl_file)
+		if err != nil {
+			showError(err, 1)
+		}
+
+		tmpl_diags, err := textfsmgo.LintTemplate(t_file, tmpl_file, opts...)
+		t_file.Close()
+		if err != nil {
+			showError(err, 1)
+		}
+		diags = append(diags, tmpl_diags...)
+	}
+
+	if err := textfsmgo.WriteLint(os.Stdout, diags, textfsmgo.LintFormat(*format)); err != nil {
+		showError(err, 1)
+	}
+
+	for _, diag := range diags {
+		if diag.Severity == textfsmgo.SEVERITY_ERROR {
+			os.Exit(1)
+		}
+	}
+}
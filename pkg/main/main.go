@@ -1,15 +1,57 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/claudiolor/textfsmgo/pkg/textfsmgo"
 	"github.com/claudiolor/textfsmgo/pkg/utils"
 )
 
+// Values accepted by the key mode flag
+var KEY_MODES = map[string]textfsmgo.KeyMode{
+	"identify": textfsmgo.KEY_IDENTIFY,
+	"merge":    textfsmgo.KEY_MERGE,
+	"last":     textfsmgo.KEY_KEEP_LAST,
+}
+
+// parseRedaction(string) converts the value of the redaction flag to a policy: mask:TEXT,
+// hash:KEY_FILE or last:N. The key of the hash is read from a file, so that it does not show
+// up in the command line.
+func parseRedaction(policy string) (textfsmgo.RedactionPolicy, error) {
+	mode, arg, _ := strings.Cut(policy, ":")
+	switch mode {
+	case "mask":
+		return textfsmgo.RedactionPolicy{Mode: textfsmgo.REDACT_MASK, Mask: arg}, nil
+	case "hash":
+		if arg == "" {
+			return textfsmgo.RedactionPolicy{}, fmt.Errorf("the hash redaction requires the file of the key, as in hash:KEY_FILE")
+		}
+		key, err := os.ReadFile(arg)
+		if err != nil {
+			return textfsmgo.RedactionPolicy{}, err
+		}
+		key = []byte(strings.TrimRight(string(key), "\r\n"))
+		if len(key) == 0 {
+			return textfsmgo.RedactionPolicy{}, fmt.Errorf("the key file %s is empty", arg)
+		}
+		return textfsmgo.RedactionPolicy{Mode: textfsmgo.REDACT_HASH, Key: key}, nil
+	case "last":
+		keep, err := strconv.Atoi(arg)
+		if err != nil || keep <= 0 {
+			return textfsmgo.RedactionPolicy{}, fmt.Errorf("invalid number of characters in %s, as in last:4", policy)
+		}
+		return textfsmgo.RedactionPolicy{Mode: textfsmgo.REDACT_LAST_N, Keep: keep}, nil
+	}
+	return textfsmgo.RedactionPolicy{}, fmt.Errorf("unknown redaction policy %s, expected mask:TEXT, hash:KEY_FILE or last:N",
+		policy)
+}
+
 func showError(err error, ecode int) {
 	fmt.Println(err.Error())
 	os.Exit(ecode)
@@ -19,6 +61,8 @@ func setupFlagUsage() {
 	flag.Usage = func() {
 		usage_str := fmt.Sprintf("Usage: %s FILE_NAME TEMPLATE_FILE [..args]", os.Args[0])
 		fmt.Println(usage_str)
+		fmt.Printf("       %s lint [..args] TEMPLATE_FILE [TEMPLATE_FILE..]\n", os.Args[0])
+		fmt.Printf("       %s table [..args] FILE_NAME\n", os.Args[0])
 		fmt.Println("Args:")
 		flag.PrintDefaults()
 	}
@@ -30,8 +74,23 @@ func showUsage() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		runLint(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "table" {
+		runTable(os.Args[2:])
+		return
+	}
+
 	out_file := flag.String("o", "", "Write the result in an output file instead of stdout")
 	intend := flag.Bool("i", false, "Show the json output with indentation")
+	python_regex := flag.Bool("p", false, "Use the backtracking regex engine supporting the Python syntax")
+	key_mode := flag.String("k", "", "Handle the records sharing the same Key values: identify, merge or last")
+	legacy := flag.Bool("l", false, "Use the legacy TextFSMGo runtime semantics instead of the Python ones")
+	redact := flag.String("r", "", "Redact the Secret values in the output and in the errors with a custom mask:TEXT, "+
+		"the keyed hash:KEY_FILE or last:N keeping the last N characters, instead of "+textfsmgo.DEFAULT_REDACT_MASK)
+	trace := flag.Bool("t", false, "Trace the rules matched by each line, with the depth of the state stack, on stderr")
 	setupFlagUsage()
 	flag.Parse()
 
@@ -40,24 +99,64 @@ func main() {
 	}
 	in_file := flag.Arg(0)
 	tmpl_file := flag.Arg(1)
-	parser, err := textfsmgo.NewTextFSMParser(tmpl_file)
-	if err != nil {
-		showError(err, 1)
+	opts := []textfsmgo.ParserOption{}
+	if *python_regex {
+		opts = append(opts, textfsmgo.WithRegexEngine(textfsmgo.PythonRegexEngine{}))
 	}
-
-	input_str, err := os.ReadFile(in_file)
+	if *key_mode != "" {
+		mode, known := KEY_MODES[*key_mode]
+		if !known {
+			showUsage()
+		}
+		opts = append(opts, textfsmgo.WithKeyMode(mode))
+	}
+	if *legacy {
+		opts = append(opts, textfsmgo.WithSemantics(textfsmgo.SEMANTICS_LEGACY))
+	}
+	// The values are redacted by the parser, with the default mask if no policy is given, so
+	// every output gets them redacted, the errors about the lines holding them included
+	if *redact != "" {
+		policy, err := parseRedaction(*redact)
+		if err != nil {
+			showError(err, 1)
+		}
+		opts = append(opts, textfsmgo.WithRedaction(policy))
+	}
+	if *trace {
+		opts = append(opts, textfsmgo.WithTrace(os.Stderr))
+	}
+	parser, err := textfsmgo.NewTextFSMParser(tmpl_file, opts...)
 	if err != nil {
 		showError(err, 1)
 	}
 
-	res, err := parser.ParseTextToDicts(string(input_str))
+	input_str, err := os.ReadFile(in_file)
 	if err != nil {
 		showError(err, 1)
 	}
 
-	jsonRes, err := utils.ConvertResToJson(&res, *intend)
-	if err != nil {
-		showError(err, 1)
+	// The templates declaring named tables produce an object with the records of each table.
+	// The records failing the Validate rules are written anyway, and the failures reported after.
+	var jsonRes []byte
+	var failures textfsmgo.ValidationErrors
+	if len(parser.Template().Tables()) > 0 {
+		tables, err := parser.ParseTextToTables(string(input_str))
+		if err != nil && !errors.As(err, &failures) {
+			showError(err, 1)
+		}
+		jsonRes, err = utils.ConvertTablesToJson(tables, *intend)
+		if err != nil {
+			showError(err, 1)
+		}
+	} else {
+		res, err := parser.ParseTextToDicts(string(input_str))
+		if err != nil && !errors.As(err, &failures) {
+			showError(err, 1)
+		}
+		jsonRes, err = utils.ConvertResToJson(&res, *intend)
+		if err != nil {
+			showError(err, 1)
+		}
 	}
 
 	// Check whether we should print to stdout or produce a file
@@ -70,4 +169,8 @@ func main() {
 		}
 		fmt.Printf("Json file %s written!\n", *out_file)
 	}
+	if len(failures) > 0 {
+		fmt.Fprintln(os.Stderr, failures.Error())
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/claudiolor/textfsmgo/pkg/textfsmgo"
+	"github.com/claudiolor/textfsmgo/pkg/utils"
+)
+
+// runTable([]string) implements the table subcommand: it parses a simple aligned table with
+// no template, inferring its columns from the header line. The inferred template can be
+// written out, to be tuned and used as any other template.
+func runTable(args []string) {
+	table_flags := flag.NewFlagSet("table", flag.ExitOnError)
+	out_file := table_flags.String("o", "", "Write the result in an output file instead of stdout")
+	intend := table_flags.Bool("i", false, "Show the json output with indentation")
+	tmpl_file := table_flags.String("w", "", "Write the template inferred from the header in a template file")
+	table_flags.Usage = func() {
+		fmt.Printf("Usage: %s table [..args] FILE_NAME\n", os.Args[0])
+		fmt.Println("Args:")
+		table_flags.PrintDefaults()
+	}
+	table_flags.Parse(args)
+
+	if table_flags.NArg() != 1 {
+		table_flags.Usage()
+		os.Exit(1)
+	}
+
+	input_str, err := os.ReadFile(table_flags.Arg(0))
+	if err != nil {
+		showError(err, 1)
+	}
+	layout, err := textfsmgo.InferTable(string(input_str))
+	if err != nil {
+		showError(err, 1)
+	}
+	if *tmpl_file != "" {
+		err := os.WriteFile(*tmpl_file, []byte(layout.Template()), fs.FileMode(0664))
+		if err != nil {
+			showError(err, 1)
+		}
+	}
+
+	parser, err := layout.Parser()
+	if err != nil {
+		showError(err, 1)
+	}
+	res, err := parser.ParseTextToDicts(string(input_str))
+	if err != nil {
+		showError(err, 1)
+	}
+	jsonRes, err := utils.ConvertResToJson(&res, *intend)
+	if err != nil {
+		showError(err, 1)
+	}
+
+	if *out_file == "" {
+		fmt.Println(string(jsonRes))
+	} else {
+		err := os.WriteFile(*out_file, jsonRes, fs.FileMode(0664))
+		if err != nil {
+			showError(err, 1)
+		}
+		fmt.Printf("Json file %s written!\n", *out_file)
+	}
+}
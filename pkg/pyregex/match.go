@@ -0,0 +1,531 @@
+package pyregex
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// machine holds the state of a single search
+type machine struct {
+	input    string // the text being searched
+	caps     []int  // start and end offsets of each group, -1 when not set
+	steps    int    // steps taken so far
+	limit    int    // maximum number of steps
+	exceeded bool   // tells if the step budget has been exhausted
+}
+
+// step() accounts for a matching step and tells if the search can go on
+func (m *machine) step() bool {
+	m.steps++
+	if m.steps > m.limit {
+		m.exceeded = true
+		return false
+	}
+	return true
+}
+
+// backRunes(int, int) returns the offset of the char n runes before pos, -1 if the
+// beginning of the text is reached before
+func (m *machine) backRunes(pos int, n int) int {
+	for i := 0; i < n; i++ {
+		if pos == 0 {
+			return -1
+		}
+		_, size := utf8.DecodeLastRuneInString(m.input[:pos])
+		pos -= size
+	}
+	return pos
+}
+
+// saveCaps() returns a copy of the current groups offsets
+func (m *machine) saveCaps() []int {
+	return append([]int(nil), m.caps...)
+}
+
+// node is an element of the compiled regex. match() tries to match the node at the
+// given position, calling the continuation k with the position after the match. It
+// returns true when the continuation succeeds, otherwise it backtracks trying the other
+// alternatives of the node.
+type node interface {
+	match(m *machine, pos int, k func(int) bool) bool
+}
+
+// charMatcher is implemented by the nodes matching exactly a single char
+type charMatcher interface {
+	matchRune(r rune) bool
+}
+
+// charNode matches a single char
+type charNode struct {
+	cm charMatcher
+}
+
+func (n charNode) match(m *machine, pos int, k func(int) bool) bool {
+	if !m.step() || pos >= len(m.input) {
+		return false
+	}
+	r, size := utf8.DecodeRuneInString(m.input[pos:])
+	if !n.cm.matchRune(r) {
+		return false
+	}
+	return k(pos + size)
+}
+
+// literalChar matches a specific char
+type literalChar struct {
+	r    rune
+	fold bool // case insensitive comparison
+}
+
+func (c literalChar) matchRune(r rune) bool {
+	return r == c.r || (c.fold && foldEqual(r, c.r))
+}
+
+// anyChar matches any char, newline included only when dotall is set
+type anyChar struct {
+	dotall bool
+}
+
+func (c anyChar) matchRune(r rune) bool {
+	return c.dotall || r != '\n'
+}
+
+// charClass matches a set of chars
+type charClass struct {
+	ranges  []rune            // pairs of lower and upper bounds of the ranges
+	preds   []func(rune) bool // predicates such as \d or \w
+	negated bool              // tells if the class is negated
+	fold    bool              // case insensitive comparison
+}
+
+func (c *charClass) contains(r rune) bool {
+	for i := 0; i < len(c.ranges); i += 2 {
+		if r >= c.ranges[i] && r <= c.ranges[i+1] {
+			return true
+		}
+	}
+	for _, pred := range c.preds {
+		if pred(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *charClass) matchRune(r rune) bool {
+	res := c.contains(r)
+	if !res && c.fold {
+		for f := unicode.SimpleFold(r); f != r && !res; f = unicode.SimpleFold(f) {
+			res = c.contains(f)
+		}
+	}
+	return res != c.negated
+}
+
+// foldEqual(rune, rune) tells if the two chars are equal under simple case folding
+func foldEqual(a rune, b rune) bool {
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Kind of zero-width assertions
+const (
+	assert_bol = iota
+	assert_eol
+	assert_start
+	assert_end
+	assert_word_boundary
+	assert_not_word_boundary
+)
+
+// assertNode matches a zero-width assertion
+type assertNode struct {
+	kind      int
+	multiline bool // ^ and $ match at every line
+	ascii     bool // \b and \B consider only ASCII word chars
+}
+
+func (n assertNode) isWordAt(m *machine, pos int, before bool) bool {
+	var r rune
+	if before {
+		if pos == 0 {
+			return false
+		}
+		r, _ = utf8.DecodeLastRuneInString(m.input[:pos])
+	} else {
+		if pos >= len(m.input) {
+			return false
+		}
+		r, _ = utf8.DecodeRuneInString(m.input[pos:])
+	}
+	return isWord(r, n.ascii)
+}
+
+func (n assertNode) match(m *machine, pos int, k func(int) bool) bool {
+	if !m.step() {
+		return false
+	}
+
+	var ok bool
+	switch n.kind {
+	case assert_bol:
+		ok = pos == 0 || (n.multiline && m.input[pos-1] == '\n')
+	case assert_eol:
+		// As in Python, $ also matches before the newline terminating the text
+		ok = pos == len(m.input) ||
+			(m.input[pos] == '\n' && (n.multiline || pos == len(m.input)-1))
+	case assert_start:
+		ok = pos == 0
+	case assert_end:
+		ok = pos == len(m.input)
+	case assert_word_boundary, assert_not_word_boundary:
+		boundary := n.isWordAt(m, pos, true) != n.isWordAt(m, pos, false)
+		ok = boundary == (n.kind == assert_word_boundary)
+	}
+
+	return ok && k(pos)
+}
+
+// concatNode matches a sequence of nodes
+type concatNode []node
+
+func (n concatNode) matchFrom(m *machine, i int, pos int, k func(int) bool) bool {
+	if i == len(n) {
+		return k(pos)
+	}
+	return n[i].match(m, pos, func(p int) bool {
+		return n.matchFrom(m, i+1, p, k)
+	})
+}
+
+func (n concatNode) match(m *machine, pos int, k func(int) bool) bool {
+	return n.matchFrom(m, 0, pos, k)
+}
+
+// altNode matches one of the alternatives, trying them in order
+type altNode []node
+
+func (n altNode) match(m *machine, pos int, k func(int) bool) bool {
+	for _, alt := range n {
+		if alt.match(m, pos, k) {
+			return true
+		}
+		if m.exceeded {
+			return false
+		}
+	}
+	return false
+}
+
+// groupNode is a capturing group
+type groupNode struct {
+	sub   node
+	index int
+}
+
+func (n groupNode) match(m *machine, pos int, k func(int) bool) bool {
+	return n.sub.match(m, pos, func(p int) bool {
+		old_start, old_end := m.caps[2*n.index], m.caps[2*n.index+1]
+		m.caps[2*n.index], m.caps[2*n.index+1] = pos, p
+		if k(p) {
+			return true
+		}
+		m.caps[2*n.index], m.caps[2*n.index+1] = old_start, old_end
+		return false
+	})
+}
+
+// backrefNode matches the same text matched by a group
+type backrefNode struct {
+	index int
+	fold  bool
+}
+
+func (n backrefNode) match(m *machine, pos int, k func(int) bool) bool {
+	if !m.step() {
+		return false
+	}
+
+	start, end := m.caps[2*n.index], m.caps[2*n.index+1]
+	if start < 0 {
+		// As in Python, a reference to a group not matched fails
+		return false
+	}
+
+	ref := m.input[start:end]
+	if len(m.input)-pos < len(ref) {
+		return false
+	}
+
+	candidate := m.input[pos : pos+len(ref)]
+	if candidate != ref && !(n.fold && strings.EqualFold(candidate, ref)) {
+		return false
+	}
+	return k(pos + len(ref))
+}
+
+// repeatNode matches a node repeated between min and max times
+type repeatNode struct {
+	sub        node
+	min        int
+	max        int // -1 when unbounded
+	greedy     bool
+	possessive bool // do not backtrack once the repetition is matched
+}
+
+func (n *repeatNode) match(m *machine, pos int, k func(int) bool) bool {
+	if n.possessive {
+		greedy := &repeatNode{sub: n.sub, min: n.min, max: n.max, greedy: true}
+		return matchAtomic(m, greedy, pos, k)
+	}
+
+	if cn, ok := n.sub.(charNode); ok {
+		return n.matchChars(m, cn.cm, pos, k)
+	}
+	return n.matchFrom(m, pos, 0, k)
+}
+
+// matchChars(*machine, charMatcher, int, func(int) bool) is the fast path for the
+// repetition of a single char, it avoids a recursion for every repeated char
+func (n *repeatNode) matchChars(m *machine, cm charMatcher, pos int, k func(int) bool) bool {
+	if !n.greedy {
+		for count := 0; ; count++ {
+			if count >= n.min && k(pos) {
+				return true
+			}
+			if !m.step() || (n.max != -1 && count >= n.max) || pos >= len(m.input) {
+				return false
+			}
+			r, size := utf8.DecodeRuneInString(m.input[pos:])
+			if !cm.matchRune(r) {
+				return false
+			}
+			pos += size
+		}
+	}
+
+	// Consume as many chars as possible, then give them back one at a time
+	positions := []int{pos}
+	for n.max == -1 || len(positions)-1 < n.max {
+		if !m.step() {
+			return false
+		}
+		if pos >= len(m.input) {
+			break
+		}
+		r, size := utf8.DecodeRuneInString(m.input[pos:])
+		if !cm.matchRune(r) {
+			break
+		}
+		pos += size
+		positions = append(positions, pos)
+	}
+
+	for i := len(positions) - 1; i >= n.min; i-- {
+		if k(positions[i]) {
+			return true
+		}
+		if m.exceeded {
+			return false
+		}
+	}
+	return false
+}
+
+// matchFrom(*machine, int, int, func(int) bool) matches the remaining repetitions,
+// count is the number of repetitions already matched
+func (n *repeatNode) matchFrom(m *machine, pos int, count int, k func(int) bool) bool {
+	if !m.step() {
+		return false
+	}
+
+	can_repeat := n.max == -1 || count < n.max
+	repeat := func() bool {
+		return n.sub.match(m, pos, func(p int) bool {
+			// Another empty repetition would not change the result
+			if p == pos && count >= n.min {
+				return false
+			}
+			return n.matchFrom(m, p, count+1, k)
+		})
+	}
+
+	if n.greedy {
+		if can_repeat && repeat() {
+			return true
+		}
+		return count >= n.min && !m.exceeded && k(pos)
+	}
+
+	if count >= n.min && k(pos) {
+		return true
+	}
+	return can_repeat && !m.exceeded && repeat()
+}
+
+// atomicNode matches its content once, without backtracking into it
+type atomicNode struct {
+	sub node
+}
+
+func (n atomicNode) match(m *machine, pos int, k func(int) bool) bool {
+	return matchAtomic(m, n.sub, pos, k)
+}
+
+// matchAtomic(*machine, node, int, func(int) bool) matches the first way the node can
+// match and calls the continuation from there, without trying the other alternatives
+func matchAtomic(m *machine, sub node, pos int, k func(int) bool) bool {
+	saved := m.saveCaps()
+	end := -1
+	if !sub.match(m, pos, func(p int) bool {
+		end = p
+		return true
+	}) || m.exceeded {
+		return false
+	}
+
+	if k(end) {
+		return true
+	}
+	copy(m.caps, saved)
+	return false
+}
+
+// lookNode is a lookahead or lookbehind assertion
+type lookNode struct {
+	sub    node
+	behind bool // lookbehind instead of lookahead
+	negate bool // negative assertion
+	width  int  // width in chars of the lookbehind content
+}
+
+func (n lookNode) match(m *machine, pos int, k func(int) bool) bool {
+	if !m.step() {
+		return false
+	}
+
+	start := pos
+	if n.behind {
+		// The content of a lookbehind must end exactly at the current position
+		start = m.backRunes(pos, n.width)
+	}
+
+	saved := m.saveCaps()
+	matched := false
+	if start >= 0 {
+		matched = n.sub.match(m, start, func(p int) bool {
+			return !n.behind || p == pos
+		})
+	}
+	if m.exceeded {
+		return false
+	}
+
+	if n.negate {
+		// The groups of a negative assertion never match
+		copy(m.caps, saved)
+		return !matched && k(pos)
+	}
+
+	if matched && k(pos) {
+		return true
+	}
+	copy(m.caps, saved)
+	return false
+}
+
+// isAnchored(node) tells if the regex can match only at the beginning of the text
+func isAnchored(n node) bool {
+	for {
+		switch v := n.(type) {
+		case concatNode:
+			if len(v) == 0 {
+				return false
+			}
+			n = v[0]
+		case groupNode:
+			n = v.sub
+		case atomicNode:
+			n = v.sub
+		case assertNode:
+			return v.kind == assert_start || (v.kind == assert_bol && !v.multiline)
+		default:
+			return false
+		}
+	}
+}
+
+// fixedWidth(node) returns the number of chars matched by the node, the boolean is false
+// when the node can match texts of different lengths
+func fixedWidth(n node) (int, bool) {
+	switch v := n.(type) {
+	case charNode:
+		return 1, true
+	case assertNode, lookNode:
+		return 0, true
+	case groupNode:
+		return fixedWidth(v.sub)
+	case atomicNode:
+		return fixedWidth(v.sub)
+	case concatNode:
+		total := 0
+		for _, sub := range v {
+			w, ok := fixedWidth(sub)
+			if !ok {
+				return 0, false
+			}
+			total += w
+		}
+		return total, true
+	case altNode:
+		width := -1
+		for _, sub := range v {
+			w, ok := fixedWidth(sub)
+			if !ok || (width != -1 && w != width) {
+				return 0, false
+			}
+			width = w
+		}
+		return width, true
+	case *repeatNode:
+		if v.min != v.max {
+			return 0, false
+		}
+		w, ok := fixedWidth(v.sub)
+		return w * v.min, ok
+	}
+	return 0, false
+}
+
+// isWord(rune, bool) tells if the char is part of a word, as in \w
+func isWord(r rune, ascii bool) bool {
+	if ascii || r < utf8.RuneSelf {
+		return r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+	}
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// isDigit(rune, bool) tells if the char is a decimal digit, as in \d
+func isDigit(r rune, ascii bool) bool {
+	if ascii || r < utf8.RuneSelf {
+		return '0' <= r && r <= '9'
+	}
+	return unicode.IsDigit(r)
+}
+
+// isSpace(rune, bool) tells if the char is a white space, as in \s
+func isSpace(r rune, ascii bool) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\f', '\v':
+		return true
+	}
+	if ascii || r < utf8.RuneSelf {
+		return r >= 0x1c && r <= 0x1f
+	}
+	return unicode.IsSpace(r)
+}
@@ -0,0 +1,715 @@
+package pyregex
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Flags that can be set inline in the expression, e.g. (?i)
+const (
+	flag_ignorecase = 1 << iota
+	flag_multiline
+	flag_dotall
+	flag_verbose
+	flag_ascii
+)
+
+var flag_letters = map[byte]int{
+	'i': flag_ignorecase,
+	'm': flag_multiline,
+	's': flag_dotall,
+	'x': flag_verbose,
+	'a': flag_ascii,
+	'u': 0, // unicode matching is the default
+	'L': 0, // locale dependent matching is not supported, ignore it
+}
+
+// errRestart is returned when a global flag is found after the beginning of the
+// expression, as it affects the whole expression the parsing has to start again
+var errRestart = errors.New("restart parsing")
+
+// parser builds the tree of nodes of a regular expression
+type parser struct {
+	expr         string         // the expression to parse
+	pos          int            // current offset in the expression
+	flags        int            // the flags active at the current position
+	global_flags int            // the flags applied to the whole expression
+	names        []string       // the names of the groups
+	name_index   map[string]int // the index of the named groups
+	open_groups  map[int]bool   // the groups not closed yet
+}
+
+// parse(string) parses the expression and returns the root of the tree along with the
+// names of its groups
+func parse(expr string) (node, []string, error) {
+	global_flags := 0
+	for {
+		p := &parser{
+			expr:         expr,
+			flags:        global_flags,
+			global_flags: global_flags,
+			names:        []string{""},
+			name_index:   map[string]int{},
+			open_groups:  map[int]bool{},
+		}
+
+		root, err := p.parseAlt()
+		if err == errRestart {
+			global_flags = p.global_flags
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if p.pos < len(expr) {
+			return nil, nil, p.error("unbalanced parenthesis", p.pos)
+		}
+		return root, p.names, nil
+	}
+}
+
+// error(string, int) returns the compilation error located at the given offset
+func (p *parser) error(msg string, pos int) error {
+	return &Error{Msg: msg, Expr: p.expr, Pos: pos}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.expr)
+}
+
+func (p *parser) peek() byte {
+	return p.expr[p.pos]
+}
+
+func (p *parser) has(prefix string) bool {
+	return strings.HasPrefix(p.expr[p.pos:], prefix)
+}
+
+// nextRune() consumes and returns the next char of the expression
+func (p *parser) nextRune() rune {
+	r, size := utf8.DecodeRuneInString(p.expr[p.pos:])
+	p.pos += size
+	return r
+}
+
+// skipVerbose() skips white spaces and comments when the verbose flag is set
+func (p *parser) skipVerbose() {
+	if p.flags&flag_verbose == 0 {
+		return
+	}
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// parseAlt() parses a list of alternatives separated by |
+func (p *parser) parseAlt() (node, error) {
+	alts := altNode{}
+	for {
+		concat, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, concat)
+
+		if p.eof() || p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return alts, nil
+}
+
+// parseConcat() parses a sequence of quantified atoms
+func (p *parser) parseConcat() (node, error) {
+	nodes := concatNode{}
+	for {
+		p.skipVerbose()
+		if p.eof() || p.peek() == '|' || p.peek() == ')' {
+			break
+		}
+
+		atom, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		if atom == nil {
+			// Comments and flags do not produce any node
+			continue
+		}
+
+		if atom, err = p.parseQuantifier(atom); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, atom)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+// parseAtom() parses a single element of the expression
+func (p *parser) parseAtom() (node, error) {
+	start := p.pos
+	switch p.peek() {
+	case '(':
+		return p.parseGroup()
+	case '[':
+		return p.parseClass()
+	case '.':
+		p.pos++
+		return charNode{anyChar{dotall: p.flags&flag_dotall != 0}}, nil
+	case '^':
+		p.pos++
+		return assertNode{kind: assert_bol, multiline: p.flags&flag_multiline != 0}, nil
+	case '$':
+		p.pos++
+		return assertNode{kind: assert_eol, multiline: p.flags&flag_multiline != 0}, nil
+	case '\\':
+		return p.parseEscape()
+	case '*', '+', '?':
+		return nil, p.error("nothing to repeat", start)
+	case '{':
+		if _, _, ok := p.scanBraces(); ok {
+			return nil, p.error("nothing to repeat", start)
+		}
+	}
+	return p.literal(p.nextRune()), nil
+}
+
+// literal(rune) returns the node matching the given char
+func (p *parser) literal(r rune) node {
+	return charNode{literalChar{r: r, fold: p.flags&flag_ignorecase != 0}}
+}
+
+// scanBraces() parses a {m,n} quantifier at the current position without consuming it.
+// It returns the bounds, 0 and -1 when missing, and false if the text is not a valid
+// quantifier, in which case Python takes it literally.
+func (p *parser) scanBraces() (int, int, bool) {
+	end := strings.IndexByte(p.expr[p.pos:], '}')
+	if end <= 1 {
+		return 0, 0, false
+	}
+
+	content := p.expr[p.pos+1 : p.pos+end]
+	min_str, max_str, has_comma := strings.Cut(content, ",")
+	if !has_comma {
+		max_str = min_str
+	}
+
+	bounds := []int{0, -1}
+	for i, s := range []string{min_str, max_str} {
+		if s == "" {
+			continue
+		}
+		val, err := strconv.Atoi(s)
+		if err != nil || s[0] == '+' || s[0] == '-' {
+			return 0, 0, false
+		}
+		bounds[i] = val
+	}
+	return bounds[0], bounds[1], true
+}
+
+// isQuantifier() tells if a quantifier starts at the current position
+func (p *parser) isQuantifier() bool {
+	if p.eof() {
+		return false
+	}
+	switch p.peek() {
+	case '*', '+', '?':
+		return true
+	case '{':
+		_, _, ok := p.scanBraces()
+		return ok
+	}
+	return false
+}
+
+// parseQuantifier(node) parses the quantifier following an atom, if any
+func (p *parser) parseQuantifier(atom node) (node, error) {
+	p.skipVerbose()
+	if !p.isQuantifier() {
+		return atom, nil
+	}
+
+	start := p.pos
+	if _, is_assert := atom.(assertNode); is_assert {
+		return nil, p.error("nothing to repeat", start)
+	}
+
+	rep := &repeatNode{sub: atom, max: -1, greedy: true}
+	switch p.peek() {
+	case '*':
+		p.pos++
+	case '+':
+		rep.min = 1
+		p.pos++
+	case '?':
+		rep.max = 1
+		p.pos++
+	case '{':
+		min, max, _ := p.scanBraces()
+		p.pos += strings.IndexByte(p.expr[p.pos:], '}') + 1
+		if max != -1 && min > max {
+			return nil, p.error("min repeat greater than max repeat", start)
+		}
+		rep.min, rep.max = min, max
+	}
+
+	if !p.eof() {
+		switch p.peek() {
+		case '?':
+			rep.greedy = false
+			p.pos++
+		case '+':
+			rep.possessive = true
+			p.pos++
+		}
+	}
+
+	p.skipVerbose()
+	if p.isQuantifier() {
+		return nil, p.error("multiple repeat", p.pos)
+	}
+	return rep, nil
+}
+
+// parseFlags() parses the flags of a (?flags) or (?flags:...) group, returning the
+// flags to add and to remove
+func (p *parser) parseFlags() (int, int, error) {
+	add, remove := 0, 0
+	removing := false
+	for !p.eof() {
+		c := p.peek()
+		if c == ')' || c == ':' {
+			return add, remove, nil
+		}
+
+		p.pos++
+		if c == '-' && !removing {
+			removing = true
+			continue
+		}
+
+		flag, known := flag_letters[c]
+		if !known {
+			return 0, 0, p.error("unknown flag", p.pos-1)
+		}
+		if removing {
+			remove |= flag
+		} else {
+			add |= flag
+		}
+	}
+	return 0, 0, p.error("missing -, : or )", p.pos)
+}
+
+// parseGroupName(byte) parses the name of a group terminated by the given char
+func (p *parser) parseGroupName(terminator byte) (string, error) {
+	start := p.pos
+	end := strings.IndexByte(p.expr[p.pos:], terminator)
+	if end == -1 {
+		return "", p.error("missing group name terminator", start)
+	}
+
+	name := p.expr[start : start+end]
+	if name == "" {
+		return "", p.error("missing group name", start)
+	}
+	for i, c := range name {
+		if !(c == '_' || isWord(c, false) && !(i == 0 && isDigit(c, false))) {
+			return "", p.error("bad character in group name '"+name+"'", start)
+		}
+	}
+	p.pos += end + 1
+	return name, nil
+}
+
+// parseGroup() parses all the kinds of groups and extensions starting with (
+func (p *parser) parseGroup() (node, error) {
+	start := p.pos
+	p.pos++
+
+	saved_flags := p.flags
+	defer func() { p.flags = saved_flags }()
+
+	index := -1
+	var wrap func(node) node
+	switch {
+	case !p.has("?"):
+		index = p.newGroup("")
+	case p.has("?:"):
+		p.pos += 2
+	case p.has("?P<"):
+		p.pos += 3
+		name, err := p.parseGroupName('>')
+		if err != nil {
+			return nil, err
+		}
+		if _, present := p.name_index[name]; present {
+			return nil, p.error("redefinition of group name '"+name+"'", start)
+		}
+		index = p.newGroup(name)
+	case p.has("?P="):
+		p.pos += 3
+		name, err := p.parseGroupName(')')
+		if err != nil {
+			return nil, err
+		}
+		ref, present := p.name_index[name]
+		if !present {
+			return nil, p.error("unknown group name '"+name+"'", start)
+		}
+		if p.open_groups[ref] {
+			return nil, p.error("cannot refer to an open group", start)
+		}
+		return backrefNode{index: ref, fold: p.flags&flag_ignorecase != 0}, nil
+	case p.has("?#"):
+		end := strings.IndexByte(p.expr[p.pos:], ')')
+		if end == -1 {
+			return nil, p.error("missing ), unterminated comment", start)
+		}
+		p.pos += end + 1
+		return nil, nil
+	case p.has("?="), p.has("?!"), p.has("?<="), p.has("?<!"):
+		look := lookNode{behind: p.has("?<"), negate: p.has("?!") || p.has("?<!")}
+		if look.behind {
+			p.pos += 3
+		} else {
+			p.pos += 2
+		}
+		wrap = func(sub node) node {
+			look.sub = sub
+			return look
+		}
+	case p.has("?>"):
+		p.pos += 2
+		wrap = func(sub node) node { return atomicNode{sub: sub} }
+	case p.has("?("):
+		return nil, p.error("conditional groups are not supported", start)
+	default:
+		p.pos++
+		add, remove, err := p.parseFlags()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() == ')' {
+			// Global flags apply to the whole expression
+			p.pos++
+			if remove != 0 {
+				return nil, p.error("missing :", p.pos-1)
+			}
+			if p.global_flags|add != p.global_flags {
+				p.global_flags |= add
+				return nil, errRestart
+			}
+			saved_flags |= add
+			return nil, nil
+		}
+
+		p.pos++
+		p.flags = (p.flags | add) &^ remove
+	}
+
+	sub, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	if p.eof() || p.peek() != ')' {
+		return nil, p.error("missing ), unterminated subpattern", start)
+	}
+	p.pos++
+
+	if wrap != nil {
+		res := wrap(sub)
+		if look, ok := res.(lookNode); ok && look.behind {
+			width, fixed := fixedWidth(sub)
+			if !fixed {
+				return nil, p.error("look-behind requires fixed-width pattern", start)
+			}
+			look.width = width
+			res = look
+		}
+		return res, nil
+	}
+
+	if index != -1 {
+		delete(p.open_groups, index)
+		return groupNode{sub: sub, index: index}, nil
+	}
+	return sub, nil
+}
+
+// newGroup(string) registers a new capturing group and returns its index
+func (p *parser) newGroup(name string) int {
+	index := len(p.names)
+	p.names = append(p.names, name)
+	if name != "" {
+		p.name_index[name] = index
+	}
+	p.open_groups[index] = true
+	return index
+}
+
+// parseHex(int, int) parses the given number of hex digits of a \x, \u or \U escape
+func (p *parser) parseHex(n int, start int) (rune, error) {
+	if p.pos+n > len(p.expr) {
+		return 0, p.error("incomplete escape "+p.expr[start:], start)
+	}
+	val, err := strconv.ParseUint(p.expr[p.pos:p.pos+n], 16, 32)
+	if err != nil {
+		return 0, p.error("incomplete escape "+p.expr[start:p.pos+n], start)
+	}
+	p.pos += n
+	return rune(val), nil
+}
+
+// parseCharEscape(byte, int) parses the escapes producing a single char, they are valid
+// both inside and outside char classes. The boolean is false if the escape is not one of
+// those.
+func (p *parser) parseCharEscape(c byte, start int) (rune, bool, error) {
+	switch c {
+	case 'n':
+		return '\n', true, nil
+	case 't':
+		return '\t', true, nil
+	case 'r':
+		return '\r', true, nil
+	case 'f':
+		return '\f', true, nil
+	case 'v':
+		return '\v', true, nil
+	case 'a':
+		return '\a', true, nil
+	case 'x':
+		r, err := p.parseHex(2, start)
+		return r, true, err
+	case 'u':
+		r, err := p.parseHex(4, start)
+		return r, true, err
+	case 'U':
+		r, err := p.parseHex(8, start)
+		return r, true, err
+	case 'N':
+		return 0, true, p.error("named unicode escapes are not supported", start)
+	}
+	return 0, false, nil
+}
+
+// parseOctal(rune) parses an octal escape whose first digit has already been consumed
+func (p *parser) parseOctal(first byte, start int) (rune, error) {
+	val := rune(first - '0')
+	for i := 0; i < 2 && !p.eof() && p.peek() >= '0' && p.peek() <= '7'; i++ {
+		val = val*8 + rune(p.peek()-'0')
+		p.pos++
+	}
+	if val > 0o377 {
+		return 0, p.error("octal escape value outside of range 0-0o377", start)
+	}
+	return val, nil
+}
+
+// classPredicate(byte) returns the predicate of the \d, \w, \s escapes and their
+// negations, nil if the char is not one of those
+func (p *parser) classPredicate(c byte) func(rune) bool {
+	ascii := p.flags&flag_ascii != 0
+	switch c {
+	case 'd':
+		return func(r rune) bool { return isDigit(r, ascii) }
+	case 'D':
+		return func(r rune) bool { return !isDigit(r, ascii) }
+	case 'w':
+		return func(r rune) bool { return isWord(r, ascii) }
+	case 'W':
+		return func(r rune) bool { return !isWord(r, ascii) }
+	case 's':
+		return func(r rune) bool { return isSpace(r, ascii) }
+	case 'S':
+		return func(r rune) bool { return !isSpace(r, ascii) }
+	}
+	return nil
+}
+
+// parseEscape() parses an escape sequence outside char classes
+func (p *parser) parseEscape() (node, error) {
+	start := p.pos
+	p.pos++
+	if p.eof() {
+		return nil, p.error("bad escape (end of pattern)", start)
+	}
+
+	c := p.peek()
+	p.pos++
+	if pred := p.classPredicate(c); pred != nil {
+		return charNode{&charClass{preds: []func(rune) bool{pred}}}, nil
+	}
+
+	ascii := p.flags&flag_ascii != 0
+	switch c {
+	case 'b':
+		return assertNode{kind: assert_word_boundary, ascii: ascii}, nil
+	case 'B':
+		return assertNode{kind: assert_not_word_boundary, ascii: ascii}, nil
+	case 'A':
+		return assertNode{kind: assert_start}, nil
+	case 'Z', 'z':
+		return assertNode{kind: assert_end}, nil
+	}
+
+	if r, ok, err := p.parseCharEscape(c, start); ok {
+		if err != nil {
+			return nil, err
+		}
+		return p.literal(r), nil
+	}
+
+	if c == '0' {
+		r, err := p.parseOctal(c, start)
+		if err != nil {
+			return nil, err
+		}
+		return p.literal(r), nil
+	}
+
+	if c >= '1' && c <= '9' {
+		// Three octal digits are an octal escape, otherwise it is a group reference
+		if p.pos+1 < len(p.expr) && c <= '7' &&
+			p.expr[p.pos] >= '0' && p.expr[p.pos] <= '7' &&
+			p.expr[p.pos+1] >= '0' && p.expr[p.pos+1] <= '7' {
+			r, err := p.parseOctal(c, start)
+			if err != nil {
+				return nil, err
+			}
+			return p.literal(r), nil
+		}
+
+		digits := string(c)
+		if !p.eof() && p.peek() >= '0' && p.peek() <= '9' {
+			digits += string(p.peek())
+			p.pos++
+		}
+		ref, _ := strconv.Atoi(digits)
+		if ref >= len(p.names) {
+			return nil, p.error("invalid group reference "+digits, start+1)
+		}
+		if p.open_groups[ref] {
+			return nil, p.error("cannot refer to an open group", start)
+		}
+		return backrefNode{index: ref, fold: p.flags&flag_ignorecase != 0}, nil
+	}
+
+	if c < utf8.RuneSelf && isWord(rune(c), true) {
+		return nil, p.error("bad escape \\"+string(c), start)
+	}
+
+	p.pos--
+	return p.literal(p.nextRune()), nil
+}
+
+// parseClassChar() parses a single char of a char class, returning either the char or
+// the predicate of a \d like escape
+func (p *parser) parseClassChar() (rune, func(rune) bool, error) {
+	start := p.pos
+	if p.peek() != '\\' {
+		return p.nextRune(), nil, nil
+	}
+
+	p.pos++
+	if p.eof() {
+		return 0, nil, p.error("bad escape (end of pattern)", start)
+	}
+
+	c := p.peek()
+	p.pos++
+	if pred := p.classPredicate(c); pred != nil {
+		return 0, pred, nil
+	}
+
+	if r, ok, err := p.parseCharEscape(c, start); ok {
+		return r, nil, err
+	}
+
+	switch {
+	case c == 'b':
+		return '\b', nil, nil
+	case c >= '0' && c <= '7':
+		r, err := p.parseOctal(c, start)
+		return r, nil, err
+	case c < utf8.RuneSelf && isWord(rune(c), true):
+		return 0, nil, p.error("bad escape \\"+string(c), start)
+	}
+
+	p.pos--
+	return p.nextRune(), nil, nil
+}
+
+// parseClass() parses a char class, e.g. [^a-z\d]
+func (p *parser) parseClass() (node, error) {
+	start := p.pos
+	p.pos++
+
+	class := &charClass{fold: p.flags&flag_ignorecase != 0}
+	if !p.eof() && p.peek() == '^' {
+		class.negated = true
+		p.pos++
+	}
+
+	first := true
+	for {
+		if p.eof() {
+			return nil, p.error("unterminated character set", start)
+		}
+		if p.peek() == ']' && !first {
+			p.pos++
+			break
+		}
+		first = false
+
+		item_start := p.pos
+		lo, pred, err := p.parseClassChar()
+		if err != nil {
+			return nil, err
+		}
+
+		// Check for a range, a - at the end of the class is a literal
+		if p.has("-") && p.pos+1 < len(p.expr) && p.expr[p.pos+1] != ']' {
+			p.pos++
+			hi, hi_pred, err := p.parseClassChar()
+			if err != nil {
+				return nil, err
+			}
+			if pred != nil || hi_pred != nil || lo > hi {
+				return nil, p.error("bad character range "+p.expr[item_start:p.pos], item_start)
+			}
+			class.ranges = append(class.ranges, lo, hi)
+			continue
+		}
+
+		if pred != nil {
+			class.preds = append(class.preds, pred)
+		} else {
+			class.ranges = append(class.ranges, lo, lo)
+		}
+	}
+	return charNode{class}, nil
+}
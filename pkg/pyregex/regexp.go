@@ -0,0 +1,143 @@
+// Package pyregex implements a backtracking regular expression engine following the
+// syntax of the Python re module. It supports the constructs that RE2 does not, such as
+// lookarounds, backreferences, atomic groups and \Z, at the cost of a potentially
+// exponential matching time, which is bounded by a step budget.
+package pyregex
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Default maximum number of steps a single search can take before giving up
+const DEFAULT_MAX_STEPS = 1000000
+
+// ErrStepLimitExceeded is returned when a search takes more steps than the budget allowed
+// by the regex
+var ErrStepLimitExceeded = errors.New("regex step limit exceeded")
+
+// Error describes a failure in the compilation of a regular expression
+type Error struct {
+	Msg  string // description of the error
+	Expr string // the regular expression which failed to compile
+	Pos  int    // byte offset in Expr where the error has been detected
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d: `%s`", e.Msg, e.Pos, e.Expr)
+}
+
+// Regexp is a compiled regular expression. It is immutable, so it can be safely shared
+// among goroutines.
+type Regexp struct {
+	expr      string   // the source of the regular expression
+	root      node     // the root of the compiled expression
+	names     []string // the names of the groups, the first item is the whole match
+	anchored  bool     // tells if the expression can only match at the beginning of the text
+	max_steps int      // the step budget of a single search
+}
+
+// Compile(string) parses a regular expression in the Python syntax. The searches have
+// the default step budget.
+func Compile(expr string) (*Regexp, error) {
+	return CompileWithLimit(expr, DEFAULT_MAX_STEPS)
+}
+
+// CompileWithLimit(string, int) parses a regular expression in the Python syntax, the
+// searches will fail with ErrStepLimitExceeded after max_steps steps. A non positive
+// limit selects the default one.
+func CompileWithLimit(expr string, max_steps int) (*Regexp, error) {
+	if max_steps <= 0 {
+		max_steps = DEFAULT_MAX_STEPS
+	}
+
+	root, names, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Regexp{
+		expr:      expr,
+		root:      root,
+		names:     names,
+		anchored:  isAnchored(root),
+		max_steps: max_steps,
+	}, nil
+}
+
+// MustCompile(string) is like Compile but panics if the expression cannot be parsed
+func MustCompile(expr string) *Regexp {
+	re, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// String() returns the source of the regular expression
+func (re *Regexp) String() string {
+	return re.expr
+}
+
+// NumSubexp() returns the number of groups in the regular expression
+func (re *Regexp) NumSubexp() int {
+	return len(re.names) - 1
+}
+
+// SubexpNames() returns the names of the groups, the unnamed ones have an empty name.
+// The first name is always empty as it refers to the whole match.
+func (re *Regexp) SubexpNames() []string {
+	return re.names
+}
+
+// FindStringSubmatch(string) searches the leftmost match of the regex in the string and
+// returns the text of the match followed by the text of each group, the groups which did
+// not participate to the match are empty. A nil slice is returned when there is no match.
+// The function returns ErrStepLimitExceeded if the step budget is exhausted.
+func (re *Regexp) FindStringSubmatch(s string) ([]string, error) {
+	m := &machine{
+		input: s,
+		caps:  make([]int, 2*len(re.names)),
+		limit: re.max_steps,
+	}
+
+	for start := 0; start <= len(s); {
+		for i := range m.caps {
+			m.caps[i] = -1
+		}
+
+		end := -1
+		matched := re.root.match(m, start, func(p int) bool {
+			end = p
+			return true
+		})
+		if m.exceeded {
+			return nil, ErrStepLimitExceeded
+		}
+
+		if matched {
+			m.caps[0], m.caps[1] = start, end
+			submatch := make([]string, len(re.names))
+			for i := range submatch {
+				if m.caps[2*i] >= 0 {
+					submatch[i] = s[m.caps[2*i]:m.caps[2*i+1]]
+				}
+			}
+			return submatch, nil
+		}
+
+		if re.anchored || start == len(s) {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		start += size
+	}
+	return nil, nil
+}
+
+// MatchString(string) tells if the string contains a match of the regex
+func (re *Regexp) MatchString(s string) (bool, error) {
+	submatch, err := re.FindStringSubmatch(s)
+	return submatch != nil, err
+}
@@ -0,0 +1,315 @@
+package pyregex_test
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/claudiolor/textfsmgo/pkg/pyregex"
+)
+
+var matchTestCases = []struct {
+	description  string
+	regex        string
+	text         string
+	exp_submatch []string
+}{
+	{
+		description:  "Literal match",
+		regex:        `hello`,
+		text:         "oh hello there",
+		exp_submatch: []string{"hello"},
+	},
+	{
+		description:  "No match",
+		regex:        `^hello`,
+		text:         "oh hello there",
+		exp_submatch: nil,
+	},
+	{
+		description:  "Named and unnamed groups",
+		regex:        `^(?P<name>\w+) (\d+)`,
+		text:         "eth0 1500 up",
+		exp_submatch: []string{"eth0 1500", "eth0", "1500"},
+	},
+	{
+		description:  "Greedy and lazy quantifiers",
+		regex:        `<(.+)> <(.+?)>`,
+		text:         "<a> <b> <c>",
+		exp_submatch: []string{"<a> <b> <c>", "a> <b", "c"},
+	},
+	{
+		description:  "Counted repetitions",
+		regex:        `^(\d{1,3})\.(\d{2,})\.(a{,2})(b{3})`,
+		text:         "192.168.aabbb",
+		exp_submatch: []string{"192.168.aabbb", "192", "168", "aa", "bbb"},
+	},
+	{
+		description:  "Braces not forming a quantifier are literals",
+		regex:        `a{}b{x}c{,}`,
+		text:         "a{}b{x}ccc",
+		exp_submatch: []string{"a{}b{x}ccc"},
+	},
+	{
+		description:  "Alternation and backtracking",
+		regex:        `^(up|upgrading|down)ing$`,
+		text:         "upgradinging",
+		exp_submatch: []string{"upgradinging", "upgrading"},
+	},
+	{
+		description:  "Positive lookahead",
+		regex:        `^(\S+)(?=\s+up)`,
+		text:         "Gi0/1   up",
+		exp_submatch: []string{"Gi0/1", "Gi0/1"},
+	},
+	{
+		description:  "Negative lookahead",
+		regex:        `^(?!Vlan)(\S+)`,
+		text:         "Vlan1",
+		exp_submatch: nil,
+	},
+	{
+		description:  "Positive lookbehind",
+		regex:        `(?<=mtu )(\d+)`,
+		text:         "eth0 mtu 1500",
+		exp_submatch: []string{"1500", "1500"},
+	},
+	{
+		description:  "Negative lookbehind",
+		regex:        `(?<!\d)(\d{2})\b`,
+		text:         "123 45",
+		exp_submatch: []string{"45", "45"},
+	},
+	{
+		description:  "Numbered backreference",
+		regex:        `^(\w+) \1$`,
+		text:         "bye bye",
+		exp_submatch: []string{"bye bye", "bye"},
+	},
+	{
+		description:  "Named backreference",
+		regex:        `^(?P<q>['"])(.*)(?P=q)$`,
+		text:         `"quoted"`,
+		exp_submatch: []string{`"quoted"`, `"`, "quoted"},
+	},
+	{
+		description:  "End of text anchor",
+		regex:        `(\d+)\Z`,
+		text:         "uptime 12\n",
+		exp_submatch: nil,
+	},
+	{
+		description:  "Dollar matches before the final newline",
+		regex:        `(\d+)$`,
+		text:         "uptime 12\n",
+		exp_submatch: []string{"12", "12"},
+	},
+	{
+		description:  "Case insensitive flag",
+		regex:        `(?i)^state (UP|DOWN)`,
+		text:         "STATE up",
+		exp_submatch: []string{"STATE up", "up"},
+	},
+	{
+		description:  "Global flag not at the beginning applies to the whole regex",
+		regex:        `^state (?i)(UP|DOWN)`,
+		text:         "STATE up",
+		exp_submatch: []string{"STATE up", "up"},
+	},
+	{
+		description:  "Scoped flags",
+		regex:        `^(?i:state) (UP)`,
+		text:         "STATE up",
+		exp_submatch: nil,
+	},
+	{
+		description:  "Verbose flag",
+		regex:        "(?x) ^ (\\d+)  # the number\n \\s+ (\\w+)",
+		text:         "42 answer",
+		exp_submatch: []string{"42 answer", "42", "answer"},
+	},
+	{
+		description:  "Char classes with escapes and ranges",
+		regex:        `^([\da-fA-F:]+)[\s,]+([^\s\]]+)[]]`,
+		text:         "fe80::1, abc]",
+		exp_submatch: []string{"fe80::1, abc]", "fe80::1", "abc"},
+	},
+	{
+		description:  "Atomic group does not backtrack",
+		regex:        `^(?>a+)ab`,
+		text:         "aaab",
+		exp_submatch: nil,
+	},
+	{
+		description:  "Possessive quantifier does not backtrack",
+		regex:        `^a++b`,
+		text:         "aaab",
+		exp_submatch: []string{"aaab"},
+	},
+	{
+		description:  "Unicode word chars",
+		regex:        `^(\w+)`,
+		text:         "città 1",
+		exp_submatch: []string{"città", "città"},
+	},
+	{
+		description:  "Groups not participating to the match are empty",
+		regex:        `^(a)|(b)`,
+		text:         "b",
+		exp_submatch: []string{"b", "", "b"},
+	},
+}
+
+func TestFindStringSubmatch(t *testing.T) {
+	for _, tc := range matchTestCases {
+		t.Log(tc.description)
+		re, err := pyregex.Compile(tc.regex)
+		if err != nil {
+			t.Errorf("Error in '%s': unexpected error '%s'", tc.description, err)
+			continue
+		}
+
+		submatch, err := re.FindStringSubmatch(tc.text)
+		if err != nil {
+			t.Errorf("Error in '%s': unexpected error '%s'", tc.description, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(tc.exp_submatch, submatch) {
+			t.Errorf("Error in '%s': expected %q got %q", tc.description, tc.exp_submatch, submatch)
+		}
+	}
+}
+
+var compileErrTestCases = []struct {
+	description string
+	regex       string
+	exp_err     string
+	exp_pos     int
+}{
+	{
+		description: "Unterminated group",
+		regex:       `^(\d+`,
+		exp_err:     "missing ), unterminated subpattern",
+		exp_pos:     1,
+	},
+	{
+		description: "Unbalanced parenthesis",
+		regex:       `^\d+)`,
+		exp_err:     "unbalanced parenthesis",
+		exp_pos:     4,
+	},
+	{
+		description: "Nothing to repeat",
+		regex:       `^*`,
+		exp_err:     "nothing to repeat",
+		exp_pos:     1,
+	},
+	{
+		description: "Multiple repeat",
+		regex:       `a**`,
+		exp_err:     "multiple repeat",
+		exp_pos:     2,
+	},
+	{
+		description: "Variable width lookbehind",
+		regex:       `(?<=a+)b`,
+		exp_err:     "look-behind requires fixed-width pattern",
+		exp_pos:     0,
+	},
+	{
+		description: "Unknown group reference",
+		regex:       `(a)\2`,
+		exp_err:     "invalid group reference 2",
+		exp_pos:     4,
+	},
+	{
+		description: "Redefined group name",
+		regex:       `(?P<a>x)(?P<a>y)`,
+		exp_err:     "redefinition of group name 'a'",
+		exp_pos:     8,
+	},
+	{
+		description: "Bad escape",
+		regex:       `\q`,
+		exp_err:     `bad escape \q`,
+		exp_pos:     0,
+	},
+	{
+		description: "Bad range",
+		regex:       `[z-a]`,
+		exp_err:     "bad character range z-a",
+		exp_pos:     1,
+	},
+	{
+		description: "Unterminated class",
+		regex:       `[abc`,
+		exp_err:     "unterminated character set",
+		exp_pos:     0,
+	},
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tc := range compileErrTestCases {
+		t.Log(tc.description)
+		_, err := pyregex.Compile(tc.regex)
+		var re_err *pyregex.Error
+		if !errors.As(err, &re_err) {
+			t.Errorf("Error in '%s': expected a compilation error, got '%v'", tc.description, err)
+			continue
+		}
+
+		if re_err.Msg != tc.exp_err || re_err.Pos != tc.exp_pos {
+			t.Errorf("Error in '%s': expected '%s' at %d, got '%s' at %d",
+				tc.description, tc.exp_err, tc.exp_pos, re_err.Msg, re_err.Pos)
+		}
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	re, err := pyregex.CompileWithLimit(`^(a+)+$`, 10000)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	if _, err := re.FindStringSubmatch(strings.Repeat("a", 40) + "b"); !errors.Is(err, pyregex.ErrStepLimitExceeded) {
+		t.Errorf("Expected step limit error, got '%v'", err)
+	}
+
+	if submatch, err := re.FindStringSubmatch("aaaa"); err != nil || submatch == nil {
+		t.Errorf("Expected a match within the budget, got %q, '%v'", submatch, err)
+	}
+}
+
+// The engine must agree with RE2 on the syntax both of them support
+func TestAgreementWithRE2(t *testing.T) {
+	var regexes = []string{
+		`^\s*(\d+): (\S+): <(.+)> mtu (\d+) .* state (\S+) .*`,
+		`^\s*link/\S+\s+([\da-fA-F]{2}(:[\da-fA-F]{2}){5}) .*`,
+		`^\s*inet[6]?\s+((?:\d+(\.\d+){3})|(?:(?:(?:[A-Fa-f0-9]*)?:){1,7}[A-Fa-f0-9]*)).*`,
+		`(\w+)\s*=\s*(\S*)`,
+	}
+	var lines = []string{
+		"2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc mq state UP group default qlen 1000",
+		"    link/ether 00:11:22:33:44:55 brd ff:ff:ff:ff:ff:ff",
+		"    inet 192.168.1.10/24 brd 192.168.1.255 scope global eth0",
+		"    inet6 fe80::211:22ff:fe33:4455/64 scope link",
+		"key = value",
+		"",
+	}
+
+	for _, regex := range regexes {
+		re2 := regexp.MustCompile(regex)
+		re := pyregex.MustCompile(regex)
+		for _, line := range lines {
+			exp := re2.FindStringSubmatch(line)
+			got, err := re.FindStringSubmatch(line)
+			if err != nil || !reflect.DeepEqual(exp, got) {
+				t.Errorf("Error matching '%s' against '%s': expected %q got %q (%v)",
+					regex, line, exp, got, err)
+			}
+		}
+	}
+}
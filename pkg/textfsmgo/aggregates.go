@@ -0,0 +1,157 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// Names of the options aggregating the matches of a value in a record
+const (
+	COUNT_OPTION = "Count"
+	SUM_OPTION   = "Sum"
+	MIN_OPTION   = "Min"
+	MAX_OPTION   = "Max"
+	FIRST_OPTION = "First"
+	LAST_OPTION  = "Last"
+	SET_OPTION   = "Set"
+)
+
+// The types whose values can be summed
+var SUMMABLE_TYPES = []ValueType{TYPE_INT, TYPE_FLOAT, TYPE_DURATION}
+
+// The types whose values can be compared by Min and Max
+var COMPARABLE_TYPES = []ValueType{TYPE_STRING, TYPE_INT, TYPE_FLOAT, TYPE_IP, TYPE_DURATION, TYPE_TIME}
+
+// The builtin aggregating options. A value can have a single aggregating option, which
+// cannot be combined with List, and the empty matches are ignored.
+var aggregate_options = []*ValueOption{
+	{
+		Name:      COUNT_OPTION,
+		Conflicts: []string{"List", TYPE_OPTION},
+		Aggregate: func(ctx *OptionContext, current interface{}, val interface{}) (interface{}, error) {
+			if count, counted := current.(int64); counted {
+				return count + 1, nil
+			}
+			return int64(1), nil
+		},
+	},
+	{
+		Name:      SUM_OPTION,
+		Conflicts: []string{"List"},
+		Validate: func(decl *ValueDecl) error {
+			if !slices.Contains(SUMMABLE_TYPES, decl.Type()) {
+				return fmt.Errorf("the %s option cannot sum values of type %s", SUM_OPTION, decl.Type())
+			}
+			return nil
+		},
+		Aggregate: func(ctx *OptionContext, current interface{}, val interface{}) (interface{}, error) {
+			switch current := current.(type) {
+			case int64:
+				return current + val.(int64), nil
+			case float64:
+				return current + val.(float64), nil
+			case time.Duration:
+				return current + val.(time.Duration), nil
+			}
+			return val, nil
+		},
+	},
+	compareOption(MIN_OPTION, -1),
+	compareOption(MAX_OPTION, 1),
+	{
+		Name:      FIRST_OPTION,
+		Conflicts: []string{"List"},
+		Aggregate: func(ctx *OptionContext, current interface{}, val interface{}) (interface{}, error) {
+			if current != nil {
+				return current, nil
+			}
+			return val, nil
+		},
+	},
+	{
+		Name:      LAST_OPTION,
+		Conflicts: []string{"List"},
+		Aggregate: func(ctx *OptionContext, current interface{}, val interface{}) (interface{}, error) {
+			return val, nil
+		},
+	},
+	{
+		Name:      SET_OPTION,
+		Conflicts: []string{"List"},
+		Parse: func(decl *ValueDecl, arg string) error {
+			decl.value.rtype = LIST_RECORD
+			return nil
+		},
+		Aggregate: func(ctx *OptionContext, current interface{}, val interface{}) (interface{}, error) {
+			switch current := current.(type) {
+			case []string:
+				if !slices.Contains(current, val.(string)) {
+					return append(current, val.(string)), nil
+				}
+			case []interface{}:
+				for _, item := range current {
+					if reflect.DeepEqual(item, val) {
+						return current, nil
+					}
+				}
+				return append(current, val), nil
+			}
+			return current, nil
+		},
+	},
+}
+
+// compareOption(string, int) creates an option keeping the match which compares to the
+// current one with the given sign: -1 keeps the lowest, 1 the highest
+func compareOption(name string, sign int) *ValueOption {
+	return &ValueOption{
+		Name:      name,
+		Conflicts: []string{"List"},
+		Validate: func(decl *ValueDecl) error {
+			if !slices.Contains(COMPARABLE_TYPES, decl.Type()) {
+				return fmt.Errorf("the %s option cannot compare values of type %s", name, decl.Type())
+			}
+			return nil
+		},
+		Aggregate: func(ctx *OptionContext, current interface{}, val interface{}) (interface{}, error) {
+			if current == nil || compareValues(val, current)*sign > 0 {
+				return val, nil
+			}
+			return current, nil
+		},
+	}
+}
+
+// compareValues(interface{}, interface{}) compares two values of the same comparable
+// type, returning -1, 0 or 1 as a is lower than, equal to or greater than b
+func compareValues(a interface{}, b interface{}) int {
+	cmp := func(less bool, greater bool) int {
+		switch {
+		case less:
+			return -1
+		case greater:
+			return 1
+		}
+		return 0
+	}
+
+	switch a := a.(type) {
+	case string:
+		return cmp(a < b.(string), a > b.(string))
+	case int64:
+		return cmp(a < b.(int64), a > b.(int64))
+	case float64:
+		return cmp(a < b.(float64), a > b.(float64))
+	case time.Duration:
+		return cmp(a < b.(time.Duration), a > b.(time.Duration))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case netip.Addr:
+		return a.Compare(b.(netip.Addr))
+	}
+	return 0
+}
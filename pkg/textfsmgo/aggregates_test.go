@@ -0,0 +1,148 @@
+package textfsmgo
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestAggregateValues(t *testing.T) {
+	tmpl := `Value vrf (\S+)
+Value Count routes (\S+)
+Value Type=int,Sum metric (\d+)
+Value Type=int,Min min_metric (\d+)
+Value Type=int,Max max_metric (\d+)
+Value First first_hop (\S+)
+Value Last last_hop (\S+)
+Value Set hops (\S+)
+Value Type=ip,Set,Required nets ([\d.]+)
+
+Start
+  ^VRF ${vrf}
+  ^route ${routes} via ${first_hop} metric ${metric} -> Continue
+  ^route ${nets}/\d+ via ${last_hop} metric ${min_metric} -> Continue
+  ^route \S+ via ${hops} metric ${max_metric}
+  ^end -> Record
+`
+	text := `VRF red
+route 10.0.0.0/8 via r1 metric 10
+route 10.1.0.0/16 via r2 metric 5
+route 10.0.0.0/24 via r1 metric 20
+end
+VRF blue
+route 0.0.0.0/0 via r9 metric 1
+end
+`
+	for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+		parser, err := NewTextFSMParserFromString(tmpl, WithSemantics(semantics))
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		res, err := parser.ParseTextToDicts(text)
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		if len(res) != 2 {
+			t.Fatalf("Error in 'Test aggregate values': expected 2 records, got %+v", res)
+		}
+		red := res[0]
+		if red["vrf"] != "red" || red["routes"] != int64(3) || red["metric"] != int64(35) ||
+			red["min_metric"] != int64(5) || red["max_metric"] != int64(20) ||
+			red["first_hop"] != "r1" || red["last_hop"] != "r1" ||
+			len(red["hops"].([]string)) != 2 || len(red["nets"].([]interface{})) != 2 {
+			t.Errorf("Error in 'Test aggregate values': unexpected record %+v", red)
+		}
+		blue := res[1]
+		if blue["routes"] != int64(1) || blue["metric"] != int64(1) || blue["first_hop"] != "r9" ||
+			blue["last_hop"] != "r9" || len(blue["hops"].([]string)) != 1 {
+			t.Errorf("Error in 'Test aggregate values': unexpected record %+v", blue)
+		}
+	}
+}
+
+func TestAggregateRecordOperations(t *testing.T) {
+	// Clear restarts the aggregation, the filldown values go on aggregating until Clearall
+	tmpl := `Value Filldown name (\S+)
+Value Required,Count errors (\S+)
+Value Filldown,Count total (\S+)
+
+Start
+  ^iface ${name}
+  ^error ${errors} -> Continue
+  ^error ${total}
+  ^reset -> Clear
+  ^wipe -> Clearall
+  ^end -> Record
+`
+	text := "iface a\nerror x\nerror y\nreset\nerror z\nend\niface b\nerror q\nend\nwipe\niface c\nerror w\nend\n"
+	parser, err := NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test aggregates with Clear and Filldown", parser, text, []map[string]interface{}{
+		{"name": "a", "errors": int64(1), "total": int64(3)},
+		{"name": "b", "errors": int64(1), "total": int64(4)},
+		{"name": "c", "errors": int64(1), "total": int64(1)},
+	})
+
+	// Fillup fills the previous records with the final aggregate of the record
+	tmpl = "Value Fillup,Count peers (\\S+)\nValue name (\\S+)\n\nStart\n  ^name ${name} -> Record\n  ^peer ${peers}\n"
+	for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+		parser, err := NewTextFSMParserFromString(tmpl, WithSemantics(semantics))
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		checkRecords(t, "Test aggregates with Fillup", parser, "name a\nname b\npeer x\npeer y\n", []map[string]interface{}{
+			{"name": "a", "peers": int64(2)},
+			{"name": "b", "peers": int64(2)},
+			{"name": "", "peers": int64(2)},
+		})
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	var aggregateTestCases = []struct {
+		description string
+		line        string
+		exp_err     string
+	}{
+		{
+			description: "Test Sum of strings",
+			line:        "Value Sum myval (.*)",
+			exp_err:     ".*column 7: the Sum option cannot sum values of type string",
+		},
+		{
+			description: "Test Max of booleans",
+			line:        "Value Max,Type=bool myval (.*)",
+			exp_err:     ".*the Max option cannot compare values of type bool",
+		},
+		{
+			description: "Test Count with Type",
+			line:        "Value Type=int,Count myval (.*)",
+			exp_err:     ".*conflicting option Count",
+		},
+		{
+			description: "Test two aggregates",
+			line:        "Value First,Last myval (.*)",
+			exp_err:     ".*conflicting option Last, value myval is already aggregated by First",
+		},
+		{
+			description: "Test aggregate of List",
+			line:        "Value List,Set myval (.*)",
+			exp_err:     ".*conflicting option Set",
+		},
+		{
+			description: "Test Set of named groups",
+			line:        "Value Set myval ((?P<a>\\d+))",
+			exp_err:     ".*the Set option cannot be used with the named groups of a List",
+		},
+	}
+
+	for _, tc := range aggregateTestCases {
+		_, err := NewTextFSMParserFromString(tc.line + "\n\nStart\n  ^${myval}\n")
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Name of the state parsing the rows of the templates written for the inferred tables
+const ROWS_STATE = "Rows"
+
+// regex for matching the lines separating the header from the rows, e.g. ----- -----
+var TABLE_SEPARATOR_REGEX = regexp.MustCompile(`^[\s\-=+|]*$`)
+
+// regex for matching the characters which cannot be part of a value name
+var NAME_INVALID_CHARS_REGEX = regexp.MustCompile(`\W+`)
+
+// TableColumn is a column of an aligned table, inferred by InferTable()
+type TableColumn struct {
+	Name  string // the name of the value of the column, derived from the title
+	Title string // the title of the column in the header
+	Start int    // the position of the first character of the column, counting the characters from 0
+	End   int    // the position following the column, -1 for the last one
+}
+
+// TableLayout is the layout of an aligned table, inferred from its text by InferTable()
+type TableLayout struct {
+	Header  string        // the header line of the table
+	Columns []TableColumn // the columns of the table, from left to right
+}
+
+// InferTable(string) infers the layout of a simple aligned table, such as the output of
+// df or ps: the header is the first line with some text, and the columns are separated by
+// the positions which are blank in the header and in all the rows. The columns with no
+// title are part of the previous one, as the ones with no text in the rows, so that a
+// title or a cell made of several words is kept together.
+func InferTable(text string) (*TableLayout, error) {
+	lines := [][]rune{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(lines) == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(lines) > 0 && TABLE_SEPARATOR_REGEX.MatchString(line) {
+			continue
+		}
+		lines = append(lines, []rune(line))
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no header found, the text is empty")
+	}
+	header, rows := lines[0], lines[1:]
+
+	// A position belongs to a column if any line has some text there
+	width := 0
+	for _, line := range lines {
+		if len(line) > width {
+			width = len(line)
+		}
+	}
+	used := make([]bool, width)
+	for _, line := range lines {
+		for i, r := range line {
+			if r != ' ' && r != '\t' {
+				used[i] = true
+			}
+		}
+	}
+
+	columnText := func(line []rune, start int, end int) string {
+		if start >= len(line) {
+			return ""
+		}
+		if end > len(line) {
+			end = len(line)
+		}
+		return strings.TrimSpace(string(line[start:end]))
+	}
+	hasRows := func(start int, end int) bool {
+		for _, row := range rows {
+			if columnText(row, start, end) != "" {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Each run of used positions is a column, merged into the previous one when it has
+	// no title or no text in the rows
+	layout := &TableLayout{Header: string(header)}
+	for start := 0; start < width; {
+		if !used[start] {
+			start++
+			continue
+		}
+		end := start
+		for end < width && used[end] {
+			end++
+		}
+
+		title := columnText(header, start, end)
+		n := len(layout.Columns)
+		if n > 0 && (title == "" || (len(rows) > 0 && !hasRows(start, end))) {
+			layout.Columns[n-1].End = end
+		} else if n == 1 && layout.Columns[0].Title == "" {
+			// The first column had no title, it is part of this one
+			layout.Columns[0] = TableColumn{Title: title, Start: 0, End: end}
+		} else {
+			layout.Columns = append(layout.Columns, TableColumn{Title: title, Start: start, End: end})
+		}
+		start = end
+	}
+
+	// The columns extend to the next one, so the cells wider than the others are not cut
+	names := map[string]bool{}
+	for i := range layout.Columns {
+		column := &layout.Columns[i]
+		column.Title = columnText(header, column.Start, column.End)
+		if i == 0 {
+			column.Start = 0
+		}
+		if i == len(layout.Columns)-1 {
+			column.End = -1
+		} else {
+			column.End = layout.Columns[i+1].Start
+		}
+		column.Name = columnName(column.Title, i, names)
+	}
+	return layout, nil
+}
+
+// columnName(string, int, map[string]bool) derives the name of the value of a column from its
+// title, e.g. "Mounted on" becomes mounted_on. The names already used are suffixed with a number.
+func columnName(title string, index int, used map[string]bool) string {
+	name := strings.Trim(NAME_INVALID_CHARS_REGEX.ReplaceAllString(strings.ToLower(title), "_"), "_")
+	if name == "" {
+		name = fmt.Sprintf("column%d", index+1)
+	}
+	if len(name) > MAX_NAME_LEN-4 {
+		name = name[:MAX_NAME_LEN-4]
+	}
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// Template() returns a template parsing the table with Column values. The rows are the
+// lines following the header, with the blank and the separator lines skipped.
+func (l *TableLayout) Template() string {
+	var tmpl strings.Builder
+	fmt.Fprintf(&tmpl, "# Template inferred from the header:\n#   %s\n", l.Header)
+	for _, column := range l.Columns {
+		end := ""
+		if column.End >= 0 {
+			end = fmt.Sprint(column.End)
+		}
+		fmt.Fprintf(&tmpl, "Value %s(%d,%s) %s\n", COLUMN_KEYWORD, column.Start, end, column.Name)
+	}
+
+	titles := strings.Fields(l.Header)
+	for i, title := range titles {
+		titles[i] = strings.ReplaceAll(regexp.QuoteMeta(title), "$", "$$")
+	}
+	vars := ""
+	for _, column := range l.Columns {
+		vars += "${" + column.Name + "}"
+	}
+	fmt.Fprintf(&tmpl, "\n%s\n  ^\\s*%s\\s*$$ -> %s\n\n", START_STATE, strings.Join(titles, `\s+`), ROWS_STATE)
+	fmt.Fprintf(&tmpl, "%s\n  ^[\\s\\-=+|]*$$\n  ^.%s -> Record\n", ROWS_STATE, vars)
+	return tmpl.String()
+}
+
+// Parser(...ParserOption) returns a parser of the table, compiling its template
+func (l *TableLayout) Parser(opts ...ParserOption) (*TextFSM, error) {
+	return NewTextFSMParserFromString(l.Template(), opts...)
+}
+
+// ParseTable(string) parses a simple aligned table with no template: the layout of the table
+// is inferred from the text, then the rows are parsed as the template of the layout does.
+// The records have the same shape of the ones returned by ParseTextToDicts().
+func ParseTable(text string) ([]map[string]interface{}, error) {
+	layout, err := InferTable(text)
+	if err != nil {
+		return nil, err
+	}
+	parser, err := layout.Parser()
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseTextToDicts(text)
+}
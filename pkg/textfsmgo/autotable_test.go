@@ -0,0 +1,98 @@
+package textfsmgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInferTable(t *testing.T) {
+	text := `
+Interface              IP-Address      OK? Method Status                Protocol
+---------              ----------      --- ------ ------                --------
+GigabitEthernet0/0     10.0.0.1        YES NVRAM  up                    up
+GigabitEthernet0/1     unassigned      YES unset  administratively down down
+
+Loopback0              1.1.1.1         YES manual up                    up
+`
+	layout, err := InferTable(text)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	exp_columns := []TableColumn{
+		{Name: "interface", Title: "Interface", Start: 0, End: 23},
+		{Name: "ip_address", Title: "IP-Address", Start: 23, End: 39},
+		{Name: "ok", Title: "OK?", Start: 39, End: 43},
+		{Name: "method", Title: "Method", Start: 43, End: 50},
+		{Name: "status", Title: "Status", Start: 50, End: 72},
+		{Name: "protocol", Title: "Protocol", Start: 72, End: -1},
+	}
+	if !reflect.DeepEqual(layout.Columns, exp_columns) {
+		t.Errorf("Error in 'Test infer table': expected %+v got %+v", exp_columns, layout.Columns)
+	}
+
+	res, err := ParseTable(text)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	exp := []map[string]interface{}{
+		{"interface": "GigabitEthernet0/0", "ip_address": "10.0.0.1", "ok": "YES", "method": "NVRAM", "status": "up", "protocol": "up"},
+		{"interface": "GigabitEthernet0/1", "ip_address": "unassigned", "ok": "YES", "method": "unset",
+			"status": "administratively down", "protocol": "down"},
+		{"interface": "Loopback0", "ip_address": "1.1.1.1", "ok": "YES", "method": "manual", "status": "up", "protocol": "up"},
+	}
+	if !reflect.DeepEqual(exp, res) {
+		t.Errorf("Error in 'Test parse table': expected %+v got %+v", exp, res)
+	}
+
+	// The template parses the table as ParseTable does
+	parser, err := NewTextFSMParserFromString(layout.Template())
+	if err != nil {
+		t.Fatalf("Error in 'Test table template': unexpected error '%s' in\n%s", err, layout.Template())
+	}
+	checkRecords(t, "Test table template", parser, text, exp)
+}
+
+func TestInferTableColumns(t *testing.T) {
+	var tableTestCases = []struct {
+		description string
+		text        string
+		exp         []TableColumn
+	}{
+		{
+			description: "Test titles and cells of several words",
+			text: "Filesystem      Size  Used Avail Use% Mounted on\n" +
+				"/dev/sda1        50G   20G   28G  42% /\n" +
+				"/dev/sdb1       100G   80G   20G  80% /mnt/data\n",
+			exp: []TableColumn{
+				{Name: "filesystem", Title: "Filesystem", Start: 0, End: 16},
+				{Name: "size", Title: "Size", Start: 16, End: 22},
+				{Name: "used", Title: "Used", Start: 22, End: 27},
+				{Name: "avail", Title: "Avail", Start: 27, End: 33},
+				{Name: "use", Title: "Use%", Start: 33, End: 38},
+				{Name: "mounted_on", Title: "Mounted on", Start: 38, End: -1},
+			},
+		},
+		{
+			description: "Test right aligned column and duplicate names",
+			text:        "  PID  Pid CMD\n    1    2 init\n  812  813 bash -l\n",
+			exp: []TableColumn{
+				{Name: "pid", Title: "PID", Start: 0, End: 7},
+				{Name: "pid_2", Title: "Pid", Start: 7, End: 11},
+				{Name: "cmd", Title: "CMD", Start: 11, End: -1},
+			},
+		},
+	}
+
+	for _, tc := range tableTestCases {
+		layout, err := InferTable(tc.text)
+		if err != nil {
+			t.Errorf("Error in '%s': unexpected error '%s'", tc.description, err)
+		} else if !reflect.DeepEqual(layout.Columns, tc.exp) {
+			t.Errorf("Error in '%s': expected %+v got %+v", tc.description, tc.exp, layout.Columns)
+		}
+	}
+
+	if _, err := InferTable("\n  \n"); err == nil {
+		t.Errorf("Error in 'Test empty text': expected error, no errors got")
+	}
+}
@@ -0,0 +1,75 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stackFrame is a state saved on the stack by Call or Block
+type stackFrame struct {
+	state    string // the state to go back to
+	indent   int    // the indentation of the line entering the block, -1 for Call
+	filldown Record // the filldown values to restore leaving the block, for Block
+}
+
+// lineIndent(string) returns the indentation of the line, the number of its leading spaces
+// and tabs
+func lineIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// inBlock() tells if the current state has been entered by Block
+func (s *Session) inBlock() bool {
+	return len(s.stack) > 0 && s.stack[len(s.stack)-1].indent >= 0
+}
+
+// blockLine(string) returns the text matched by the rules for the given line: in a block
+// the indentation is removed, so the rules do not depend on the depth of the block
+func (s *Session) blockLine(line string) string {
+	if s.inBlock() {
+		return strings.TrimLeft(line, " \t")
+	}
+	return line
+}
+
+// filldownScope() returns a copy of the filldown values, restored when the block entered
+// by the current line is left. The legacy filldown values come from the last record, so
+// they are not scoped.
+func (s *Session) filldownScope() Record {
+	if s.tmpl.semantics != SEMANTICS_PYTHON {
+		return nil
+	}
+	scope := make(Record, len(s.filldown))
+	for name, val := range s.filldown {
+		scope[name] = val
+	}
+	return scope
+}
+
+// leaveBlocks(string) goes back to the states which entered the blocks the line is not
+// indented under, before the line is parsed. The filldown values set in the blocks left
+// are forgotten. The blank lines do not leave any block.
+func (s *Session) leaveBlocks(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	indent := lineIndent(line)
+	for s.inBlock() && indent <= s.stack[len(s.stack)-1].indent {
+		s.returnState()
+		if s.tmpl.trace != nil {
+			fmt.Fprintf(s.tmpl.trace, "line %d: left block state %s, now in state %s, depth %d\n",
+				s.line_no, s.prev_state, s.state, len(s.stack))
+		}
+	}
+}
+
+// returnState() goes back to the state on top of the stack. Leaving a block, the filldown
+// values are restored as they were when the block was entered.
+func (s *Session) returnState() {
+	frame := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	s.prev_state, s.state = s.state, frame.state
+	if frame.filldown != nil {
+		s.filldown = frame.filldown
+	}
+}
@@ -0,0 +1,115 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Option declaring a value of a child record set, e.g. Child=interfaces
+const CHILD_OPTION = "Child"
+
+// checkChildSets() checks the child record sets declared by the values and the references
+// to the child values, once all the values have been declared. The expressions of the
+// Computed values and of the Validate rules are evaluated on the parent record, so they
+// can refer to the list of a set but not to the values of the children.
+func (t *Template) checkChildSets() TemplateErrors {
+	errs := TemplateErrors{}
+	valueError := func(line_no int, column int, token string, format string, args ...interface{}) {
+		errs = append(errs, &TemplateError{
+			Line:     line_no,
+			Column:   column,
+			Token:    token,
+			Severity: SEVERITY_ERROR,
+			Msg:      fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, set := range t.child_sets {
+		if value, present := t.values[set]; present {
+			valueError(value.line_no, 0, set, "the child record set %s has the name of a value", set)
+		}
+	}
+	for _, name := range t.value_names {
+		value := t.values[name]
+		if value.expr == nil {
+			continue
+		}
+		for _, ref := range value.expr.refs {
+			if t.values[ref.name].child != "" {
+				valueError(value.line_no, value.expr.column+ref.pos, ref.name,
+					"the value %s of the %s child records cannot be used in the expression of %s",
+					ref.name, t.values[ref.name].child, name)
+			}
+		}
+	}
+	for _, rule := range t.validations {
+		refs := []exprRef{}
+		switch rule.kind {
+		case VALIDATE_EXPR:
+			refs = rule.expr.refs
+		case VALIDATE_UNIQUE:
+			for _, name := range rule.names {
+				refs = append(refs, exprRef{name: name, pos: strings.Index(rule.source, name)})
+			}
+		}
+		for _, ref := range refs {
+			if t.values[ref.name].child != "" {
+				valueError(rule.line_no, rule.column+ref.pos, ref.name,
+					"the value %s of the %s child records cannot be used in the validations", ref.name, t.values[ref.name].child)
+			}
+		}
+	}
+	return errs
+}
+
+// isChildSet(string) tells if the name is the one of a child record set of the template
+func (t *Template) isChildSet(name string) bool {
+	_, present := t.children[name]
+	return present
+}
+
+// recordChild(Record, string) collects the values of the given child record set, set so
+// far in the parent record, in a child record appended to the list of the set. The child
+// values are then emptied, to be filled by the next child. As for the records, an empty
+// child or a child missing a Required value is dropped.
+func (s *Session) recordChild(record Record, set string) {
+	child := Record{}
+	keep, empty := true, true
+	for _, name := range s.tmpl.children[set] {
+		value := s.tmpl.values[name]
+		val := record[name]
+		if !s.isEmpty(val) {
+			empty = false
+		} else if value.required {
+			keep = false
+		}
+		if value.secret {
+			val = s.tmpl.redaction.redactValue(val)
+		}
+		child[name] = val
+		record[name] = value.emptyValue()
+	}
+	if keep && !empty {
+		record[set] = append(record[set].([]Record), child)
+	}
+}
+
+// clearChild(Record, string) implements the Clear operation on a child record set, so it
+// clears the values of the child being filled. The children already collected are kept.
+func (s *Session) clearChild(record Record, set string) {
+	for _, name := range s.tmpl.children[set] {
+		record[name] = s.tmpl.values[name].emptyValue()
+	}
+}
+
+// collectChildren(Record) collects the children pending in the parent record, which is
+// being recorded, then it removes the child values from it: they are carried only by the
+// child records.
+func (s *Session) collectChildren(record Record) {
+	for _, set := range s.tmpl.child_sets {
+		s.recordChild(record, set)
+		for _, name := range s.tmpl.children[set] {
+			delete(record, name)
+		}
+	}
+}
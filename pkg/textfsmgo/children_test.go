@@ -0,0 +1,131 @@
+package textfsmgo
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestChildRecords(t *testing.T) {
+	var childTestCases = []struct {
+		description string
+		template    string
+		text        string
+		options     []ParserOption
+		exp         []map[string]interface{}
+	}{
+		{
+			description: "Test child records",
+			template: `Value vrf (\S+)
+Value Child=interfaces,Required name (\S+)
+Value Child=interfaces,Type=int mtu (\d+)
+Value Child=routes prefix (\S+)
+Value Computed count = len(interfaces)
+
+Start
+  ^VRF -> Continue.Record
+  ^VRF ${vrf}
+  ^  Interface ${name}( mtu ${mtu})? -> Record[interfaces]
+  ^  Interface -> Clear[interfaces]
+  ^  Route ${prefix} -> Record[routes]
+`,
+			text: "VRF red\n  Interface eth0 mtu 1500\n  Route 10.0.0.0/8\n  Interface\n  Interface eth1\n" +
+				"VRF blue\n  Route 10.1.0.0/16\n",
+			exp: []map[string]interface{}{
+				{"vrf": "red", "count": int64(2), "routes": []Record{{"prefix": "10.0.0.0/8"}}, "interfaces": []Record{
+					{"name": "eth0", "mtu": int64(1500)}, {"name": "eth1", "mtu": nil},
+				}},
+				{"vrf": "blue", "count": int64(0), "routes": []Record{{"prefix": "10.1.0.0/16"}}, "interfaces": []Record{}},
+			},
+		},
+		{
+			description: "Test pending children collected with the parent",
+			template: `Value vrf (\S+)
+Value Child=interfaces,Secret name (\S+)
+
+Start
+  ^VRF -> Continue.Record
+  ^VRF ${vrf}
+  ^  Interface ${name}
+`,
+			text: "VRF red\n  Interface eth0\n",
+			exp: []map[string]interface{}{
+				{"vrf": "red", "interfaces": []Record{{"name": "********"}}},
+			},
+		},
+		{
+			description: "Test children merged by key",
+			template: `Value Key vrf (\S+)
+Value Child=interfaces name (\S+)
+
+Start
+  ^VRF -> Continue.Record
+  ^VRF ${vrf}
+  ^  Interface ${name} -> Record[interfaces]
+`,
+			text:    "VRF red\n  Interface eth0\nVRF blue\n  Interface eth1\nVRF red\n  Interface eth2\n",
+			options: []ParserOption{WithKeyMode(KEY_MERGE)},
+			exp: []map[string]interface{}{
+				{"vrf": "red", "_key": []string{"red"}, "interfaces": []Record{{"name": "eth0"}, {"name": "eth2"}}},
+				{"vrf": "blue", "_key": []string{"blue"}, "interfaces": []Record{{"name": "eth1"}}},
+			},
+		},
+	}
+
+	for _, tc := range childTestCases {
+		for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+			parser, err := NewTextFSMParserFromString(tc.template, append(tc.options, WithSemantics(semantics))...)
+			if err != nil {
+				t.Fatalf("Error in '%s': unexpected error '%s'", tc.description, err)
+			}
+			checkRecords(t, tc.description, parser, tc.text, tc.exp)
+		}
+	}
+}
+
+func TestChildRecordErrors(t *testing.T) {
+	var childTestCases = []struct {
+		description string
+		template    string
+		exp_err     string
+	}{
+		{
+			description: "Test unknown child record set",
+			template:    "Value Child=ifs a (\\S+)\n\nStart\n  ^${a} -> Record[other]\n",
+			exp_err:     ".*line 4, column 19: unknown child record set other",
+		},
+		{
+			description: "Test invalid operation on a child record set",
+			template:    "Value Child=ifs a (\\S+)\n\nStart\n  ^${a} -> Next.Clearall[ifs]\n",
+			exp_err:     ".*line 4, column 26: the Clearall operation cannot be applied to a child record set",
+		},
+		{
+			description: "Test child record set named as a value",
+			template:    "Value Child=a a (\\S+)\n\nStart\n  ^${a} -> Record[a]\n",
+			exp_err:     ".*line 1.*: the child record set a has the name of a value",
+		},
+		{
+			description: "Test child value in a Computed value",
+			template:    "Value Child=ifs a (\\S+)\nValue Computed b = a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 20: the value a of the ifs child records cannot be used in the expression of b",
+		},
+		{
+			description: "Test child value in a validation",
+			template:    "Value Child=ifs a (\\S+)\nValidate a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 10: the value a of the ifs child records cannot be used in the validations",
+		},
+		{
+			description: "Test Child with Filldown",
+			template:    "Value Child=ifs,Filldown a (\\S+)\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 1, column 17: conflicting option Filldown",
+		},
+	}
+
+	for _, tc := range childTestCases {
+		_, err := NewTextFSMParserFromString(tc.template)
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/exp/slices"
+)
+
+// Keyword of the values sliced from the lines by position, e.g. Value Column(12,24) port
+const COLUMN_KEYWORD = "Column"
+
+// regex for matching a Column value: the Column keyword is the last option, and it is
+// followed by the name of the value instead of the regex
+var COLUMN_VALUE_REGEX = regexp.MustCompile(`^Value\s+(?:(\S+),)?Column\((.*)\)\s+(\w+)$`)
+
+// regex for matching the range of a Column value, the end can be omitted
+var COLUMN_RANGE_REGEX = regexp.MustCompile(`^\s*(\d+)\s*(?:,\s*(\d*)\s*)?$`)
+
+// valueColumn is the column a Column value is sliced from. The positions count the
+// characters of the line from 0, as the slices do, and the end is excluded.
+type valueColumn struct {
+	start int    // the position of the first character of the column
+	end   int    // the position following the column, -1 if it goes to the end of the line
+	title string // the title of the column in the header, its position is learned by the Header action
+}
+
+// parseColumn(string) parses the argument of a Column value: the range of the column, as in
+// Column(12,24) or Column(38,), or the quoted title of the column in the header, as in
+// Column("Mac Address")
+func parseColumn(spec string) (*valueColumn, error) {
+	if title, err := strconv.Unquote(strings.TrimSpace(spec)); err == nil {
+		if strings.TrimSpace(title) == "" {
+			return nil, fmt.Errorf("empty title of the column")
+		}
+		return &valueColumn{title: title}, nil
+	}
+
+	bounds := COLUMN_RANGE_REGEX.FindStringSubmatch(spec)
+	if bounds == nil {
+		return nil, fmt.Errorf(`invalid column %s, it should be %s(start,end) or %s("title")`,
+			spec, COLUMN_KEYWORD, COLUMN_KEYWORD)
+	}
+	// Cannot fail, the regex matched only digits
+	column := &valueColumn{end: -1}
+	column.start, _ = strconv.Atoi(bounds[1])
+	if bounds[2] != "" {
+		column.end, _ = strconv.Atoi(bounds[2])
+		if column.end <= column.start {
+			return nil, fmt.Errorf("the end of the column %s should follow its start", spec)
+		}
+	}
+	return column, nil
+}
+
+// columnText(string, *valueColumn, string) returns the text of the column of the given value
+// in the line, with the spaces around trimmed. A column beyond the end of the line, or whose
+// title has not been found in a header yet, is empty.
+func (s *Session) columnText(name string, column *valueColumn, line string) string {
+	start, end := column.start, column.end
+	if column.title != "" {
+		bounds, learned := s.columns[name]
+		if !learned {
+			return ""
+		}
+		start, end = bounds[0], bounds[1]
+	}
+
+	runes := []rune(line)
+	if start >= len(runes) {
+		return ""
+	}
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+	return strings.TrimSpace(string(runes[start:end]))
+}
+
+// learnColumns(string) learns the columns of the Column values with a title from a header
+// line. The titles are found as whole words, the longest first, so that a title is not found
+// inside a longer one, e.g. Port inside Ports. A column starts with its title, the first one
+// at the start of the line, and ends where the next word of the header starts, even when it
+// is the title of a column with no value. The titles not found leave their values empty.
+func (s *Session) learnColumns(line string) {
+	runes := []rune(line)
+	isBlank := func(i int) bool {
+		return i < 0 || i >= len(runes) || unicode.IsSpace(runes[i])
+	}
+
+	names := append([]string{}, s.tmpl.header_vals...)
+	sort.SliceStable(names, func(i, j int) bool {
+		return utf8.RuneCountInString(s.tmpl.values[names[i]].column.title) >
+			utf8.RuneCountInString(s.tmpl.values[names[j]].column.title)
+	})
+
+	// The characters of the titles found, which cannot be part of another title
+	found := make([]bool, len(runes))
+	titles := map[string]int{}
+	for _, name := range names {
+		if start := findTitle(runes, found, s.tmpl.values[name].column.title); start != -1 {
+			titles[name] = start
+		}
+	}
+
+	// The columns start at the titles found and at the words of the other titles
+	starts := []int{}
+	for i := range runes {
+		if !isBlank(i) && isBlank(i-1) && !found[i] {
+			starts = append(starts, i)
+		}
+	}
+	for _, start := range titles {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+
+	s.columns = make(map[string][2]int, len(titles))
+	for name, title_start := range titles {
+		start, end := title_start, -1
+		if start == starts[0] {
+			start = 0
+		}
+		for _, next := range starts {
+			if next > title_start {
+				end = next
+				break
+			}
+		}
+		s.columns[name] = [2]int{start, end}
+	}
+}
+
+// findTitle([]rune, []bool, string) returns the position of the first occurrence of the title
+// in the header which is a whole word, or a sequence of whole words, and does not overlap the
+// titles already found. The characters of the title are marked as found. It returns -1 if the
+// title is not in the header.
+func findTitle(header []rune, found []bool, title string) int {
+	runes := []rune(strings.TrimSpace(title))
+	isBlank := func(i int) bool {
+		return i < 0 || i >= len(header) || unicode.IsSpace(header[i])
+	}
+
+	for start := 0; start+len(runes) <= len(header); start++ {
+		end := start + len(runes)
+		if !isBlank(start-1) || !isBlank(end) || string(header[start:end]) != string(runes) {
+			continue
+		}
+		if slices.Contains(found[start:end], true) {
+			continue
+		}
+		for i := start; i < end; i++ {
+			found[i] = true
+		}
+		return start
+	}
+	return -1
+}
@@ -0,0 +1,146 @@
+package textfsmgo
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestParseColumn(t *testing.T) {
+	var columnTestCases = []struct {
+		spec    string
+		exp     *valueColumn
+		exp_err string
+	}{
+		{spec: "12,24", exp: &valueColumn{start: 12, end: 24}},
+		{spec: " 38 , ", exp: &valueColumn{start: 38, end: -1}},
+		{spec: "5", exp: &valueColumn{start: 5, end: -1}},
+		{spec: `"Mac Address"`, exp: &valueColumn{title: "Mac Address"}},
+		{spec: "24,12", exp_err: "the end of the column 24,12 should follow its start"},
+		{spec: "a,b", exp_err: `invalid column a,b, it should be Column\(start,end\) or Column\("title"\)`},
+		{spec: `" "`, exp_err: "empty title of the column"},
+	}
+
+	for _, tc := range columnTestCases {
+		column, err := parseColumn(tc.spec)
+		if tc.exp_err != "" {
+			if err == nil || !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+				t.Errorf("Error parsing '%s': expected error '%s', got %v", tc.spec, tc.exp_err, err)
+			}
+		} else if err != nil || *column != *tc.exp {
+			t.Errorf("Error parsing '%s': expected %+v, got %+v (%v)", tc.spec, tc.exp, column, err)
+		}
+	}
+}
+
+func TestColumnValues(t *testing.T) {
+	var columnTestCases = []struct {
+		description string
+		template    string
+		text        string
+		exp         []map[string]interface{}
+	}{
+		{
+			description: "Test columns by range",
+			template: `Value Required,Type=int,Column(0,6) vlan
+Value Column(6,22) mac
+Value Column(22,31) type
+Value Column(31,) port
+
+Start
+  ^\s*\d+\s${vlan}${mac}${type}${port} -> Record
+`,
+			text: " Vlan Mac Address     Type     Ports\n" +
+				"   10 0011.2233.4455  DYNAMIC  Gi0/1\n" +
+				"   20                 STATIC   CPU\n" +
+				"   30 0011.2233.4466           Gi0/2\n",
+			exp: []map[string]interface{}{
+				{"vlan": int64(10), "mac": "0011.2233.4455", "type": "DYNAMIC", "port": "Gi0/1"},
+				{"vlan": int64(20), "mac": "", "type": "STATIC", "port": "CPU"},
+				{"vlan": int64(30), "mac": "0011.2233.4466", "type": "", "port": "Gi0/2"},
+			},
+		},
+		{
+			description: "Test columns learned from the header",
+			template: `Value Required,Column("Vlan") vlan
+Value Column("Mac Address") mac
+Value Column("Ports") port
+
+Start
+  ^\s*Vlan\s+Mac Address -> Next.Header
+  ^\s*\d+\s ${vlan}${mac}${port} -> Record
+`,
+			text: "  Vlan    Mac Address       Type        Ports\n" +
+				"   100    0011.2233.4455    DYNAMIC     Gi0/1\n" +
+				"   200                      STATIC      CPU\n" +
+				"Vlan Mac Address    Ports\n" +
+				"300  0011.2233.4466 Gi0/2\n",
+			exp: []map[string]interface{}{
+				{"vlan": "100", "mac": "0011.2233.4455", "port": "Gi0/1"},
+				{"vlan": "200", "mac": "", "port": "CPU"},
+				{"vlan": "300", "mac": "0011.2233.4466", "port": "Gi0/2"},
+			},
+		},
+		{
+			description: "Test columns learned from the header with a title inside another one",
+			template: `Value Column("Port") port
+Value Column("Name") name
+
+Start
+  ^Ports\s+Port -> Next.Header
+  ^.${port}${name} -> Record
+`,
+			text: "Ports     Port      Status  Name\n" +
+				"1-4       Gi0/1     up      uplink\n" +
+				"          Gi0/2     down    \n" +
+				"5         Gi0/3             spare\n",
+			exp: []map[string]interface{}{
+				{"port": "Gi0/1", "name": "uplink"},
+				{"port": "Gi0/2", "name": ""},
+				{"port": "Gi0/3", "name": "spare"},
+			},
+		},
+	}
+
+	for _, tc := range columnTestCases {
+		for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+			parser, err := NewTextFSMParserFromString(tc.template, WithSemantics(semantics))
+			if err != nil {
+				t.Fatalf("Error in '%s': unexpected error '%s'", tc.description, err)
+			}
+			checkRecords(t, tc.description, parser, tc.text, tc.exp)
+		}
+	}
+}
+
+func TestColumnErrors(t *testing.T) {
+	var columnTestCases = []struct {
+		description string
+		template    string
+		exp_err     string
+	}{
+		{
+			description: "Test invalid range",
+			template:    "Value Column(4,2) a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 1, column 14: the end of the column 4,2 should follow its start",
+		},
+		{
+			description: "Test Computed column",
+			template:    "Value Computed,Column(1,2) a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 1, column 23: a Column value cannot be Computed",
+		},
+		{
+			description: "Test Header without line operation",
+			template:    "Value Column(\"A\") a\n\nStart\n  ^A -> Header\n  ^${a}\n",
+			exp_err:     ".*Pointer to unknown state 'Header'",
+		},
+	}
+
+	for _, tc := range columnTestCases {
+		_, err := NewTextFSMParserFromString(tc.template)
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+}
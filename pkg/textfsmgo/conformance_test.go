@@ -0,0 +1,195 @@
+package textfsmgo
+
+import (
+	"testing"
+)
+
+// The expected records of the Python semantics are the ones produced by the reference
+// Python TextFSM implementation
+var conformanceTestCases = []struct {
+	description string
+	template    string
+	text        string
+	exp_python  []map[string]interface{}
+	exp_legacy  []map[string]interface{}
+}{
+	{
+		description: "Test filldown carried over a record dropped by Required",
+		template: `Value Filldown chassis (\S+)
+Value Required slot (\d+)
+
+Start
+  ^Chassis ${chassis} -> Record
+  ^Slot ${slot} -> Record
+`,
+		text: "Chassis A\nSlot 1\nSlot 2\nChassis B\nSlot 3\n",
+		exp_python: []map[string]interface{}{
+			{"chassis": "A", "slot": "1"},
+			{"chassis": "A", "slot": "2"},
+			{"chassis": "B", "slot": "3"},
+		},
+		exp_legacy: []map[string]interface{}{
+			{"chassis": "", "slot": "1"},
+			{"chassis": "", "slot": "2"},
+			{"chassis": "", "slot": "3"},
+		},
+	},
+	{
+		description: "Test Clear keeps a filldown value just assigned",
+		template: `Value Filldown a (\S+)
+Value b (\S+)
+
+Start
+  ^a ${a} -> Clear
+  ^b ${b} -> Record
+`,
+		text: "a 1\nb x\n",
+		exp_python: []map[string]interface{}{
+			{"a": "1", "b": "x"},
+			{"a": "1", "b": ""},
+		},
+		exp_legacy: []map[string]interface{}{
+			{"a": "", "b": "x"},
+		},
+	},
+	{
+		description: "Test Clearall resets the filldown values",
+		template: `Value Filldown a (\S+)
+Value b (\S+)
+
+Start
+  ^a ${a}
+  ^b ${b} -> Record
+  ^reset -> Clearall
+`,
+		text: "a 1\nb x\nreset\nb y\n",
+		exp_python: []map[string]interface{}{
+			{"a": "1", "b": "x"},
+			{"a": "", "b": "y"},
+		},
+		exp_legacy: []map[string]interface{}{
+			{"a": "1", "b": "x"},
+			{"a": "1", "b": "y"},
+		},
+	},
+	{
+		description: "Test fillup applied when the value is assigned",
+		template: `Value Fillup vrf (\S+)
+Value Required route (\S+)
+
+Start
+  ^route ${route} -> Record
+  ^vrf ${vrf} -> Record
+`,
+		text: "route r1\nvrf red\nroute r2\n",
+		exp_python: []map[string]interface{}{
+			{"vrf": "red", "route": "r1"},
+			{"vrf": "", "route": "r2"},
+		},
+		exp_legacy: []map[string]interface{}{
+			{"vrf": "", "route": "r1"},
+			{"vrf": "", "route": "r2"},
+		},
+	},
+	{
+		description: "Test EOF record made only of filldown values",
+		template: `Value Filldown a (\S+)
+Value b (\S+)
+
+Start
+  ^a ${a}
+  ^b ${b} -> Record
+`,
+		text: "a 1\nb x\nb y\n",
+		exp_python: []map[string]interface{}{
+			{"a": "1", "b": "x"},
+			{"a": "1", "b": "y"},
+			{"a": "1", "b": ""},
+		},
+		exp_legacy: []map[string]interface{}{
+			{"a": "1", "b": "x"},
+			{"a": "1", "b": "y"},
+		},
+	},
+	{
+		description: "Test no EOF record with an explicit EOF state",
+		template: `Value Filldown a (\S+)
+Value b (\S+)
+
+Start
+  ^a ${a}
+  ^b ${b} -> Record
+
+EOF
+`,
+		text: "a 1\nb x\n",
+		exp_python: []map[string]interface{}{
+			{"a": "1", "b": "x"},
+		},
+		exp_legacy: []map[string]interface{}{
+			{"a": "1", "b": "x"},
+		},
+	},
+	{
+		description: "Test lines split as str.splitlines()",
+		template: `Value b (.+)
+
+Start
+  ^b ${b} -> Record
+`,
+		text: "b x\r\nb y\rb z\n\n",
+		exp_python: []map[string]interface{}{
+			{"b": "x"},
+			{"b": "y"},
+			{"b": "z"},
+		},
+		exp_legacy: []map[string]interface{}{
+			{"b": "x\r"},
+			{"b": "y\rb z"},
+		},
+	},
+}
+
+func TestSemanticsConformance(t *testing.T) {
+	for _, tc := range conformanceTestCases {
+		t.Log(tc.description)
+		parser, err := NewTextFSMParserFromString(tc.template)
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		checkRecords(t, tc.description+" (python)", parser, tc.text, tc.exp_python)
+
+		parser, err = NewTextFSMParserFromString(tc.template, WithSemantics(SEMANTICS_LEGACY))
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		checkRecords(t, tc.description+" (legacy)", parser, tc.text, tc.exp_legacy)
+	}
+}
+
+func TestSplitPythonLines(t *testing.T) {
+	var splitTestCases = []struct {
+		text string
+		exp  []string
+	}{
+		{text: "", exp: []string{}},
+		{text: "a\nb", exp: []string{"a", "b"}},
+		{text: "a\nb\n", exp: []string{"a", "b"}},
+		{text: "a\r\n\r\nb", exp: []string{"a", "", "b"}},
+		{text: "a\rb\vc\fd\x1ce\u2028f\u0085", exp: []string{"a", "b", "c", "d", "e", "f"}},
+	}
+
+	for _, tc := range splitTestCases {
+		got := splitPythonLines(tc.text)
+		if len(got) != len(tc.exp) {
+			t.Errorf("Error splitting %q: expected %q got %q", tc.text, tc.exp, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.exp[i] {
+				t.Errorf("Error splitting %q: expected %q got %q", tc.text, tc.exp, got)
+				break
+			}
+		}
+	}
+}
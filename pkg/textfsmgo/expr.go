@@ -0,0 +1,719 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/exp/slices"
+)
+
+// Name of the option computing a value from an expression, e.g. Computed total = a + b
+const COMPUTED_OPTION = "Computed"
+
+// Name of the function telling if a text matches a regex, e.g. match(name, "^Gi")
+const MATCH_FUNCTION = "match"
+
+// Enum for the kinds of the tokens of an expression
+type exprTokenKind int
+
+const (
+	TOKEN_EOF    = 0
+	TOKEN_NUMBER = 1
+	TOKEN_STRING = 2
+	TOKEN_IDENT  = 3
+	TOKEN_OP     = 4
+)
+
+// The operators of the expressions, the longest first so that they are matched greedily
+var EXPR_OPERATORS = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "(", ")", ","}
+
+// The binary operators of the expressions, from the lowest to the highest precedence
+var EXPR_PRECEDENCE = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// exprToken is a token of an expression
+type exprToken struct {
+	kind exprTokenKind // the kind of the token
+	text string        // the text of the token, unquoted for the strings
+	pos  int           // the offset of the token in the expression
+}
+
+// exprError is an error found parsing an expression
+type exprError struct {
+	pos   int    // the offset in the expression where the error has been found
+	token string // the offending token
+	msg   string // the description of the error
+}
+
+func (e *exprError) Error() string {
+	return e.msg
+}
+
+// exprRef is a reference to a value made by an expression
+type exprRef struct {
+	name string // the name of the value
+	pos  int    // the offset of the reference in the expression
+}
+
+// exprNode is a node of the syntax tree of an expression
+type exprNode interface {
+	// eval(Record) evaluates the node on the values of the given record
+	eval(record Record) (interface{}, error)
+}
+
+// exprFunc is a function which can be called by the expressions
+type exprFunc struct {
+	min_args int                                           // the minimum number of arguments
+	max_args int                                           // the maximum number of arguments, -1 for any
+	nil_safe bool                                          // tells if the function handles unset arguments, otherwise its result is unset
+	call     func(args []interface{}) (interface{}, error) // the implementation of the function
+}
+
+// The functions available in the expressions, besides the transforms
+var EXPR_FUNCTIONS = map[string]exprFunc{
+	"int":      {min_args: 1, max_args: 1, call: exprInt},
+	"float":    {min_args: 1, max_args: 1, call: exprFloat},
+	"str":      {min_args: 1, max_args: 1, nil_safe: true, call: exprStr},
+	"len":      {min_args: 1, max_args: 1, nil_safe: true, call: exprLen},
+	"round":    {min_args: 1, max_args: 2, call: exprRound},
+	"prefix":   {min_args: 2, max_args: 2, call: exprPrefix},
+	"coalesce": {min_args: 1, max_args: -1, nil_safe: true, call: exprCoalesce},
+}
+
+// valueExpr is the expression computing a Computed value, or checked by a Validate rule
+type valueExpr struct {
+	source string    // the expression, as written in the template
+	root   exprNode  // the syntax tree of the expression
+	refs   []exprRef // the values referenced by the expression
+	column int       // the column of the expression in the template line
+}
+
+// tokenizeExpr(string) splits an expression in its tokens. The strings are enclosed in
+// double or single quotes, a backslash escapes the quote and itself, any other escape is
+// kept as it is so that regexes can be written naturally.
+func tokenizeExpr(expr string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			start := i
+			for i < len(expr) && (expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: TOKEN_NUMBER, text: expr[start:i], pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			var text strings.Builder
+			for i++; i < len(expr) && expr[i] != c; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) && (expr[i+1] == c || expr[i+1] == '\\') {
+					i++
+				}
+				text.WriteByte(expr[i])
+			}
+			if i == len(expr) {
+				return nil, &exprError{pos: start, token: expr[start:], msg: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: TOKEN_STRING, text: text.String(), pos: start})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(expr) && (expr[i] == '_' || unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: TOKEN_IDENT, text: expr[start:i], pos: start})
+		default:
+			op := ""
+			for _, candidate := range EXPR_OPERATORS {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, &exprError{pos: i, token: expr[i : i+1], msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, exprToken{kind: TOKEN_OP, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: TOKEN_EOF, pos: len(expr)}), nil
+}
+
+// exprParser parses the tokens of an expression in its syntax tree
+type exprParser struct {
+	tokens []exprToken // the tokens of the expression
+	next   int         // the index of the next token
+	tmpl   *Template   // the template, providing the transforms
+	refs   []exprRef   // the values referenced so far
+}
+
+// parseExpr(string) parses the expression of a Computed value or of a Validate rule. The
+// references to the values are collected, but not checked, as the values can be declared
+// later.
+func (t *Template) parseExpr(source string) (*valueExpr, error) {
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, tmpl: t}
+	root, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != TOKEN_EOF {
+		return nil, &exprError{pos: tok.pos, token: tok.text, msg: fmt.Sprintf("unexpected %s", tok.text)}
+	}
+	return &valueExpr{source: source, root: root, refs: p.refs}, nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.next]
+}
+
+// isOp(string) tells if the next token is the given operator
+func (p *exprParser) isOp(op string) bool {
+	tok := p.peek()
+	return tok.kind == TOKEN_OP && tok.text == op
+}
+
+// expect(string) consumes the given operator, failing if it is not the next token
+func (p *exprParser) expect(op string) error {
+	if !p.isOp(op) {
+		tok := p.peek()
+		found := tok.text
+		if tok.kind == TOKEN_EOF {
+			found = "end of expression"
+		}
+		return &exprError{pos: tok.pos, token: tok.text, msg: fmt.Sprintf("expected %s, found %s", op, found)}
+	}
+	p.next++
+	return nil
+}
+
+// parseBinary(int) parses the binary operations with the given precedence level or higher
+func (p *exprParser) parseBinary(level int) (exprNode, error) {
+	if level == len(EXPR_PRECEDENCE) {
+		return p.parseUnary()
+	}
+
+	x, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.kind == TOKEN_OP && slices.Contains(EXPR_PRECEDENCE[level], tok.text); tok = p.peek() {
+		p.next++
+		y, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{op: tok.text, x: x, y: y}
+	}
+	return x, nil
+}
+
+// parseUnary() parses the negations, then the primary expressions
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("!") || p.isOp("-") {
+		op := p.peek().text
+		p.next++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: op, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary() parses the literals, the references to the values, the calls and the
+// expressions in brackets
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.peek()
+	p.next++
+	switch tok.kind {
+	case TOKEN_NUMBER:
+		if n, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return literalNode{val: n}, nil
+		}
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, &exprError{pos: tok.pos, token: tok.text, msg: fmt.Sprintf("invalid number %s", tok.text)}
+		}
+		return literalNode{val: n}, nil
+	case TOKEN_STRING:
+		return literalNode{val: tok.text}, nil
+	case TOKEN_IDENT:
+		if tok.text == "true" || tok.text == "false" {
+			return literalNode{val: tok.text == "true"}, nil
+		}
+		if p.isOp("(") {
+			return p.parseCall(tok)
+		}
+		p.refs = append(p.refs, exprRef{name: tok.text, pos: tok.pos})
+		return refNode{name: tok.text}, nil
+	case TOKEN_OP:
+		if tok.text == "(" {
+			x, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	case TOKEN_EOF:
+		return nil, &exprError{pos: tok.pos, msg: "unexpected end of expression"}
+	}
+	return nil, &exprError{pos: tok.pos, token: tok.text, msg: fmt.Sprintf("unexpected %s", tok.text)}
+}
+
+// parseCall(exprToken) parses the call of a function or of a transform, whose name is the
+// given token. The arguments of the transforms, after the text, must be literals, so that
+// they are validated with the template.
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	p.next++ // the opening bracket
+	args := []exprNode{}
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next++ // the closing bracket
+
+	if fn, present := EXPR_FUNCTIONS[name.text]; present {
+		if len(args) < fn.min_args || (fn.max_args != -1 && len(args) > fn.max_args) {
+			return nil, &exprError{pos: name.pos, token: name.text,
+				msg: fmt.Sprintf("wrong number of arguments for %s", name.text)}
+		}
+		return callNode{fn: fn, args: args}, nil
+	}
+	if name.text == MATCH_FUNCTION {
+		return p.parseMatch(name, args)
+	}
+
+	if len(args) == 0 {
+		return nil, &exprError{pos: name.pos, token: name.text,
+			msg: fmt.Sprintf("transform %s requires the text to transform", name.text)}
+	}
+	transform_args := []string{}
+	for _, arg := range args[1:] {
+		literal, is_literal := arg.(literalNode)
+		if !is_literal {
+			return nil, &exprError{pos: name.pos, token: name.text,
+				msg: fmt.Sprintf("the arguments of transform %s must be literals", name.text)}
+		}
+		transform_args = append(transform_args, fmt.Sprint(literal.val))
+	}
+	apply, known, err := p.tmpl.lookupTransform(name.text, transform_args)
+	if !known {
+		return nil, &exprError{pos: name.pos, token: name.text, msg: fmt.Sprintf("unknown function %s", name.text)}
+	} else if err != nil {
+		return nil, &exprError{pos: name.pos, token: name.text,
+			msg: fmt.Sprintf("invalid transform %s: %s", name.text, err)}
+	}
+	return callNode{
+		fn: exprFunc{nil_safe: true, call: func(args []interface{}) (interface{}, error) {
+			return apply(exprText(args[0]))
+		}},
+		args: args[:1],
+	}, nil
+}
+
+// parseMatch(exprToken, []exprNode) creates the call of match(text, regex). The regex must
+// be a literal, so that it is compiled once with the regex engine of the template.
+func (p *exprParser) parseMatch(name exprToken, args []exprNode) (exprNode, error) {
+	if len(args) != 2 {
+		return nil, &exprError{pos: name.pos, token: name.text,
+			msg: fmt.Sprintf("wrong number of arguments for %s", name.text)}
+	}
+	literal, is_literal := args[1].(literalNode)
+	if !is_literal {
+		return nil, &exprError{pos: name.pos, token: name.text,
+			msg: fmt.Sprintf("the regex of %s must be a literal", name.text)}
+	}
+	regex, err := p.tmpl.compileRegex(fmt.Sprint(literal.val))
+	if err != nil {
+		return nil, &exprError{pos: name.pos, token: name.text, msg: fmt.Sprintf("invalid regex %s", err)}
+	}
+	return callNode{
+		fn: exprFunc{call: func(args []interface{}) (interface{}, error) {
+			submatch, err := regex.FindStringSubmatch(exprText(args[0]))
+			return submatch != nil, err
+		}},
+		args: args[:1],
+	}, nil
+}
+
+// literalNode is a number, a string or a boolean
+type literalNode struct {
+	val interface{}
+}
+
+func (n literalNode) eval(record Record) (interface{}, error) {
+	return n.val, nil
+}
+
+// refNode is a reference to a value, the values not set are nil
+type refNode struct {
+	name string
+}
+
+func (n refNode) eval(record Record) (interface{}, error) {
+	val := record[n.name]
+	if val == "" {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Slice && rv.Len() == 0 {
+		return nil, nil
+	}
+	return val, nil
+}
+
+// unaryNode is a negation, logical or arithmetic
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (n unaryNode) eval(record Record) (interface{}, error) {
+	x, err := n.x.eval(record)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !exprTruthy(x), nil
+	}
+	if x == nil {
+		return nil, nil
+	}
+	num, err := exprNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	if i, is_int := num.(int64); is_int {
+		return -i, nil
+	}
+	return -num.(float64), nil
+}
+
+// binaryNode is an operation between two expressions. The logical operators evaluate the
+// second expression only when needed, the others are unset when an operand is unset.
+type binaryNode struct {
+	op string
+	x  exprNode
+	y  exprNode
+}
+
+func (n binaryNode) eval(record Record) (interface{}, error) {
+	x, err := n.x.eval(record)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case n.op == "&&" && !exprTruthy(x):
+		return false, nil
+	case n.op == "||" && exprTruthy(x):
+		return true, nil
+	}
+
+	y, err := n.y.eval(record)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&", "||":
+		return exprTruthy(y), nil
+	case "==":
+		return exprEqual(x, y), nil
+	case "!=":
+		return !exprEqual(x, y), nil
+	}
+
+	if x == nil || y == nil {
+		return nil, nil
+	}
+	switch n.op {
+	case "<", "<=", ">", ">=":
+		cmp, err := exprCompare(x, y)
+		if err != nil {
+			return nil, err
+		}
+		return (n.op == "<" && cmp < 0) || (n.op == "<=" && cmp <= 0) ||
+			(n.op == ">" && cmp > 0) || (n.op == ">=" && cmp >= 0), nil
+	case "+":
+		// Two strings are concatenated
+		if xs, is_str := x.(string); is_str {
+			if ys, is_str := y.(string); is_str {
+				return xs + ys, nil
+			}
+		}
+	}
+	return exprArith(n.op, x, y)
+}
+
+// callNode is the call of a function
+type callNode struct {
+	fn   exprFunc
+	args []exprNode
+}
+
+func (n callNode) eval(record Record) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		val, err := arg.eval(record)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil && !n.fn.nil_safe {
+			return nil, nil
+		}
+		args[i] = val
+	}
+	return n.fn.call(args)
+}
+
+// exprTruthy(interface{}) tells if a value is true in a condition: the unset, empty and
+// zero values are false
+func exprTruthy(val interface{}) bool {
+	switch val := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case string:
+		return val != ""
+	case int64:
+		return val != 0
+	case float64:
+		return val != 0
+	}
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Slice {
+		return rv.Len() > 0
+	}
+	return true
+}
+
+// exprNumber(interface{}) converts a value to int64 or float64, the strings are parsed
+func exprNumber(val interface{}) (interface{}, error) {
+	switch val := val.(type) {
+	case int64, float64:
+		return val, nil
+	case string:
+		text := strings.TrimSpace(val)
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+		if n, err := strconv.ParseFloat(text, 64); err == nil {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("'%v' is not a number", val)
+}
+
+// exprFloat64(interface{}) returns a number as float64
+func exprFloat64(num interface{}) float64 {
+	if i, is_int := num.(int64); is_int {
+		return float64(i)
+	}
+	return num.(float64)
+}
+
+// exprArith(string, interface{}, interface{}) applies an arithmetic operator. The
+// operations between integers give an integer, but the division which is always float.
+func exprArith(op string, x interface{}, y interface{}) (interface{}, error) {
+	xn, err := exprNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	yn, err := exprNumber(y)
+	if err != nil {
+		return nil, err
+	}
+
+	xi, x_int := xn.(int64)
+	yi, y_int := yn.(int64)
+	if x_int && y_int && op != "/" {
+		switch op {
+		case "+":
+			return xi + yi, nil
+		case "-":
+			return xi - yi, nil
+		case "*":
+			return xi * yi, nil
+		case "%":
+			if yi == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return xi % yi, nil
+		}
+	}
+
+	xf, yf := exprFloat64(xn), exprFloat64(yn)
+	switch op {
+	case "+":
+		return xf + yf, nil
+	case "-":
+		return xf - yf, nil
+	case "*":
+		return xf * yf, nil
+	case "/", "%":
+		if yf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if op == "%" {
+			return math.Mod(xf, yf), nil
+		}
+		return xf / yf, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+// exprCompare(interface{}, interface{}) compares two values: numerically if both are
+// numbers, alphabetically if both are strings, otherwise as values of the same type
+func exprCompare(x interface{}, y interface{}) (int, error) {
+	xn, x_err := exprNumber(x)
+	yn, y_err := exprNumber(y)
+	if x_err == nil && y_err == nil {
+		return compareValues(exprFloat64(xn), exprFloat64(yn)), nil
+	}
+	if reflect.TypeOf(x) != reflect.TypeOf(y) {
+		return 0, fmt.Errorf("cannot compare '%v' and '%v'", x, y)
+	}
+	return compareValues(x, y), nil
+}
+
+// exprEqual(interface{}, interface{}) tells if two values are equal, numbers are equal if
+// they have the same value, whatever their type
+func exprEqual(x interface{}, y interface{}) bool {
+	xn, x_err := exprNumber(x)
+	yn, y_err := exprNumber(y)
+	if x_err == nil && y_err == nil {
+		return exprFloat64(xn) == exprFloat64(yn)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// exprText(interface{}) returns the text of a value, empty if it is unset
+func exprText(val interface{}) string {
+	if val == nil {
+		return ""
+	}
+	return fmt.Sprint(val)
+}
+
+func exprInt(args []interface{}) (interface{}, error) {
+	if b, is_bool := args[0].(bool); is_bool {
+		if b {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	num, err := exprNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return int64(exprFloat64(num)), nil
+}
+
+func exprFloat(args []interface{}) (interface{}, error) {
+	num, err := exprNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return exprFloat64(num), nil
+}
+
+func exprStr(args []interface{}) (interface{}, error) {
+	return exprText(args[0]), nil
+}
+
+func exprLen(args []interface{}) (interface{}, error) {
+	switch val := args[0].(type) {
+	case nil:
+		return int64(0), nil
+	case string:
+		return int64(len([]rune(val))), nil
+	}
+	if rv := reflect.ValueOf(args[0]); rv.Kind() == reflect.Slice {
+		return int64(rv.Len()), nil
+	}
+	return int64(len(exprText(args[0]))), nil
+}
+
+// exprRound(x[, digits]) rounds a number to the given number of decimal digits
+func exprRound(args []interface{}) (interface{}, error) {
+	num, err := exprNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	digits := int64(0)
+	if len(args) > 1 {
+		d, err := exprNumber(args[1])
+		if err != nil {
+			return nil, err
+		}
+		digits = int64(exprFloat64(d))
+	}
+	scale := math.Pow(10, float64(digits))
+	return math.Round(exprFloat64(num)*scale) / scale, nil
+}
+
+// exprPrefix(ip, mask) returns the network of an address, the mask can be the length of
+// the prefix or a dotted netmask
+func exprPrefix(args []interface{}) (interface{}, error) {
+	addr, is_addr := args[0].(netip.Addr)
+	if !is_addr {
+		var err error
+		if addr, err = netip.ParseAddr(exprText(args[0])); err != nil {
+			return nil, err
+		}
+	}
+
+	bits := -1
+	if num, err := exprNumber(args[1]); err == nil {
+		bits = int(exprFloat64(num))
+	} else if mask, err := netip.ParseAddr(exprText(args[1])); err == nil {
+		bits = 0
+		for _, b := range mask.AsSlice() {
+			ones := 0
+			for ; ones < 8 && b&(0x80>>ones) != 0; ones++ {
+			}
+			bits += ones
+			if ones < 8 {
+				break
+			}
+		}
+	}
+	if bits < 0 {
+		return nil, fmt.Errorf("invalid mask '%v'", args[1])
+	}
+	return addr.Prefix(bits)
+}
+
+func exprCoalesce(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
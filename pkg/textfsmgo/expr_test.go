@@ -0,0 +1,171 @@
+package textfsmgo
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestEvalExpr(t *testing.T) {
+	record := Record{
+		"used": "50", "total": "200", "zero": "0", "slot": "1", "port": "24",
+		"name": "Gi0/1", "empty": "", "unset": nil, "list": []string{"a", "b"},
+		"count": int64(3), "ip": "10.1.2.3",
+	}
+
+	var exprTestCases = []struct {
+		expr    string
+		exp     interface{}
+		exp_err bool
+	}{
+		{expr: `1 + 2 * 3`, exp: int64(7)},
+		{expr: `(1 + 2) * 3`, exp: int64(9)},
+		{expr: `7 % 4 - -1`, exp: int64(4)},
+		{expr: `100 * used / total`, exp: 25.0},
+		{expr: `round(used / 3, 2)`, exp: 16.67},
+		{expr: `used + 1`, exp: int64(51)},
+		{expr: `"Ethernet" + slot + "/" + port`, exp: "Ethernet1/24"},
+		{expr: `'it\'s ' + "a \"test\""`, exp: `it's a "test"`},
+		{expr: `upper(name)`, exp: "GI0/1"},
+		{expr: `expand_interface(name)`, exp: "GigabitEthernet0/1"},
+		{expr: `replace(name, "\d", "x")`, exp: "Gix/x"},
+		{expr: `default(empty, "N/A")`, exp: "N/A"},
+		{expr: `coalesce(unset, empty, name)`, exp: "Gi0/1"},
+		{expr: `prefix(ip, 24)`, exp: netip.MustParsePrefix("10.1.2.0/24")},
+		{expr: `prefix(ip, "255.255.0.0")`, exp: netip.MustParsePrefix("10.1.0.0/16")},
+		{expr: `used > 9 && total >= used`, exp: true},
+		{expr: `"b" < "a" || !true`, exp: false},
+		{expr: `count == 3 && used != "51"`, exp: true},
+		{expr: `len(list) + len(name)`, exp: int64(7)},
+		{expr: `int("4.7") + float(count)`, exp: 7.0},
+		{expr: `str(unset) + "x"`, exp: "x"},
+		{expr: `unset + 1`, exp: nil},
+		{expr: `"a" + empty`, exp: nil},
+		{expr: `unset == empty`, exp: true},
+		{expr: `used / zero`, exp_err: true},
+		{expr: `name * 2`, exp_err: true},
+		{expr: `prefix(ip, "x")`, exp_err: true},
+	}
+
+	tmpl := &Template{}
+	for _, tc := range exprTestCases {
+		expr, err := tmpl.parseExpr(tc.expr)
+		if err != nil {
+			t.Errorf("Error parsing '%s': unexpected error '%s'", tc.expr, err)
+			continue
+		}
+		got, err := expr.root.eval(record)
+		if (err != nil) != tc.exp_err || !reflect.DeepEqual(got, tc.exp) {
+			t.Errorf("Error evaluating '%s': expected %#v (error %t), got %#v (%v)", tc.expr, tc.exp, tc.exp_err, got, err)
+		}
+	}
+}
+
+func TestComputedValues(t *testing.T) {
+	tmpl := `Value Key slot (\d+)
+Value Key port (\d+)
+Value Type=int in_octets (\d+)
+Value speed (\d+)
+Value Computed,Key ifname = "Ethernet" + slot + "/" + port
+Value Computed,Required util = round(100 * in_octets / speed, 1)
+Value Computed loaded = util > 50
+
+Start
+  ^${slot}/${port} ${in_octets} ${speed} -> Record
+`
+	text := "1/1 600 1000\n1/2 5 0\n1/3 10 100\n1/3 0 100\n"
+
+	// The failures leave the values unset, so the records missing a Required computed
+	// value are dropped
+	failures := []*ConversionError{}
+	parser, err := NewTextFSMParserFromString(tmpl, WithKeyMode(KEY_IDENTIFY),
+		WithConversionErrorHandler(func(e *ConversionError) error {
+			failures = append(failures, e)
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test computed values", parser, text, []map[string]interface{}{
+		{"slot": "1", "port": "1", "in_octets": int64(600), "speed": "1000", "ifname": "Ethernet1/1",
+			"util": 60.0, "loaded": true, KEY_FIELD: []string{"1", "1", "Ethernet1/1"}},
+		{"slot": "1", "port": "3", "in_octets": int64(10), "speed": "100", "ifname": "Ethernet1/3",
+			"util": 10.0, "loaded": false, KEY_FIELD: []string{"1", "3", "Ethernet1/3"}},
+		{"slot": "1", "port": "3", "in_octets": int64(0), "speed": "100", "ifname": "Ethernet1/3",
+			"util": 0.0, "loaded": false, KEY_FIELD: []string{"1", "3", "Ethernet1/3"}},
+	})
+	if len(failures) != 1 || failures[0].Value != "util" || failures[0].LineNo != 2 || failures[0].Line != "1/2 5 0" {
+		t.Errorf("Error in 'Test computed values': unexpected failures %+v", failures)
+	}
+
+	// Without a handler the failure stops the parsing
+	parser, err = NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	_, err = parser.ParseTextToDicts(text)
+	var conv_err *ConversionError
+	if !errors.As(err, &conv_err) || conv_err.Expr != "round(100 * in_octets / speed, 1)" {
+		t.Errorf("Error in 'Test computed value failure': unexpected error %+v", err)
+	}
+}
+
+func TestComputedValueErrors(t *testing.T) {
+	var computedTestCases = []struct {
+		description string
+		template    string
+		exp_err     string
+	}{
+		{
+			description: "Test missing expression",
+			template:    "Value Computed total (\\S+)\n\nStart\n  ^x\n",
+			exp_err:     ".*line 1, column 16: the Computed value should be followed by = and the expression",
+		},
+		{
+			description: "Test syntax error",
+			template:    "Value a (\\S+)\nValue Computed total = (a + 1\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 30: invalid expression: expected \\), found end of expression",
+		},
+		{
+			description: "Test unknown function",
+			template:    "Value a (\\S+)\nValue Computed total = sqrt(a)\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 24: invalid expression: unknown function sqrt",
+		},
+		{
+			description: "Test transform with variable arguments",
+			template:    "Value a (\\S+)\nValue Computed total = replace(a, a, \"x\")\n\nStart\n  ^${a}\n",
+			exp_err:     ".*the arguments of transform replace must be literals",
+		},
+		{
+			description: "Test unknown value",
+			template:    "Value a (\\S+)\nValue Computed total = a + b\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 28: unknown value b in the expression of total",
+		},
+		{
+			description: "Test computed value declared later",
+			template:    "Value a (\\S+)\nValue Computed x = y + a\nValue Computed y = a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 20: Computed value y should be declared before x",
+		},
+		{
+			description: "Test computed value in a rule",
+			template:    "Value a (\\S+)\nValue Computed x = a\n\nStart\n  ^${a} ${x}\n",
+			exp_err:     ".*Computed value x cannot be used in the rules",
+		},
+		{
+			description: "Test conflicting option",
+			template:    "Value a (\\S+)\nValue Computed,List x = a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*conflicting option List",
+		},
+	}
+
+	for _, tc := range computedTestCases {
+		_, err := NewTextFSMParserFromString(tc.template)
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package textfsmgo
+
+import "strings"
+
+// Keyword introducing the guard of a rule, after its actions
+const GUARD_KEYWORD = "if"
+
+// Name of the variable holding the previous state of the FSM in the guards
+const PREV_STATE_VAR = "_prev_state"
+
+// splitGuard(string) splits the actions of a rule from its guard, introduced by the if
+// keyword. The keyword is not searched in the quoted message of an Error action. The
+// function returns the actions, the guard and its offset, the guard is empty if missing.
+func splitGuard(actions_str string) (string, string, int) {
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t'
+	}
+
+	quoted := false
+	for i := 0; i < len(actions_str); i++ {
+		if actions_str[i] == '"' {
+			quoted = !quoted
+			continue
+		}
+		end := i + len(GUARD_KEYWORD)
+		if quoted || !strings.HasPrefix(actions_str[i:], GUARD_KEYWORD) ||
+			(i > 0 && !isSpace(actions_str[i-1])) || end == len(actions_str) || !isSpace(actions_str[end]) {
+			continue
+		}
+		guard := strings.TrimLeft(actions_str[end:], " \t")
+		return strings.TrimSpace(actions_str[:i]), guard, len(actions_str) - len(guard)
+	}
+	return actions_str, "", -1
+}
+
+// parseGuard(string, int, int) parses the guard of a rule, found at the given offset of
+// the template line. The guard can refer to the values, the Computed ones excluded as
+// they are not set yet, and to the previous state.
+func (t *Template) parseGuard(guard string, line_no int, offset int) (*valueExpr, *TemplateError) {
+	expr, err := t.parseExpr(guard)
+	if err != nil {
+		expr_err := err.(*exprError)
+		return nil, t.lineError(line_no, offset+expr_err.pos, expr_err.token, "invalid guard: %s", expr_err.msg)
+	}
+	expr.column = t.template_line_indent + offset + 1
+
+	for _, ref := range expr.refs {
+		value, present := t.values[ref.name]
+		switch {
+		case ref.name == PREV_STATE_VAR && present:
+			return nil, t.lineError(line_no, offset+ref.pos, ref.name,
+				"value '%s' is reserved for the previous state in the guards", PREV_STATE_VAR)
+		case ref.name == PREV_STATE_VAR, !present && t.isChildSet(ref.name):
+		case !present:
+			return nil, t.lineError(line_no, offset+ref.pos, ref.name, "unknown value %s in the guard", ref.name)
+		case value.table != "":
+			return nil, t.lineError(line_no, offset+ref.pos, ref.name,
+				"the value %s of table %s cannot be used in the guards", ref.name, value.table)
+		case value.expr != nil:
+			return nil, t.lineError(line_no, offset+ref.pos, ref.name,
+				"%s value %s cannot be used in the guards", COMPUTED_OPTION, ref.name)
+		}
+	}
+	return expr, nil
+}
+
+// guardRecord() returns the record the guards are evaluated on: the record being filled
+// or, when no value has been set yet, the values the next record will carry down
+func (s *Session) guardRecord() Record {
+	if s.current_record != nil {
+		return *s.current_record
+	}
+
+	record := Record{}
+	for name, value := range s.tmpl.values {
+		if value.fill != FILL_DOWN_OP {
+			continue
+		}
+		if s.tmpl.semantics == SEMANTICS_PYTHON {
+			record[name] = s.filldown[name]
+		} else if last := s.tables[""].last_record; last != nil {
+			record[name] = last[name]
+		}
+	}
+	return record
+}
+
+// guardHolds(*valueExpr) evaluates the guard of a rule on the record being filled and on
+// the previous state, a rule without guard always holds
+func (s *Session) guardHolds(guard *valueExpr) (bool, error) {
+	if guard == nil {
+		return true, nil
+	}
+
+	record := s.guardRecord()
+	record[PREV_STATE_VAR] = s.prev_state
+	defer delete(record, PREV_STATE_VAR)
+	val, err := guard.root.eval(record)
+	if err != nil {
+		return false, err
+	}
+	return exprTruthy(val), nil
+}
@@ -0,0 +1,122 @@
+package textfsmgo
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSplitGuard(t *testing.T) {
+	var splitTestCases = []struct {
+		actions    string
+		exp_action string
+		exp_guard  string
+	}{
+		{actions: `Record`, exp_action: `Record`},
+		{actions: `Next.Record Other if a == "x"`, exp_action: `Next.Record Other`, exp_guard: `a == "x"`},
+		{actions: `if !a`, exp_action: ``, exp_guard: `!a`},
+		{actions: `Error "bad if a" if a`, exp_action: `Error "bad if a"`, exp_guard: `a`},
+		{actions: `Modifier`, exp_action: `Modifier`},
+		{actions: `Next if`, exp_action: `Next if`},
+	}
+
+	for _, tc := range splitTestCases {
+		action, guard, offset := splitGuard(tc.actions)
+		if action != tc.exp_action || guard != tc.exp_guard || (guard != "" && tc.actions[offset:] != guard) {
+			t.Errorf("Error splitting '%s': expected '%s' and '%s', got '%s' and '%s' at %d",
+				tc.actions, tc.exp_action, tc.exp_guard, action, guard, offset)
+		}
+	}
+}
+
+func TestGuards(t *testing.T) {
+	var guardTestCases = []struct {
+		description string
+		template    string
+		text        string
+		exp         []map[string]interface{}
+	}{
+		{
+			description: "Test guards on the record",
+			template: `Value Filldown proto (\w+)
+Value vrf (\S+)
+Value Required prefix (\S+)
+
+Start
+  ^Protocol ${proto}
+  ^VRF ${vrf}
+  ^Route ${prefix} -> Record if proto == "ospf" && !vrf
+  ^Route -> Clear
+`,
+			text: "Protocol ospf\nRoute 10.0.0.0/8\nVRF red\nRoute 10.1.0.0/16\nRoute 10.2.0.0/16\n" +
+				"Protocol bgp\nRoute 10.3.0.0/16\n",
+			exp: []map[string]interface{}{
+				{"proto": "ospf", "vrf": "", "prefix": "10.0.0.0/8"},
+				{"proto": "ospf", "vrf": "", "prefix": "10.2.0.0/16"},
+			},
+		},
+		{
+			description: "Test guards on the previous state",
+			template: `Value name (\S+)
+
+Start
+  ^Section -> Section
+  ^${name} -> Record if _prev_state == "Section"
+
+Section
+  ^End -> Start
+`,
+			text: "first\nSection\nsecond\nEnd\nthird\n",
+			exp: []map[string]interface{}{
+				{"name": "third"},
+			},
+		},
+	}
+
+	for _, tc := range guardTestCases {
+		for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+			parser, err := NewTextFSMParserFromString(tc.template, WithSemantics(semantics))
+			if err != nil {
+				t.Fatalf("Error in '%s': unexpected error '%s'", tc.description, err)
+			}
+			checkRecords(t, tc.description, parser, tc.text, tc.exp)
+		}
+	}
+}
+
+func TestGuardErrors(t *testing.T) {
+	var guardTestCases = []struct {
+		description string
+		template    string
+		exp_err     string
+	}{
+		{
+			description: "Test invalid guard",
+			template:    "Value a (\\S+)\n\nStart\n  ^${a} -> Record if a ==\n",
+			exp_err:     ".*line 4, column 26: invalid guard: unexpected end of expression",
+		},
+		{
+			description: "Test unknown value",
+			template:    "Value a (\\S+)\n\nStart\n  ^${a} -> if b\n",
+			exp_err:     ".*line 4, column 15: unknown value b in the guard",
+		},
+		{
+			description: "Test computed value",
+			template:    "Value a (\\S+)\nValue Computed b = a\n\nStart\n  ^${a} -> Record if b\n",
+			exp_err:     ".*line 5, column 22: Computed value b cannot be used in the guards",
+		},
+		{
+			description: "Test reserved value",
+			template:    "Value _prev_state (\\S+)\n\nStart\n  ^${_prev_state} -> if _prev_state\n",
+			exp_err:     ".*value '_prev_state' is reserved for the previous state in the guards",
+		},
+	}
+
+	for _, tc := range guardTestCases {
+		_, err := NewTextFSMParserFromString(tc.template)
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+}
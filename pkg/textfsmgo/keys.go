@@ -0,0 +1,216 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// KeyConflict describes two records with the same key having different values in the
+// same field
+type KeyConflict struct {
+	Key   []string    // the key shared by the two records
+	Field string      // the name of the conflicting field
+	Old   interface{} // the value of the record collected first
+	New   interface{} // the value of the record collected last
+}
+
+func (c KeyConflict) Error() string {
+	return fmt.Sprintf("conflicting values for %s in records with key %v: '%v' and '%v'",
+		c.Field, c.Key, c.Old, c.New)
+}
+
+// keyIndex collects the records by key, keeping the order in which the keys appear
+type keyIndex struct {
+	order   []string          // the keys in order of appearance
+	records map[string]Record // the record collected for each key
+}
+
+// recordKey(string, Record) returns the values of the Key values of the record of the
+// given table, in declaration order
+func (t *Template) recordKey(table string, record Record) []string {
+	return recordValues(record, t.tables[table].keys)
+}
+
+// recordValues(Record, []string) returns the text of the given values of the record
+func recordValues(record Record, names []string) []string {
+	vals := make([]string, len(names))
+	for i, name := range names {
+		if val, is_string := record[name].(string); is_string {
+			vals[i] = val
+		} else {
+			vals[i] = fmt.Sprint(record[name])
+		}
+	}
+	return vals
+}
+
+// recordID(Record, []string) returns a text identifying the given values of the record, the
+// same for two records only if they have the same values. The values can hold any character,
+// a newline too once transformed, so every text is prefixed by its length, and the lists are
+// encoded item by item, so that ["a b"] and ["a", "b"] are told apart.
+func recordID(record Record, names []string) string {
+	var id strings.Builder
+	for _, name := range names {
+		writeIDPart(&id, record[name])
+	}
+	return id.String()
+}
+
+// writeIDPart(*strings.Builder, interface{}) writes the encoding of a value in the identity
+// of a record: the texts as <length>:<text>, the lists as [<items>:<items encoded>, the dicts
+// as {<entries>:<keys and values encoded, by key> and the missing values as -
+func writeIDPart(id *strings.Builder, val interface{}) {
+	switch val := val.(type) {
+	case nil:
+		id.WriteString("-")
+	case string:
+		fmt.Fprintf(id, "%d:%s", len(val), val)
+	case []string:
+		fmt.Fprintf(id, "[%d:", len(val))
+		for _, item := range val {
+			writeIDPart(id, item)
+		}
+	case []interface{}:
+		fmt.Fprintf(id, "[%d:", len(val))
+		for _, item := range val {
+			writeIDPart(id, item)
+		}
+	case []map[string]string:
+		fmt.Fprintf(id, "[%d:", len(val))
+		for _, item := range val {
+			keys := make([]string, 0, len(item))
+			for k := range item {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fmt.Fprintf(id, "{%d:", len(keys))
+			for _, k := range keys {
+				writeIDPart(id, k)
+				writeIDPart(id, item[k])
+			}
+		}
+	default:
+		writeIDPart(id, fmt.Sprint(val))
+	}
+}
+
+// keysEnabled(string) tells if the records of the given table should be identified by
+// their key
+func (t *Template) keysEnabled(table string) bool {
+	return t.key_mode != KEY_IGNORE && len(t.tables[table].keys) > 0
+}
+
+// emitRecord(string, Record) passes a final record of the given table to the emit
+// function, taking care of its key when needed. Records which have to be merged or
+// replaced are held until the end of the parsing.
+func (s *Session) emitRecord(table string, record Record) error {
+	if !s.tmpl.keysEnabled(table) {
+		return s.validateAndEmit(table, record)
+	}
+
+	key := s.tmpl.recordKey(table, record)
+	record[KEY_FIELD] = key
+	if s.tmpl.key_mode == KEY_IDENTIFY {
+		return s.validateAndEmit(table, record)
+	}
+
+	state := s.tables[table]
+	if state.keys == nil {
+		state.keys = &keyIndex{records: map[string]Record{}}
+	}
+
+	id := recordID(record, s.tmpl.tables[table].keys)
+	old, present := state.keys.records[id]
+	switch {
+	case !present:
+		state.keys.order = append(state.keys.order, id)
+		state.keys.records[id] = record
+	case s.tmpl.key_mode == KEY_KEEP_LAST:
+		state.keys.records[id] = record
+	default:
+		return s.mergeRecords(table, old, record, key)
+	}
+	return nil
+}
+
+// mergeRecords(string, Record, Record, []string) merges the values of the new record of the
+// given table into the old one. Empty values are filled, lists and child records are
+// concatenated and different values are reported as conflicts.
+func (s *Session) mergeRecords(table string, old Record, new Record, key []string) error {
+	for _, name := range s.tmpl.tables[table].names {
+		if s.tmpl.values[name].key || s.isEmpty(new[name]) {
+			continue
+		}
+
+		if s.isEmpty(old[name]) {
+			old[name] = new[name]
+			continue
+		}
+
+		switch old_val := old[name].(type) {
+		case []string:
+			old[name] = append(append([]string{}, old_val...), new[name].([]string)...)
+		case []map[string]string:
+			old[name] = append(append([]map[string]string{}, old_val...), new[name].([]map[string]string)...)
+		case []interface{}:
+			old[name] = append(append([]interface{}{}, old_val...), new[name].([]interface{})...)
+		default:
+			if reflect.DeepEqual(old_val, new[name]) {
+				continue
+			}
+
+			conflict := KeyConflict{Key: key, Field: name, Old: old_val, New: new[name]}
+			s.redactConflict(table, &conflict)
+			if s.tmpl.key_conflict_handler == nil {
+				return conflict
+			}
+			if err := s.tmpl.key_conflict_handler(conflict); err != nil {
+				return err
+			}
+			old[name] = new[name]
+		}
+	}
+	if table != "" {
+		return nil
+	}
+	for _, set := range s.tmpl.child_sets {
+		old[set] = append(append([]Record{}, old[set].([]Record)...), new[set].([]Record)...)
+	}
+	return nil
+}
+
+// emitKeyedRecords(string) emits the records of the given table held to be merged or
+// replaced, in order of appearance of their key
+func (s *Session) emitKeyedRecords(table string) error {
+	state := s.tables[table]
+	if state.keys == nil {
+		return nil
+	}
+
+	for _, id := range state.keys.order {
+		if err := s.validateAndEmit(table, state.keys.records[id]); err != nil {
+			return err
+		}
+	}
+	state.keys = nil
+	return nil
+}
+
+// redactConflict(string, *KeyConflict) redacts the secret values of a conflict found merging
+// the records of the given table, in the key too, as the conflict can be reported as an error
+func (s *Session) redactConflict(table string, conflict *KeyConflict) {
+	policy := s.tmpl.redaction
+	if s.tmpl.values[conflict.Field].secret {
+		conflict.Old = policy.redactValue(conflict.Old)
+		conflict.New = policy.redactValue(conflict.New)
+	}
+	// The key is shared with the records, so it is copied
+	conflict.Key = append([]string{}, conflict.Key...)
+	for i, name := range s.tmpl.tables[table].keys {
+		if s.tmpl.values[name].secret {
+			conflict.Key[i] = policy.redact(conflict.Key[i])
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package textfsmgo
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const keyTemplate = `Value Key vrf (\S+)
+Value Key prefix (\S+)
+Value nexthop (\S+)
+Value List tags (\S+)
+
+Start
+  ^${vrf} ${prefix} via ${nexthop} -> Record
+  ^${vrf} ${prefix} tag ${tags} -> Record
+`
+
+const keyText = `red 10.0.0.0/8 via 1.1.1.1
+blue 10.0.0.0/8 via 2.2.2.2
+red 10.0.0.0/8 tag static
+red 10.0.0.0/8 tag internal
+`
+
+var keyTestCases = []struct {
+	description string
+	mode        KeyMode
+	text        string
+	exp_err     string
+	exp_records []map[string]interface{}
+}{
+	{
+		description: "Test keys ignored by default",
+		mode:        KEY_IGNORE,
+		text:        keyText,
+		exp_records: []map[string]interface{}{
+			{"vrf": "red", "prefix": "10.0.0.0/8", "nexthop": "1.1.1.1", "tags": []string{}},
+			{"vrf": "blue", "prefix": "10.0.0.0/8", "nexthop": "2.2.2.2", "tags": []string{}},
+			{"vrf": "red", "prefix": "10.0.0.0/8", "nexthop": "", "tags": []string{"static"}},
+			{"vrf": "red", "prefix": "10.0.0.0/8", "nexthop": "", "tags": []string{"internal"}},
+		},
+	},
+	{
+		description: "Test key identification",
+		mode:        KEY_IDENTIFY,
+		text:        "red 10.0.0.0/8 via 1.1.1.1\n",
+		exp_records: []map[string]interface{}{
+			{"vrf": "red", "prefix": "10.0.0.0/8", "nexthop": "1.1.1.1", "tags": []string{},
+				KEY_FIELD: []string{"red", "10.0.0.0/8"}},
+		},
+	},
+	{
+		description: "Test key merge",
+		mode:        KEY_MERGE,
+		text:        keyText,
+		exp_records: []map[string]interface{}{
+			{"vrf": "red", "prefix": "10.0.0.0/8", "nexthop": "1.1.1.1", "tags": []string{"static", "internal"},
+				KEY_FIELD: []string{"red", "10.0.0.0/8"}},
+			{"vrf": "blue", "prefix": "10.0.0.0/8", "nexthop": "2.2.2.2", "tags": []string{},
+				KEY_FIELD: []string{"blue", "10.0.0.0/8"}},
+		},
+	},
+	{
+		description: "Test key merge conflict",
+		mode:        KEY_MERGE,
+		text:        keyText + "red 10.0.0.0/8 via 3.3.3.3\n",
+		exp_err:     `conflicting values for nexthop in records with key \[red 10.0.0.0/8\]: '1.1.1.1' and '3.3.3.3'`,
+	},
+	{
+		description: "Test keep last",
+		mode:        KEY_KEEP_LAST,
+		text:        keyText,
+		exp_records: []map[string]interface{}{
+			{"vrf": "red", "prefix": "10.0.0.0/8", "nexthop": "", "tags": []string{"internal"},
+				KEY_FIELD: []string{"red", "10.0.0.0/8"}},
+			{"vrf": "blue", "prefix": "10.0.0.0/8", "nexthop": "2.2.2.2", "tags": []string{},
+				KEY_FIELD: []string{"blue", "10.0.0.0/8"}},
+		},
+	},
+}
+
+func TestKeyModes(t *testing.T) {
+	for _, tc := range keyTestCases {
+		t.Log(tc.description)
+		parser, err := NewTextFSMParserFromString(keyTemplate, WithKeyMode(tc.mode))
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+
+		if tc.exp_err == "" {
+			checkRecords(t, tc.description, parser, tc.text, tc.exp_records)
+			continue
+		}
+
+		_, err = parser.ParseTextToDicts(tc.text)
+		var conflict KeyConflict
+		if !errors.As(err, &conflict) || !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': expected conflict '%s', got '%v'", tc.description, tc.exp_err, err)
+		}
+	}
+}
+
+func TestKeyConflictHandler(t *testing.T) {
+	conflicts := []KeyConflict{}
+	parser, err := NewTextFSMParserFromString(keyTemplate,
+		WithKeyMode(KEY_MERGE),
+		WithKeyConflictHandler(func(c KeyConflict) error {
+			conflicts = append(conflicts, c)
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	checkRecords(t, "Test conflict handler", parser, "red 10/8 via 1.1.1.1\nred 10/8 via 3.3.3.3\n",
+		[]map[string]interface{}{
+			{"vrf": "red", "prefix": "10/8", "nexthop": "3.3.3.3", "tags": []string{},
+				KEY_FIELD: []string{"red", "10/8"}},
+		})
+	if len(conflicts) != 1 || conflicts[0].Field != "nexthop" {
+		t.Errorf("Error in 'Test conflict handler': expected a conflict on nexthop, got %+v", conflicts)
+	}
+
+	// The key field cannot be shadowed by a value
+	_, err = NewTextFSMParserFromString("Value Key _key (\\S+)\n\nStart\n  ^${_key}\n", WithKeyMode(KEY_MERGE))
+	if err == nil || !regexp.MustCompile(`reserved for the key`).MatchString(err.Error()) {
+		t.Errorf("Error in 'Test reserved key field': expected error, got '%v'", err)
+	}
+}
+
+func TestKeyIdentity(t *testing.T) {
+	lines := func(text string, args ...string) (string, error) {
+		return strings.ReplaceAll(text, ";", "\n"), nil
+	}
+
+	var keyIdentityTestCases = []struct {
+		description string
+		template    string
+		text        string
+		exp         []map[string]interface{}
+	}{
+		{
+			description: "Test list keys with the same text",
+			template:    "Value Key,List tags (.+)\nValue id (\\d+)\n\nStart\n  ^tag ${tags}\n  ^id ${id} -> Record\n",
+			text:        "tag a b\nid 1\ntag a\ntag b\nid 2\n",
+			exp: []map[string]interface{}{
+				{"tags": []string{"a b"}, "id": "1", KEY_FIELD: []string{"[a b]"}},
+				{"tags": []string{"a", "b"}, "id": "2", KEY_FIELD: []string{"[a b]"}},
+			},
+		},
+		{
+			description: "Test multi-line keys",
+			template: "Value Key,Transform=lines a (\\S+)\nValue Key,Transform=lines b (\\S+)\nValue id (\\d+)\n\n" +
+				"Start\n  ^${a} ${b} ${id} -> Record\n",
+			text: "x;y z 1\nx y;z 2\nx;y z 3\n",
+			exp: []map[string]interface{}{
+				{"a": "x\ny", "b": "z", "id": "3", KEY_FIELD: []string{"x\ny", "z"}},
+				{"a": "x", "b": "y\nz", "id": "2", KEY_FIELD: []string{"x", "y\nz"}},
+			},
+		},
+	}
+
+	for _, tc := range keyIdentityTestCases {
+		parser, err := NewTextFSMParserFromString(tc.template, WithKeyMode(KEY_KEEP_LAST), WithTransform("lines", lines))
+		if err != nil {
+			t.Fatalf("Error in '%s': unexpected error '%s'", tc.description, err)
+		}
+		checkRecords(t, tc.description, parser, tc.text, tc.exp)
+	}
+}
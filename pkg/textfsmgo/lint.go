@@ -0,0 +1,257 @@
+package textfsmgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"golang.org/x/exp/slices"
+)
+
+// Codes identifying the kind of the problems reported by the linter
+const (
+	LINT_INVALID_TEMPLATE  = "invalid-template"
+	LINT_UNREACHABLE_STATE = "unreachable-state"
+	LINT_UNUSED_VALUE      = "unused-value"
+	LINT_SHADOWED_RULE     = "shadowed-rule"
+	LINT_UNSET_REQUIRED    = "unset-required"
+	LINT_FILLUP_LIST       = "fillup-list"
+	LINT_NOOP_CONTINUE     = "noop-continue"
+)
+
+// Description of each kind of problem reported by the linter
+var LINT_CHECKS = map[string]string{
+	LINT_INVALID_TEMPLATE:  "The template cannot be parsed",
+	LINT_UNREACHABLE_STATE: "The state cannot be reached from the Start state",
+	LINT_UNUSED_VALUE:      "The value is never referenced by a rule",
+	LINT_SHADOWED_RULE:     "The rule follows a catch-all rule, so it can never match",
+	LINT_UNSET_REQUIRED:    "The Required value cannot be set, so no record will be collected",
+	LINT_FILLUP_LIST:       "The Fillup option on a List value fills the records only with the first item",
+	LINT_NOOP_CONTINUE:     "The Continue rule neither sets values nor changes the record, so it has no effect",
+}
+
+// Enum for the output formats of the linter
+type LintFormat string
+
+const (
+	LINT_FORMAT_TEXT  = "text"
+	LINT_FORMAT_JSON  = "json"
+	LINT_FORMAT_SARIF = "sarif"
+)
+
+// regex for matching the rules matching any line
+var CATCH_ALL_REGEX = regexp.MustCompile(`^\^(\.\*|\(\.\*\))\$?$`)
+
+// LintTemplate(io.Reader, string, ...ParserOption) parses the template read from the
+// reader and analyses it. All the problems are returned: the errors making the template
+// invalid or, for a valid template, the warnings about its probable mistakes. The error
+// is returned only when the template cannot be read.
+func LintTemplate(template io.Reader, source string, opts ...ParserOption) (TemplateErrors, error) {
+	parser, err := newTextFSMParser(template, source, opts)
+	if err == nil {
+		return parser.template.Lint(), nil
+	}
+
+	tmpl_errs, is_tmpl_err := err.(TemplateErrors)
+	if !is_tmpl_err {
+		return nil, err
+	}
+	for _, tmpl_err := range tmpl_errs {
+		tmpl_err.Code = LINT_INVALID_TEMPLATE
+	}
+	return tmpl_errs, nil
+}
+
+// Lint() analyses the template looking for the problems which do not make it invalid, but
+// are probably mistakes. The warnings are sorted by line.
+func (t *Template) Lint() TemplateErrors {
+	warns := TemplateErrors{}
+	warn := func(code string, line_no int, token string, format string, args ...interface{}) {
+		warns = append(warns, &TemplateError{
+			File:     t.source,
+			Line:     line_no,
+			Token:    token,
+			Severity: SEVERITY_WARNING,
+			Code:     code,
+			Msg:      fmt.Sprintf(format, args...),
+		})
+	}
+
+	// The rules following a catch-all rule are never reached
+	shadowed := map[*TextFSMRule]bool{}
+	for _, state := range t.state_names {
+		rules := t.rules[state]
+		for i := range rules {
+			if rules[i].line_op == CONTINUE_LINE_OP || rules[i].guard != nil || len(rules[i].next_regexes) > 0 ||
+				!CATCH_ALL_REGEX.MatchString(rules[i].regex.String()) {
+				continue
+			}
+			for j := i + 1; j < len(rules); j++ {
+				shadowed[&rules[j]] = true
+				warn(LINT_SHADOWED_RULE, rules[j].line_no, "",
+					"rule of state %s can never match, it follows the catch-all rule in line %d",
+					state, rules[i].line_no)
+			}
+			break
+		}
+	}
+
+	// Visit the states following the transitions of the rules which can match
+	reachable := map[string]bool{START_STATE: true}
+	to_visit := []string{START_STATE}
+	for len(to_visit) > 0 {
+		state := to_visit[0]
+		to_visit = to_visit[1:]
+		for i, rule := range t.rules[state] {
+			if shadowed[&t.rules[state][i]] || rule.new_state == "" || reachable[rule.new_state] {
+				continue
+			}
+			reachable[rule.new_state] = true
+			to_visit = append(to_visit, rule.new_state)
+		}
+	}
+
+	// Collect the values referenced by the rules, and the ones which can actually be set
+	referenced := map[string]bool{}
+	settable := map[string]bool{}
+	for _, state := range t.state_names {
+		if !reachable[state] && !slices.Contains(STOP_STATES, state) {
+			warn(LINT_UNREACHABLE_STATE, t.state_lines[state], state,
+				"state %s cannot be reached from the %s state", state, START_STATE)
+		}
+
+		for i, rule := range t.rules[state] {
+			names := rule.valueNames()
+			for _, name := range names {
+				referenced[name] = true
+				if reachable[state] && !shadowed[&t.rules[state][i]] {
+					settable[name] = true
+				}
+			}
+
+			if rule.line_op == CONTINUE_LINE_OP && len(names) == 0 &&
+				(rule.rec_op == "" || rule.rec_op == NO_RECORD_REC_OP) {
+				warn(LINT_NOOP_CONTINUE, rule.line_no, CONTINUE_LINE_OP,
+					"the Continue rule of state %s has no effect", state)
+			}
+		}
+	}
+
+	for _, name := range t.value_names {
+		value := t.values[name]
+		switch {
+		case value.expr != nil:
+			// The Computed values are set by their expression
+		case !referenced[name]:
+			warn(LINT_UNUSED_VALUE, value.line_no, name, "value %s is never used in the rules", name)
+		case value.required && !settable[name]:
+			warn(LINT_UNSET_REQUIRED, value.line_no, name,
+				"Required value %s is set only by rules which can never match", name)
+		}
+
+		// The aggregated lists fill the records once they are complete
+		if value.fill == FILL_UP_OP && value.rtype != STRING_RECORD && value.aggregate == nil {
+			warn(LINT_FILLUP_LIST, value.line_no, name,
+				"value %s combines Fillup and List, only the first item fills the records", name)
+		}
+	}
+
+	sort.SliceStable(warns, func(i, j int) bool {
+		return warns[i].Line < warns[j].Line
+	})
+	return warns
+}
+
+// valueNames() returns the names of the values set by the rule
+func (r *TextFSMRule) valueNames() []string {
+	names := []string{}
+	for _, regex := range append([]Matcher{r.regex}, r.next_regexes...) {
+		for _, name := range regex.SubexpNames() {
+			if name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// WriteLint(io.Writer, TemplateErrors, LintFormat) writes the problems found by the linter
+// in the given format: one problem per line for text, a list of objects for json, or a
+// SARIF log, to be consumed by code scanning tools
+func WriteLint(w io.Writer, diags TemplateErrors, format LintFormat) error {
+	switch format {
+	case LINT_FORMAT_TEXT:
+		for _, diag := range diags {
+			if _, err := fmt.Fprintf(w, "%s [%s]\n", diag, diag.Code); err != nil {
+				return err
+			}
+		}
+		return nil
+	case LINT_FORMAT_JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diags)
+	case LINT_FORMAT_SARIF:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(sarifLog(diags))
+	}
+	return fmt.Errorf("unknown lint format %s", format)
+}
+
+// sarifLog(TemplateErrors) converts the problems found by the linter to a SARIF 2.1.0 log
+func sarifLog(diags TemplateErrors) map[string]interface{} {
+	codes := make([]string, 0, len(LINT_CHECKS))
+	for code := range LINT_CHECKS {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	rules := []map[string]interface{}{}
+	for _, code := range codes {
+		rules = append(rules, map[string]interface{}{
+			"id":               code,
+			"shortDescription": map[string]string{"text": LINT_CHECKS[code]},
+		})
+	}
+
+	results := []map[string]interface{}{}
+	for _, diag := range diags {
+		location := map[string]interface{}{
+			"artifactLocation": map[string]string{"uri": diag.File},
+		}
+		if diag.Line > 0 {
+			region := map[string]int{"startLine": diag.Line}
+			if diag.Column > 0 {
+				region["startColumn"] = diag.Column
+			}
+			location["region"] = region
+		}
+
+		results = append(results, map[string]interface{}{
+			"ruleId":    diag.Code,
+			"level":     diag.Severity.String(),
+			"message":   map[string]string{"text": diag.Msg},
+			"locations": []map[string]interface{}{{"physicalLocation": location}},
+		})
+	}
+
+	return map[string]interface{}{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": []map[string]interface{}{
+			{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":           "textfsmgo",
+						"informationUri": "https://github.com/claudiolor/textfsmgo",
+						"rules":          rules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+}
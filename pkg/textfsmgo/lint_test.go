@@ -0,0 +1,202 @@
+package textfsmgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type lintFinding struct {
+	code string
+	line int
+}
+
+var lintTestCases = []struct {
+	description string
+	template    string
+	exp         []lintFinding
+}{
+	{
+		description: "Test clean template",
+		template:    testTemplate,
+		exp:         []lintFinding{},
+	},
+	{
+		description: "Test unreachable states",
+		template: `Value name (\S+)
+
+Start
+  ^${name} -> Record
+
+Orphan
+  ^x -> Other
+
+Other
+  ^y -> Start
+`,
+		exp: []lintFinding{{LINT_UNREACHABLE_STATE, 6}, {LINT_UNREACHABLE_STATE, 9}},
+	},
+	{
+		description: "Test unused value and Fillup List",
+		template: `Value name (\S+)
+Value unused (\S+)
+Value Fillup,List peers (\S+)
+
+Start
+  ^${name} ${peers} -> Record
+`,
+		exp: []lintFinding{{LINT_UNUSED_VALUE, 2}, {LINT_FILLUP_LIST, 3}},
+	},
+	{
+		description: "Test rules shadowed by a catch-all",
+		template: `Value name (\S+)
+Value Required other (\S+)
+
+Start
+  ^.* -> Continue
+  ^${name} -> Record
+  ^.*$$
+  ^${other} -> Record
+  ^x -> Next
+`,
+		exp: []lintFinding{{LINT_UNSET_REQUIRED, 2}, {LINT_NOOP_CONTINUE, 5},
+			{LINT_SHADOWED_RULE, 8}, {LINT_SHADOWED_RULE, 9}},
+	},
+	{
+		description: "Test Required value set only in unreachable state",
+		template: `Value Required name (\S+)
+
+Start
+  ^.* -> Next
+  ^go -> Other
+
+Other
+  ^${name} -> Record
+`,
+		exp: []lintFinding{{LINT_UNSET_REQUIRED, 1}, {LINT_SHADOWED_RULE, 5}, {LINT_UNREACHABLE_STATE, 7}},
+	},
+	{
+		description: "Test catch-all rule with a guard",
+		template: `Value Filldown name (\S+)
+
+Start
+  ^.* -> Next if name
+  ^${name} -> Record
+`,
+	},
+	{
+		description: "Test Continue with no effect",
+		template: `Value name (\S+)
+
+Start
+  ^x -> Continue
+  ^y -> Continue.NoRecord
+  ^z -> Continue.Record
+  ^${name} -> Continue
+`,
+		exp: []lintFinding{{LINT_NOOP_CONTINUE, 4}, {LINT_NOOP_CONTINUE, 5}},
+	},
+}
+
+func TestLintTemplate(t *testing.T) {
+	for _, tc := range lintTestCases {
+		t.Log(tc.description)
+		diags, err := LintTemplate(strings.NewReader(tc.template), "test.textfsm")
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+
+		if len(diags) != len(tc.exp) {
+			t.Errorf("Error in '%s': expected %d warnings, got %d: %s", tc.description, len(tc.exp), len(diags), diags)
+			continue
+		}
+		for i, exp := range tc.exp {
+			if diags[i].Code != exp.code || diags[i].Line != exp.line ||
+				diags[i].Severity != SEVERITY_WARNING || diags[i].File != "test.textfsm" {
+				t.Errorf("Error in '%s': expected %s in line %d, got %+v", tc.description, exp.code, exp.line, diags[i])
+			}
+		}
+	}
+}
+
+func TestLintInvalidTemplate(t *testing.T) {
+	diags, err := LintTemplate(strings.NewReader("Value x (\n\nStart\n  ^${y}\n"), "invalid.textfsm")
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	if len(diags) != 2 {
+		t.Fatalf("Error in 'Test invalid template': expected 2 errors, got %s", diags)
+	}
+	for _, diag := range diags {
+		if diag.Code != LINT_INVALID_TEMPLATE || diag.Severity != SEVERITY_ERROR {
+			t.Errorf("Error in 'Test invalid template': expected invalid template error, got %+v", diag)
+		}
+	}
+}
+
+func TestWriteLint(t *testing.T) {
+	diags := TemplateErrors{
+		{File: "a.textfsm", Line: 3, Column: 5, Token: "x", Severity: SEVERITY_ERROR, Code: LINT_INVALID_TEMPLATE, Msg: "bad"},
+		{File: "a.textfsm", Line: 7, Severity: SEVERITY_WARNING, Code: LINT_UNUSED_VALUE, Msg: "unused"},
+	}
+
+	var out bytes.Buffer
+	if err := WriteLint(&out, diags, LINT_FORMAT_TEXT); err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	exp_text := "a.textfsm: error in line 3, column 5: bad [invalid-template]\n" +
+		"a.textfsm: warning in line 7: unused [unused-value]\n"
+	if out.String() != exp_text {
+		t.Errorf("Error in 'Test text format': expected %q, got %q", exp_text, out.String())
+	}
+
+	out.Reset()
+	if err := WriteLint(&out, diags, LINT_FORMAT_JSON); err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	var json_diags []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &json_diags); err != nil || len(json_diags) != 2 ||
+		json_diags[0]["severity"] != "error" || json_diags[1]["code"] != LINT_UNUSED_VALUE {
+		t.Errorf("Error in 'Test json format': unexpected output %s (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := WriteLint(&out, diags, LINT_FORMAT_SARIF); err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	var sarif struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				RuleId    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						Region struct {
+							StartLine   int `json:"startLine"`
+							StartColumn int `json:"startColumn"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &sarif); err != nil {
+		t.Fatalf("Error in 'Test sarif format': invalid json '%s'", err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 2 {
+		t.Fatalf("Error in 'Test sarif format': unexpected output %s", out.String())
+	}
+	res := sarif.Runs[0].Results[0]
+	if res.RuleId != LINT_INVALID_TEMPLATE || res.Level != "error" ||
+		res.Locations[0].PhysicalLocation.Region.StartLine != 3 ||
+		res.Locations[0].PhysicalLocation.Region.StartColumn != 5 {
+		t.Errorf("Error in 'Test sarif format': unexpected result %+v", res)
+	}
+
+	if err := WriteLint(&out, diags, "xml"); err == nil {
+		t.Errorf("Error in 'Test unknown format': expected error, no errors got")
+	}
+}
@@ -25,20 +25,166 @@ const (
 	CLEAR_ALL_REC_OP = "Clearall"
 	RECORD_REC_OP    = "Record"
 	NO_RECORD_REC_OP = "NoRecord"
+	HEADER_REC_OP    = "Header" // the columns of the Column values with a title are learned from the line
 )
 
+// Enum for the operations on the state stack, performed with the change of state
+type StateOperation string
+
+const (
+	CALL_STATE_OP   = "Call"   // the current state is pushed on the stack before the change of state
+	RETURN_STATE_OP = "Return" // the fsm goes back to the state on top of the stack
+	BLOCK_STATE_OP  = "Block"  // as Call, but the fsm goes back when a line is not indented under the entering one
+)
+
+// Default maximum depth of the state stack, so that a recursive Call cannot grow it forever
+const MAX_CALL_DEPTH = 64
+
 // Enum representing the type of value
 type RecordType int
 
 const (
-	STRING_RECORD = 0
-	LIST_RECORD   = 1
+	STRING_RECORD    = 0
+	LIST_RECORD      = 1
+	DICT_LIST_RECORD = 2 // a list whose items are the named groups of the value regex
+)
+
+// Enum for the types a value can be converted to, via the Type option
+type ValueType int
+
+const (
+	TYPE_STRING   = 0 // no conversion
+	TYPE_INT      = 1 // int64
+	TYPE_FLOAT    = 2 // float64
+	TYPE_BOOL     = 3 // bool
+	TYPE_IP       = 4 // netip.Addr
+	TYPE_CIDR     = 5 // netip.Prefix
+	TYPE_MAC      = 6 // net.HardwareAddr
+	TYPE_DURATION = 7 // time.Duration
+	TYPE_TIME     = 8 // time.Time
+)
+
+// Names of the types accepted by the Type option
+var VALUE_TYPES = map[string]ValueType{
+	"string":   TYPE_STRING,
+	"int":      TYPE_INT,
+	"float":    TYPE_FLOAT,
+	"bool":     TYPE_BOOL,
+	"ip":       TYPE_IP,
+	"cidr":     TYPE_CIDR,
+	"mac":      TYPE_MAC,
+	"duration": TYPE_DURATION,
+	"time":     TYPE_TIME,
+}
+
+func (v ValueType) String() string {
+	for name, vtype := range VALUE_TYPES {
+		if vtype == v {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Name of the option setting the type of a value, e.g. Type=int
+const TYPE_OPTION = "Type"
+
+// Name of the option setting the transforms of a value, e.g. Transform=trim|lower
+const TRANSFORM_OPTION = "Transform"
+
+// Enum for the ways the records sharing the same key can be handled
+type KeyMode int
+
+const (
+	KEY_IGNORE    = 0 // the Key option has no effect, as in Python TextFSM
+	KEY_IDENTIFY  = 1 // records get their key in the KEY_FIELD field
+	KEY_MERGE     = 2 // records with the same key are merged into the first one
+	KEY_KEEP_LAST = 3 // only the last record with a given key is kept
+)
+
+// Enum for the runtime semantics of the FSM
+type Semantics int
+
+const (
+	// Filldown, Fillup, Clear, Clearall, Required, EOF and line splitting behave as in
+	// Python TextFSM
+	SEMANTICS_PYTHON = 0
+	// The semantics of the first TextFSMGo releases: filldown values come from the last
+	// collected record and fillup is applied when a record is collected
+	SEMANTICS_LEGACY = 1
 )
 
+// Enum for the ways the values with the Secret option are redacted
+type RedactMode int
+
+const (
+	REDACT_MASK   = 0 // the value is replaced by a fixed mask
+	REDACT_HASH   = 1 // the value is replaced by its keyed hash, so that equal values can be matched
+	REDACT_LAST_N = 2 // the value is replaced by a mask followed by its last characters
+	REDACT_NONE   = 3 // the value is left in clear
+)
+
+// Enum for the kinds of the Validate rules of the templates
+type ValidationKind int
+
+const (
+	VALIDATE_EXPR    = 0 // an expression which must hold for each record
+	VALIDATE_UNIQUE  = 1 // values whose combination must be unique across the records
+	VALIDATE_RECORDS = 2 // a constraint on the number of records
+)
+
+func (k ValidationKind) String() string {
+	switch k {
+	case VALIDATE_UNIQUE:
+		return "unique"
+	case VALIDATE_RECORDS:
+		return "records"
+	}
+	return "expr"
+}
+
+func (k ValidationKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Enum for the severity of the problems found in a template
+type Severity int
+
+const (
+	SEVERITY_ERROR   = 0 // the template cannot be used
+	SEVERITY_WARNING = 1 // the template can be used, but it is probably wrong
+)
+
+func (s Severity) String() string {
+	if s == SEVERITY_WARNING {
+		return "warning"
+	}
+	return "error"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Name of the field holding the key of a record, when identified
+const KEY_FIELD = "_key"
+
 const START_STATE = "Start"
 
+// Names used in the errors to identify templates not coming from a file
+const (
+	READER_SOURCE = "<reader>"
+	STRING_SOURCE = "<string>"
+	BYTES_SOURCE  = "<bytes>"
+)
+
 var LINE_OP = []string{CONTINUE_LINE_OP, NEXT_LINE_OP}
 var WITH_ARGUMENT_OP = []string{"Error"}
 var RECORD_OP = []string{CLEAR_REC_OP, CLEAR_ALL_REC_OP, RECORD_REC_OP, NO_RECORD_REC_OP}
 
+// The record operations which need a line operation, e.g. Next.Header, as alone they would
+// be a change of state
+var QUALIFIED_RECORD_OP = []string{HEADER_REC_OP}
+var STATE_OP = []string{CALL_STATE_OP, RETURN_STATE_OP, BLOCK_STATE_OP}
+
 var STOP_STATES = []string{"End", "EOF"}
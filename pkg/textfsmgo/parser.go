@@ -2,292 +2,207 @@
 package textfsmgo
 
 import (
+	"bytes"
 	"fmt"
-	"regexp"
+	"io"
+	"io/fs"
+	"os"
 	"strings"
+	"sync"
 
 	"github.com/claudiolor/textfsmgo/pkg/utils"
-	"golang.org/x/exp/slices"
 )
 
 // TextFSMValue is a representation of a Value of the template file
 type TextFSMValue struct {
-	fill     FillOption // Tells if the value should be filled if empty
-	key      bool       // Tells if the value contribute to the unique identifier for a row
-	regex    string     // The regex to match the value
-	rtype    RecordType // Tells if the value is a string or a list
-	required bool       // Tells if the value is required or not
+	line_no      int              // The line of the template declaring the value
+	fill         FillOption       // Tells if the value should be filled if empty
+	key          bool             // Tells if the value contribute to the unique identifier for a row
+	regex        string           // The regex to match the value
+	nested_regex Matcher          // The regex extracting the named groups of a list of dicts
+	rtype        RecordType       // Tells if the value is a string, a list or a list of dicts
+	vtype        ValueType        // The type the matched text is converted to
+	transforms   []valueTransform // The transforms applied to the matched text before the conversion
+	aggregate    *ValueOption     // The option combining the matches of the value in a record, if any
+	required     bool             // Tells if the value is required or not
+	secret       bool             // Tells if the value is redacted in the records
+	expr         *valueExpr       // The expression computing the value, for the Computed values
+	child        string           // The child record set the value belongs to, empty if none
+	table        string           // The named table the value belongs to, empty for the default one
+	column       *valueColumn     // The column the text of the value is sliced from, nil if matched by the regex
+}
+
+// detached() tells if the value is collected out of the records of the default table, in
+// the child records or in a named table
+func (v TextFSMValue) detached() bool {
+	return v.child != "" || v.table != ""
+}
+
+// nestedValue(string) given the string matched by a value with named groups, returns a
+// map with the content of each named group
+func (v TextFSMValue) nestedValue(val string) (map[string]string, error) {
+	submatch, err := v.nested_regex.FindStringSubmatch(val)
+	if err != nil {
+		return nil, err
+	}
+	if submatch == nil {
+		// Should not happen as the string has been matched by the same regex,
+		// anyway return all the groups empty
+		submatch = make([]string, v.nested_regex.NumSubexp()+1)
+	}
+
+	return utils.GetNamedGroups(v.nested_regex.SubexpNames(), submatch), nil
 }
 
 // TextFSMRule is a representation of a rule in a textfsm state
 type TextFSMRule struct {
-	regex     *regexp.Regexp  // The regex to match the row
-	line_op   LineOperation   // The line operation to perform when the rule is matched
-	rec_op    RecordOperation // The record operation to perform when the rule is matched
-	new_state string          // The new state to land on when the rule is matched
-	error_str string          // If present when the rule matches return an error
+	line_no      int             // The line of the template declaring the rule
+	regex        Matcher         // The regex to match the row
+	next_regexes []Matcher       // The regexes to match the following rows, for the multi-line rules
+	line_op      LineOperation   // The line operation to perform when the rule is matched
+	rec_op       RecordOperation // The record operation to perform when the rule is matched
+	new_state    string          // The new state to land on when the rule is matched
+	state_op     StateOperation  // The operation on the state stack, if any
+	error_str    string          // If present when the rule matches return an error
+	guard        *valueExpr      // The condition on the record and the previous state, nil if none
+	child        string          // The child record set the record operation applies to, if any
+	table        string          // The named table the record operation applies to, if any
 }
 
 // TextFSM is a representation of the state machine to perform parsing of semi-formatted
-// text
+// text. It is safe for concurrent use: every parse runs in its own Session, taken from a
+// pool to limit the allocations.
 type TextFSM struct {
-	template_parsed_line int                      // last parsed line of the template
-	state                string                   // current state of the fsm
-	fillup_vals          []string                 // list of values with the fillup option enabled
-	required_vals        []string                 // list of the required values of a row
-	records              []map[string]interface{} // all the collected records
-	current_record       *map[string]interface{}  // the record that the fsm is currently filling
-	values               map[string]TextFSMValue  // the collection of values declared in the template
-	rules                map[string][]TextFSMRule // the list of rules to match line against
+	template *Template // the compiled template
+	sessions sync.Pool // the pool of sessions ready to be used
+}
+
+// newTextFSM(*Template) creates a TextFSM parsing text with the given template
+func newTextFSM(tmpl *Template) *TextFSM {
+	new_parser := &TextFSM{template: tmpl}
+	new_parser.sessions.New = func() interface{} {
+		return tmpl.NewSession()
+	}
+	return new_parser
 }
 
 // NewTextFsmParser(string) creates a new TextFSM object. The function gets the path to
 // the template file describing the FSM. An error is returned when the template file is
 // not valid.
 // example: NewTextFSMParser(/path/to/template_file)
-func NewTextFSMParser(template_file string) (*TextFSM, error) {
-	new_parser := TextFSM{
-		values: map[string]TextFSMValue{},
-	}
-
-	// Parse the template file and produce the FSM
-	if err := new_parser.parseTemplateFile(template_file); err != nil {
+func NewTextFSMParser(template_file string, opts ...ParserOption) (*TextFSM, error) {
+	t_file, err := os.Open(template_file)
+	if err != nil {
 		return nil, err
 	}
+	defer t_file.Close()
 
-	// Validate the state machine after the template parsing
-	if err := new_parser.validateFSM(); err != nil {
-		return nil, err
-	}
+	return newTextFSMParser(t_file, template_file, opts)
+}
 
-	return &new_parser, nil
+// NewTextFSMParserFromReader(io.Reader) creates a new TextFSM object reading the template
+// from the given reader. An error is returned when the template is not valid.
+func NewTextFSMParserFromReader(template io.Reader, opts ...ParserOption) (*TextFSM, error) {
+	return newTextFSMParser(template, READER_SOURCE, opts)
 }
 
-// ParseTextToDicts(string) parse the string provided as argument.
-// Returns a map slice of maps with all the retrieved records
-func (t *TextFSM) ParseTextToDicts(text string) ([]map[string]interface{}, error) {
-	// We will first need to reset the state machine
-	t.ResetFSM()
-	lines := strings.Split(text, "\n")
-	for _, line := range lines {
-		if err := t.parseLine(line); err != nil {
-			return nil, err
-		}
+// NewTextFSMParserFromString(string) creates a new TextFSM object from a string containing
+// the template. An error is returned when the template is not valid.
+// example: NewTextFSMParserFromString("Value name (\\S+)\n\nStart\n  ^${name} -> Record")
+func NewTextFSMParserFromString(template string, opts ...ParserOption) (*TextFSM, error) {
+	return newTextFSMParser(strings.NewReader(template), STRING_SOURCE, opts)
+}
 
-		if slices.Contains(STOP_STATES, t.state) {
-			break
-		}
-	}
+// NewTextFSMParserFromBytes([]byte) creates a new TextFSM object from a byte slice
+// containing the template. An error is returned when the template is not valid.
+func NewTextFSMParserFromBytes(template []byte, opts ...ParserOption) (*TextFSM, error) {
+	return newTextFSMParser(bytes.NewReader(template), BYTES_SOURCE, opts)
+}
 
-	if _, eof_overwritten := t.rules["EOF"]; t.state != "End" && !eof_overwritten {
-		t.appendRecord(t.current_record)
+// NewTextFSMParserFromFS(fs.FS, string) creates a new TextFSM object reading the template
+// file with the given name from the provided file system (e.g. an embed.FS). An error is
+// returned when the template file cannot be opened or it is not valid.
+// example: NewTextFSMParserFromFS(templates, "templates/ip_cmd.textfsm")
+func NewTextFSMParserFromFS(fsys fs.FS, name string, opts ...ParserOption) (*TextFSM, error) {
+	t_file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
 	}
+	defer t_file.Close()
 
-	return t.records, nil
+	return newTextFSMParser(t_file, name, opts)
 }
 
-// ResetFSM() resets the FSM
-func (t *TextFSM) ResetFSM() {
-	t.current_record = nil
-	t.state = START_STATE
-	t.records = []map[string]interface{}{}
-}
-
-// isEmpty(interface{}, RecordType) returns a boolean telling if the given interface{}
-// contains an empty value
-func (t TextFSM) isEmpty(val interface{}) bool {
-	switch val := val.(type) {
-	case string:
-		return val == ""
-	case []string:
-		return len(val) == 0
+// newTextFSMParser(io.Reader, string, []ParserOption) builds and validates the FSM
+// described by the template read from the given reader. The source is the name used in
+// the errors to point out where the template comes from.
+func newTextFSMParser(template io.Reader, source string, opts []ParserOption) (*TextFSM, error) {
+	new_parser := newTextFSM(&Template{
+		values:       map[string]TextFSMValue{},
+		regex_engine: RE2Engine{},
+		source:       source,
+	})
+	for _, opt := range opts {
+		opt(new_parser)
+	}
+	if err := new_parser.template.redaction.validate(); err != nil {
+		return nil, err
 	}
-	return false
-}
 
-// generateEmptyRecord() returns a map of a new record, filling the fields with all the
-// "filldown" values if present, otherwise they are left blank
-func (t *TextFSM) generateEmptyRecord() map[string]interface{} {
-	new_record := map[string]interface{}{}
-	for k, val_prop := range t.values {
-		if val_prop.rtype == STRING_RECORD {
-			new_val := ""
-			if val_prop.fill == FILL_DOWN_OP {
-				n_records := len(t.records)
-				if n_records > 0 {
-					new_val = t.records[n_records-1][k].(string)
-				}
-			}
-			new_record[k] = new_val
-		} else {
-			// If the record is a list
-			new_val := []string{}
-			if val_prop.fill == FILL_DOWN_OP {
-				n_records := len(t.records)
-				if n_records > 0 {
-					new_val = t.records[n_records-1][k].([]string)
-				}
-			}
-			new_record[k] = new_val
+	// Parse the template and produce the FSM, the state machine is validated even if
+	// the parsing failed, so that all the errors are reported at once
+	errs := TemplateErrors{}
+	if err := new_parser.template.parseTemplate(template); err != nil {
+		tmpl_errs, is_tmpl_err := err.(TemplateErrors)
+		if !is_tmpl_err {
+			return nil, fmt.Errorf("%s: %w", source, err)
 		}
+		errs = append(errs, tmpl_errs...)
 	}
-	return new_record
-}
 
-// setValue(string, string, *map[string]interface{}) set the given value on the key of the
-// map provided as argument. If the pointer to the map is null, a new one is created from
-// scratch. The function returns back a pointer to the map where the value as been added
-func (t *TextFSM) setValue(key string, val string, current_record *map[string]interface{}) *map[string]interface{} {
-	if current_record == nil {
-		new_record := t.generateEmptyRecord()
-		current_record = &new_record
+	if err := new_parser.template.validateFSM(); err != nil {
+		errs = append(errs, err.(TemplateErrors)...)
 	}
 
-	rtype := t.values[key].rtype
-	if rtype == STRING_RECORD {
-		(*current_record)[key] = val
-	} else {
-		// If the record is a list
-		(*current_record)[key] = append((*current_record)[key].([]string), val)
+	if len(errs) > 0 {
+		errs.setFile(source)
+		return nil, errs
 	}
-	return current_record
+	return new_parser, nil
 }
 
-// clearRecord(*map[string]interface{}) implements the Clear operation, so it clear all the
-// values stored so far, filldown excluded
-func (t *TextFSM) clearRecord(current_record *map[string]interface{}) {
-	*current_record = t.generateEmptyRecord()
+// NewTextFSMParserFromTemplate(*Template) creates a new TextFSM object sharing an
+// already compiled template
+func NewTextFSMParserFromTemplate(tmpl *Template) *TextFSM {
+	return newTextFSM(tmpl)
 }
 
-// clearAllRecord(*map[string]interface{}) implements the ClearAll operation, so it
-// clears all the values stored so far
-func (t *TextFSM) clearAllRecord(current_record *map[string]interface{}) {
-	if current_record != nil {
-		for k, v := range *current_record {
-			switch v.(type) {
-			case string:
-				(*current_record)[k] = ""
-			case []string:
-				(*current_record)[k] = []string{}
-			}
-		}
-	}
+// Template() returns the compiled template of the parser
+func (t *TextFSM) Template() *Template {
+	return t.template
 }
 
-// appendRecord(*map[string]interface{}) append the record filled so far to the list of
-// records. It applies the fillup if any. The function returns a pointer to the new
-// current value.
-func (t *TextFSM) appendRecord(current_record *map[string]interface{}) *map[string]interface{} {
-	if current_record != nil {
-		// Do not store if required records are not present
-		for _, req_key := range t.required_vals {
-			if t.isEmpty((*current_record)[req_key]) {
-				return nil
-			}
-		}
-
-		last_index := len(t.records) - 1
-		// Add the new record
-		t.records = append(t.records, *current_record)
-
-		// Fill up values if any
-		if last_index != -1 {
-			for _, fup_key := range t.fillup_vals {
-				if t.isEmpty((*current_record)[fup_key]) {
-					continue
-				}
-
-				fill_val := (*current_record)[fup_key]
-				for i := last_index; i >= 0; i-- {
-					if !t.isEmpty(t.records[i][fup_key]) {
-						break
-					}
-					t.records[i][fup_key] = fill_val
-				}
-			}
-		}
-	}
-	return nil
+// ParseTextToDicts(string) parse the string provided as argument.
+// Returns a map slice of maps with all the retrieved records, along with the
+// ValidationErrors of the ones failing the Validate rules. It can be called
+// concurrently by multiple goroutines.
+func (t *TextFSM) ParseTextToDicts(text string) ([]map[string]interface{}, error) {
+	session := t.sessions.Get().(*Session)
+	defer t.sessions.Put(session)
+	return session.ParseTextToDicts(text)
 }
 
-// parseLine(string) parses the line provided as argument checking if it matches one of
-// the rules defined in the template, if so it fills the values in the current record
-// and perform the related actions
-func (t *TextFSM) parseLine(line string) error {
-	for _, rule := range t.rules[t.state] {
-		submatch := rule.regex.FindStringSubmatch(line)
-
-		// Check if the next rule matches
-		if submatch == nil {
-			continue
-		}
-
-		detected_vars := utils.GetRegexpNamedGroups(rule.regex, submatch)
-
-		// Check if we need to raise an error
-		if rule.error_str != "" {
-			return fmt.Errorf("state error raised by FSM: %s in %s", rule.error_str, line)
-		}
-
-		// Store the variables, if any
-		for key, val := range detected_vars {
-			t.current_record = t.setValue(key, val, t.current_record)
-		}
-
-		// Handle the record options
-		switch rule.rec_op {
-		case RECORD_REC_OP:
-			t.current_record = t.appendRecord(t.current_record)
-		case CLEAR_REC_OP:
-			t.clearRecord(t.current_record)
-		case CLEAR_ALL_REC_OP:
-			t.clearAllRecord(t.current_record)
-		}
-
-		// Handle the line options
-		if rule.line_op != CONTINUE_LINE_OP {
-			// Apply the new state if needed
-			if rule.new_state != "" {
-				t.state = rule.new_state
-			}
-			break // parse the next line
-		}
-
-	}
-	return nil
+// ParseTextToTables(string) parse the string provided as argument.
+// Returns the records of every table, the default one and the ones declared with the
+// Table option. It can be called concurrently by multiple goroutines.
+func (t *TextFSM) ParseTextToTables(text string) (map[string][]Record, error) {
+	session := t.sessions.Get().(*Session)
+	defer t.sessions.Put(session)
+	return session.ParseTextToTables(text)
 }
 
-// validateFSM() checks if the defined FSM is valid and returns an error if this is the case
-func (t TextFSM) validateFSM() error {
-	// Check that the Start state is always present
-	if _, present := t.rules[START_STATE]; !present {
-		return fmt.Errorf("invalid FSM: '%s' should always be present", START_STATE)
-	}
-
-	// Check that End and EOF state are always empty
-	// when explicitly declared
-	for _, s := range STOP_STATES {
-		if rules, present := t.rules[s]; present && len(rules) > 0 {
-			return fmt.Errorf("invalid FSM: State '%s', if declared, should be empty", s)
-		}
-	}
-
-	// Check that the pointers to states are all valid
-	for state, rules := range t.rules {
-		for _, r := range rules {
-			// End or EOF are implicit states, no need to check if they have been declared
-			if r.new_state == "End" || r.new_state == "EOF" || r.new_state == "" {
-				continue
-			}
-
-			// Check if the new state is valid
-			if _, present := t.rules[r.new_state]; !present {
-				return fmt.Errorf("invalid FSM: Pointer to unknown state '%s' in rules of state %s",
-					r.new_state,
-					state)
-			}
-		}
-	}
-
-	return nil
-}
+// ResetFSM() resets the FSM.
+//
+// Deprecated: every call to ParseTextToDicts() runs in a fresh Session, so there is no
+// state to reset anymore.
+func (t *TextFSM) ResetFSM() {}
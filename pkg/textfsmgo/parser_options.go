@@ -0,0 +1,125 @@
+package textfsmgo
+
+import "io"
+
+// ParserOption customizes the behaviour of a TextFSM parser, it can be passed to any of
+// the NewTextFSMParser constructors
+type ParserOption func(*TextFSM)
+
+// WithRegexEngine(RegexEngine) sets the engine compiling the regular expressions of the
+// template, by default RE2Engine is used.
+// example: NewTextFSMParser(path, WithRegexEngine(PythonRegexEngine{}))
+func WithRegexEngine(engine RegexEngine) ParserOption {
+	return func(t *TextFSM) {
+		t.template.regex_engine = engine
+	}
+}
+
+// WithSemantics(Semantics) sets the runtime semantics of the FSM, by default the one of
+// Python TextFSM is used.
+// example: NewTextFSMParser(path, WithSemantics(SEMANTICS_LEGACY))
+func WithSemantics(semantics Semantics) ParserOption {
+	return func(t *TextFSM) {
+		t.template.semantics = semantics
+	}
+}
+
+// WithKeyMode(KeyMode) sets how the values with the Key option are used. By default they
+// have no effect, otherwise every record gets the list of its key values in the KEY_FIELD
+// field and, depending on the mode, the records sharing the same key are merged or
+// replaced by the last one. Merging and replacing require all the records to be parsed
+// before any is returned, also when streaming.
+// example: NewTextFSMParser(path, WithKeyMode(KEY_MERGE))
+func WithKeyMode(mode KeyMode) ParserOption {
+	return func(t *TextFSM) {
+		t.template.key_mode = mode
+	}
+}
+
+// WithKeyConflictHandler(func(KeyConflict) error) sets the function called when two
+// records with the same key have different values in the same field while merging. If the
+// handler returns nil the value of the last record is kept, otherwise the parsing stops
+// with the returned error. Without a handler the conflict itself is returned as error.
+func WithKeyConflictHandler(handler func(KeyConflict) error) ParserOption {
+	return func(t *TextFSM) {
+		t.template.key_conflict_handler = handler
+	}
+}
+
+// WithTimeLayouts(...string) sets the layouts, in the format of the time package, tried in
+// order to convert the values of type time. By default TIME_LAYOUTS are used.
+// example: NewTextFSMParser(path, WithTimeLayouts("02/01/2006 15:04"))
+func WithTimeLayouts(layouts ...string) ParserOption {
+	return func(t *TextFSM) {
+		t.template.time_layouts = layouts
+	}
+}
+
+// WithConversionErrorHandler(func(*ConversionError) error) sets the function called when
+// the text matched by a value cannot be converted to its type. If the handler returns nil
+// the text is ignored and the value left as it is, otherwise the parsing stops with the
+// returned error. Without a handler the ConversionError itself is returned as error.
+func WithConversionErrorHandler(handler func(*ConversionError) error) ParserOption {
+	return func(t *TextFSM) {
+		t.template.conversion_handler = handler
+	}
+}
+
+// WithValidationHandler(func(*ValidationError) error) sets the function called when a
+// record, or the whole table, fails a Validate rule of the template. If the handler returns
+// nil the record is kept and the parsing continues, otherwise the parsing stops with the
+// returned error. Without a handler the failures are collected, and returned together as
+// ValidationErrors once all the records have been parsed.
+func WithValidationHandler(handler func(*ValidationError) error) ParserOption {
+	return func(t *TextFSM) {
+		t.template.validation_handler = handler
+	}
+}
+
+// WithStrictValidation() makes the first failure of a Validate rule stop the parsing with
+// the ValidationError, when no handler is set
+func WithStrictValidation() ParserOption {
+	return func(t *TextFSM) {
+		t.template.strict_validation = true
+	}
+}
+
+// WithMaxCallDepth(int) sets the maximum depth of the state stack, grown by the Call
+// actions: calling a state beyond it stops the parsing with an error. By default
+// MAX_CALL_DEPTH is used.
+func WithMaxCallDepth(depth int) ParserOption {
+	return func(t *TextFSM) {
+		t.template.max_call_depth = depth
+	}
+}
+
+// WithTrace(io.Writer) makes the parser write a line for each rule matched, with the state
+// and the depth of the state stack. The lines of concurrent parses are interleaved.
+// example: NewTextFSMParser(path, WithTrace(os.Stderr))
+func WithTrace(w io.Writer) ParserOption {
+	return func(t *TextFSM) {
+		t.template.trace = w
+	}
+}
+
+// WithTransform(string, TransformFunc) registers a custom transform, which the values can
+// use in their Transform option. A custom transform hides the builtin one with the same name.
+// example: NewTextFSMParser(path, WithTransform("strip_domain", stripDomain))
+func WithTransform(name string, fn TransformFunc) ParserOption {
+	return func(t *TextFSM) {
+		if t.template.transforms == nil {
+			t.template.transforms = map[string]TransformFunc{}
+		}
+		t.template.transforms[name] = fn
+	}
+}
+
+// WithRedaction(RedactionPolicy) sets how the values with the Secret option are redacted
+// before the records are collected, by default they are replaced by DEFAULT_REDACT_MASK.
+// The constructors fail when the policy cannot be applied, e.g. a keyed hash without a key.
+// example: NewTextFSMParser(path, WithRedaction(RedactionPolicy{Mode: REDACT_HASH, Key: key}))
+func WithRedaction(policy RedactionPolicy) ParserOption {
+	return func(t *TextFSM) {
+		t.template.redaction = policy
+	}
+}
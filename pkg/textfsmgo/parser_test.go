@@ -0,0 +1,257 @@
+package textfsmgo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testTemplate = `Value ifname (\S+)
+Value List addresses (\S+)
+
+Start
+  ^\d+: -> Continue.Record
+  ^\d+: ${ifname}:
+  ^\s+inet ${addresses}
+`
+
+const testText = `1: lo:
+    inet 127.0.0.1
+2: eth0:
+    inet 10.0.0.1
+    inet 10.0.0.2
+`
+
+var testExpRecords = []map[string]interface{}{
+	{"ifname": "lo", "addresses": []string{"127.0.0.1"}},
+	{"ifname": "eth0", "addresses": []string{"10.0.0.1", "10.0.0.2"}},
+}
+
+// checkRecords parses the text with the given parser and compares the result with the
+// expected records
+func checkRecords(t *testing.T, description string, parser *TextFSM, text string, exp []map[string]interface{}) {
+	t.Helper()
+	res, err := parser.ParseTextToDicts(text)
+	if err != nil {
+		t.Errorf("Error in '%s': unexpected error '%s'", description, err)
+		return
+	}
+
+	if !reflect.DeepEqual(exp, res) {
+		t.Errorf("Error in '%s': expected %+v got %+v", description, exp, res)
+	}
+}
+
+func TestNewTextFSMParserSources(t *testing.T) {
+	tmpl_path := filepath.Join(t.TempDir(), "test.textfsm")
+	if err := os.WriteFile(tmpl_path, []byte(testTemplate), 0644); err != nil {
+		t.Fatalf("Cannot write the template file: %s", err)
+	}
+	fsys := fstest.MapFS{
+		"templates/test.textfsm": {Data: []byte(testTemplate)},
+	}
+
+	var constructorTestCases = []struct {
+		description string
+		constructor func() (*TextFSM, error)
+	}{
+		{
+			description: "Test template from file",
+			constructor: func() (*TextFSM, error) { return NewTextFSMParser(tmpl_path) },
+		},
+		{
+			description: "Test template from reader",
+			constructor: func() (*TextFSM, error) {
+				return NewTextFSMParserFromReader(strings.NewReader(testTemplate))
+			},
+		},
+		{
+			description: "Test template from string",
+			constructor: func() (*TextFSM, error) { return NewTextFSMParserFromString(testTemplate) },
+		},
+		{
+			description: "Test template from bytes",
+			constructor: func() (*TextFSM, error) { return NewTextFSMParserFromBytes([]byte(testTemplate)) },
+		},
+		{
+			description: "Test template from fs",
+			constructor: func() (*TextFSM, error) { return NewTextFSMParserFromFS(fsys, "templates/test.textfsm") },
+		},
+	}
+
+	for _, tc := range constructorTestCases {
+		t.Log(tc.description)
+		parser, err := tc.constructor()
+		if err != nil {
+			t.Errorf("Error in '%s': unexpected error '%s'", tc.description, err)
+			continue
+		}
+		checkRecords(t, tc.description, parser, testText, testExpRecords)
+	}
+}
+
+func TestNewTextFSMParserErrorSource(t *testing.T) {
+	invalid_tmpl := "Value name (\\S+)\n\nStart\n  ^${unknown} -> Record\n"
+	fsys := fstest.MapFS{
+		"invalid.textfsm": {Data: []byte(invalid_tmpl)},
+	}
+
+	var errorTestCases = []struct {
+		description string
+		constructor func() (*TextFSM, error)
+		exp_err     string
+	}{
+		{
+			description: "Test error from string",
+			constructor: func() (*TextFSM, error) { return NewTextFSMParserFromString(invalid_tmpl) },
+			exp_err:     `^<string>: error in line 4, column 4: unknown variable.*`,
+		},
+		{
+			description: "Test error from reader",
+			constructor: func() (*TextFSM, error) {
+				return NewTextFSMParserFromReader(strings.NewReader(invalid_tmpl))
+			},
+			exp_err: `^<reader>: error in line 4.*`,
+		},
+		{
+			description: "Test error from fs",
+			constructor: func() (*TextFSM, error) { return NewTextFSMParserFromFS(fsys, "invalid.textfsm") },
+			exp_err:     `^invalid.textfsm: error in line 4.*`,
+		},
+		{
+			description: "Test invalid FSM from bytes",
+			constructor: func() (*TextFSM, error) { return NewTextFSMParserFromBytes([]byte("Value name (.*)\n\nOther\n")) },
+			exp_err:     `^<bytes>: invalid FSM.*`,
+		},
+		{
+			description: "Test missing file in fs",
+			constructor: func() (*TextFSM, error) { return NewTextFSMParserFromFS(fsys, "missing.textfsm") },
+			exp_err:     `.*missing.textfsm.*`,
+		},
+	}
+
+	for _, tc := range errorTestCases {
+		t.Log(tc.description)
+		_, err := tc.constructor()
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+			continue
+		}
+
+		if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'",
+				tc.description, err, tc.exp_err)
+		}
+	}
+}
+
+func TestParseNestedValues(t *testing.T) {
+	tmpl := `Value Filldown,Required vrf (\S+)
+Value List neighbors ((?P<ip>\d+\.\d+\.\d+\.\d+)\s+(?P<as>\d+))
+Value Fillup,List peers ((?P<name>\w+))
+
+Start
+  ^VRF -> Continue.Record
+  ^VRF ${vrf}
+  ^\s+${neighbors}
+  ^\s+peer ${peers}
+`
+	text := `VRF red
+  10.0.0.1 65001
+  10.0.0.2 65002
+VRF blue
+  10.0.1.1 65101
+  peer alpha
+  peer beta
+`
+	parser, err := NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	checkRecords(t, "Test nested values", parser, text, []map[string]interface{}{
+		{
+			"vrf": "red",
+			"neighbors": []map[string]string{
+				{"ip": "10.0.0.1", "as": "65001"},
+				{"ip": "10.0.0.2", "as": "65002"},
+			},
+			// The fillup happens when the first peer is assigned, as in Python
+			"peers": []map[string]string{{"name": "alpha"}},
+		},
+		{
+			"vrf": "blue",
+			"neighbors": []map[string]string{
+				{"ip": "10.0.1.1", "as": "65101"},
+			},
+			"peers": []map[string]string{{"name": "alpha"}, {"name": "beta"}},
+		},
+	})
+}
+
+func TestPythonRegexEngine(t *testing.T) {
+	tmpl := `Value ifname (\S+(?<!\.\d))
+Value state (up|down)
+
+Start
+  ^${ifname}\s+${state}\Z -> Record
+`
+	text := "Gi0/1   up\nGi0/1.1 up\nGi0/2   down\n"
+
+	if _, err := NewTextFSMParserFromString(tmpl); err == nil {
+		t.Errorf("Error in 'Test RE2 engine': expected invalid regex error, no errors got")
+	}
+
+	parser, err := NewTextFSMParserFromString(tmpl, WithRegexEngine(PythonRegexEngine{}))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test Python engine", parser, text, []map[string]interface{}{
+		{"ifname": "Gi0/1", "state": "up"},
+		{"ifname": "Gi0/2", "state": "down"},
+	})
+
+	// A pathological line must not hang the parsing
+	parser, err = NewTextFSMParserFromString(
+		"Value val ((a+)+)\n\nStart\n  ^${val}$ -> Record\n",
+		WithRegexEngine(PythonRegexEngine{MaxSteps: 10000}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	if _, err := parser.ParseTextToDicts(strings.Repeat("a", 40) + "b"); err == nil ||
+		!strings.Contains(err.Error(), "step limit exceeded") {
+		t.Errorf("Error in 'Test step limit': expected step limit error, got '%v'", err)
+	}
+}
+
+func TestParsePythonTemplateSyntax(t *testing.T) {
+	// Template written as the ones of ntc-templates
+	tmpl := "Value Required\tINTERFACE  (\\S+)\n" +
+		"Value STATUS (up|down|administratively down)\n\n" +
+		"Start\n" +
+		"  ^Interface\\s+Status -> Next\n" +
+		"  ^$INTERFACE\\s+${STATUS}\\s*$$ -> Record\n" +
+		"  ^\\s*$$\n" +
+		"  ^. -> Error \"unexpected line\"\n"
+	parser, err := NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	checkRecords(t, "Test Python template syntax", parser,
+		"Interface    Status\nGi0/1        up\n\nGi0/2        administratively down  \n",
+		[]map[string]interface{}{
+			{"INTERFACE": "Gi0/1", "STATUS": "up"},
+			{"INTERFACE": "Gi0/2", "STATUS": "administratively down"},
+		})
+
+	_, err = parser.ParseTextToDicts("Interface    Status\nGi0/1 unknown\n")
+	if err == nil || err.Error() != "state error raised by FSM: unexpected line in Gi0/1 unknown" {
+		t.Errorf("Error in 'Test Error message': expected error without quotes, got '%v'", err)
+	}
+}
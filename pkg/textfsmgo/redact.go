@@ -0,0 +1,255 @@
+package textfsmgo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Name of the option marking a value as sensitive, so that it is redacted in the records
+const SECRET_OPTION = "Secret"
+
+// Text replacing the secret values when the policy has no mask
+const DEFAULT_REDACT_MASK = "********"
+
+// Prefix of the keyed hashes replacing the secret values
+const REDACT_HASH_PREFIX = "hmac-sha256:"
+
+// RedactionPolicy tells how the values with the Secret option are masked before the records
+// are collected. The zero policy replaces them with DEFAULT_REDACT_MASK.
+type RedactionPolicy struct {
+	Mode RedactMode // how the values are redacted
+	Mask string     // the text replacing the values, DEFAULT_REDACT_MASK if empty
+	Key  []byte     // the key of the HMAC-SHA256 of the values, for REDACT_HASH
+	Keep int        // the number of trailing characters left in clear, for REDACT_LAST_N
+}
+
+// validate() checks that the policy can be applied
+func (p RedactionPolicy) validate() error {
+	switch p.Mode {
+	case REDACT_MASK, REDACT_NONE:
+		return nil
+	case REDACT_HASH:
+		if len(p.Key) == 0 {
+			return fmt.Errorf("the keyed hash redaction requires a key")
+		}
+		return nil
+	case REDACT_LAST_N:
+		if p.Keep <= 0 {
+			return fmt.Errorf("the last-N redaction requires a positive number of characters to keep")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown redaction mode %d", p.Mode)
+}
+
+// redact(string) returns the redacted version of the given text, an empty text is kept
+// empty as it reveals nothing
+func (p RedactionPolicy) redact(text string) string {
+	if text == "" || p.Mode == REDACT_NONE {
+		return text
+	}
+
+	mask := p.Mask
+	if mask == "" {
+		mask = DEFAULT_REDACT_MASK
+	}
+	switch p.Mode {
+	case REDACT_HASH:
+		mac := hmac.New(sha256.New, p.Key)
+		mac.Write([]byte(text))
+		return REDACT_HASH_PREFIX + hex.EncodeToString(mac.Sum(nil))
+	case REDACT_LAST_N:
+		// The mask has a fixed length, so that the length of the value is not revealed
+		runes := []rune(text)
+		if len(runes) <= p.Keep {
+			return mask
+		}
+		return mask + string(runes[len(runes)-p.Keep:])
+	}
+	return mask
+}
+
+// redactValue(interface{}) redacts the content of a value of any type: the items of the
+// lists are redacted one by one, the typed values are redacted as text
+func (p RedactionPolicy) redactValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case nil:
+		return nil
+	case string:
+		return p.redact(val)
+	case []string:
+		redacted := make([]string, len(val))
+		for i, item := range val {
+			redacted[i] = p.redact(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(val))
+		for i, item := range val {
+			redacted[i] = p.redactValue(item)
+		}
+		return redacted
+	case []map[string]string:
+		redacted := make([]map[string]string, len(val))
+		for i, item := range val {
+			redacted[i] = map[string]string{}
+			for k, v := range item {
+				redacted[i][k] = p.redact(v)
+			}
+		}
+		return redacted
+	}
+	return p.redact(fmt.Sprint(val))
+}
+
+// redactTexts(string, []string) returns the text with every occurrence of the given secret
+// texts redacted. The longest secrets are replaced first, so that a secret containing
+// another one is redacted as a whole.
+func (p RedactionPolicy) redactTexts(text string, secrets []string) string {
+	if p.Mode == REDACT_NONE || len(secrets) == 0 {
+		return text
+	}
+
+	sorted := append([]string{}, secrets...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, secret := range sorted {
+		if secret != "" {
+			pairs = append(pairs, secret, p.redact(secret))
+		}
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// secretTexts(interface{}) returns the texts held by a secret value of a record, the items
+// of the lists one by one and the typed values as text
+func secretTexts(val interface{}) []string {
+	switch val := val.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{val}
+	case []string:
+		return val
+	case []interface{}:
+		texts := make([]string, len(val))
+		for i, item := range val {
+			texts[i] = fmt.Sprint(item)
+		}
+		return texts
+	case []map[string]string:
+		texts := []string{}
+		for _, item := range val {
+			for _, v := range item {
+				texts = append(texts, v)
+			}
+		}
+		return texts
+	}
+	return []string{fmt.Sprint(val)}
+}
+
+// errorSecrets(Record) returns the secret texts which cannot appear in the errors: the ones
+// matched by the rules in the current line and the secret values of the given record, if any
+func (s *Session) errorSecrets(record Record) []string {
+	if record == nil {
+		return s.line_secrets
+	}
+	secrets := append([]string{}, s.line_secrets...)
+	for _, table := range s.tmpl.tables {
+		for _, name := range table.secret {
+			secrets = append(secrets, secretTexts(record[name])...)
+		}
+	}
+	return secrets
+}
+
+// redactText(string, Record) returns the text, e.g. an input line, with the secret texts
+// of the current line and of the given record redacted, so that it can go in an error
+func (s *Session) redactText(text string, record Record) string {
+	return s.tmpl.redaction.redactTexts(text, s.errorSecrets(record))
+}
+
+// redactError(error, Record) returns the error with the secret texts of the current line and
+// of the given record redacted in its message. The error is returned as it is when it does
+// not reveal any secret, so that it can still be unwrapped.
+func (s *Session) redactError(err error, record Record) error {
+	msg := err.Error()
+	if redacted := s.redactText(msg, record); redacted != msg {
+		return errors.New(redacted)
+	}
+	return err
+}
+
+// redactConversionError(*ConversionError, Record) redacts the secret texts in the fields of
+// a conversion error about the current line, the text of a secret value as a whole
+func (s *Session) redactConversionError(conv_err *ConversionError, record Record) {
+	secrets := s.errorSecrets(record)
+	if value := s.tmpl.values[conv_err.Value]; value.secret && conv_err.Text != "" {
+		// The text may differ from the one matched, once transformed
+		secrets = append(append([]string{}, secrets...), conv_err.Text)
+	}
+	policy := s.tmpl.redaction
+	conv_err.Text = policy.redactTexts(conv_err.Text, secrets)
+	conv_err.Line = policy.redactTexts(conv_err.Line, secrets)
+	if conv_err.Err != nil {
+		if msg := conv_err.Err.Error(); policy.redactTexts(msg, secrets) != msg {
+			conv_err.Err = errors.New(policy.redactTexts(msg, secrets))
+		}
+	}
+}
+
+// redactRecord(string, Record) returns the record of the given table with its secret values
+// redacted, in the key too. The record is copied, so that the values carried to the next
+// records are still in clear.
+func (s *Session) redactRecord(table string, record Record) Record {
+	secret_vals := s.tmpl.tables[table].secret
+	if len(secret_vals) == 0 || s.tmpl.redaction.Mode == REDACT_NONE {
+		return record
+	}
+
+	redacted := make(Record, len(record))
+	for k, v := range record {
+		redacted[k] = v
+	}
+	for _, name := range secret_vals {
+		redacted[name] = s.tmpl.redaction.redactValue(record[name])
+	}
+	if key, present := record[KEY_FIELD].([]string); present {
+		redacted_key := append([]string{}, key...)
+		for i, name := range s.tmpl.tables[table].keys {
+			if s.tmpl.values[name].secret {
+				redacted_key[i] = s.tmpl.redaction.redact(key[i])
+			}
+		}
+		redacted[KEY_FIELD] = redacted_key
+	}
+	return redacted
+}
+
+// propagateSecrets() marks as secret the Computed values whose expression refers to a secret
+// value, directly or through another Computed value, so that they do not reveal it in clear.
+// The Computed values refer only to the ones declared before them, so a single pass is enough.
+func (t *Template) propagateSecrets() {
+	for _, name := range t.value_names {
+		value := t.values[name]
+		if value.expr == nil || value.secret {
+			continue
+		}
+		for _, ref := range value.expr.refs {
+			if target, present := t.values[ref.name]; present && target.secret && target.child == "" {
+				value.secret = true
+				t.values[name] = value
+				t.tables[value.table].secret = append(t.tables[value.table].secret, name)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package textfsmgo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const secretTemplate = `Value Filldown,Secret community (\S+)
+Value host (\S+)
+Value Secret,List keys (\S+)
+Value Fillup,Secret psk (\S+)
+
+Start
+  ^snmp community ${community}
+  ^key ${keys}
+  ^psk ${psk}
+  ^host ${host} -> Record
+`
+
+const secretText = `snmp community s3cr3t
+key abcdef123
+key 98765
+host r1
+host r2
+psk hunter2
+`
+
+func TestRedactionPolicies(t *testing.T) {
+	var redactTestCases = []struct {
+		description string
+		policy      RedactionPolicy
+		text        string
+		exp         string
+	}{
+		{description: "Test default mask", policy: RedactionPolicy{}, text: "s3cr3t", exp: DEFAULT_REDACT_MASK},
+		{description: "Test custom mask", policy: RedactionPolicy{Mask: "<hidden>"}, text: "s3cr3t", exp: "<hidden>"},
+		{description: "Test empty text", policy: RedactionPolicy{}, text: "", exp: ""},
+		{description: "Test last N", policy: RedactionPolicy{Mode: REDACT_LAST_N, Keep: 3}, text: "abcdef123", exp: DEFAULT_REDACT_MASK + "123"},
+		{description: "Test last N of short text", policy: RedactionPolicy{Mode: REDACT_LAST_N, Keep: 3}, text: "ab", exp: DEFAULT_REDACT_MASK},
+		{description: "Test no redaction", policy: RedactionPolicy{Mode: REDACT_NONE}, text: "s3cr3t", exp: "s3cr3t"},
+		{
+			description: "Test keyed hash",
+			policy:      RedactionPolicy{Mode: REDACT_HASH, Key: []byte("key")},
+			text:        "s3cr3t",
+		},
+	}
+
+	for _, tc := range redactTestCases {
+		got := tc.policy.redact(tc.text)
+		if tc.policy.Mode == REDACT_HASH {
+			// The hash is stable and depends on the key
+			other := RedactionPolicy{Mode: REDACT_HASH, Key: []byte("other")}
+			if !strings.HasPrefix(got, REDACT_HASH_PREFIX) || got != tc.policy.redact(tc.text) ||
+				got == other.redact(tc.text) || len(got) != len(REDACT_HASH_PREFIX)+64 {
+				t.Errorf("Error in '%s': unexpected hash '%s'", tc.description, got)
+			}
+			continue
+		}
+		if got != tc.exp {
+			t.Errorf("Error in '%s': expected '%s', got '%s'", tc.description, tc.exp, got)
+		}
+	}
+}
+
+func TestSecretValues(t *testing.T) {
+	for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+		parser, err := NewTextFSMParserFromString(secretTemplate, WithSemantics(semantics),
+			WithRedaction(RedactionPolicy{Mode: REDACT_LAST_N, Keep: 2}))
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		res, err := parser.ParseTextToDicts(secretText)
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+
+		// The filldown value is carried in clear and redacted in every record, the fillup
+		// value is redacted also in the records it fills
+		for i, host := range []string{"r1", "r2"} {
+			record := res[i]
+			if record["host"] != host || record["community"] != "********3t" || record["psk"] != "********r2" {
+				t.Errorf("Error in 'Test secret values': unexpected record %+v", record)
+			}
+		}
+		keys := res[0]["keys"].([]string)
+		if len(keys) != 2 || keys[0] != "********23" || keys[1] != "********65" {
+			t.Errorf("Error in 'Test secret values': unexpected keys %+v", keys)
+		}
+		for _, record := range res {
+			for _, val := range record {
+				if strings.Contains(strings.Join(toStrings(val), " "), "s3cr3t") ||
+					strings.Contains(strings.Join(toStrings(val), " "), "hunter2") {
+					t.Errorf("Error in 'Test secret values': secret leaked in %+v", record)
+				}
+			}
+		}
+	}
+}
+
+func TestRedactionPolicyErrors(t *testing.T) {
+	for _, policy := range []RedactionPolicy{{Mode: REDACT_HASH}, {Mode: REDACT_LAST_N}, {Mode: 42}} {
+		if _, err := NewTextFSMParserFromString(secretTemplate, WithRedaction(policy)); err == nil {
+			t.Errorf("Error in 'Test invalid policy %+v': expected error, no errors got", policy)
+		}
+	}
+}
+
+// toStrings(interface{}) returns the strings held by a value of a record
+func toStrings(val interface{}) []string {
+	switch val := val.(type) {
+	case string:
+		return []string{val}
+	case []string:
+		return val
+	}
+	return nil
+}
+
+func TestComputedSecretValues(t *testing.T) {
+	tmpl := `Value Secret pw (\S+)
+Value user (\S+)
+Value Computed copy = pw
+Value Computed shout = upper(pw)
+Value Computed size = len(shout)
+Value Computed name = upper(user)
+
+Start
+  ^user ${user} password ${pw} -> Record
+`
+	parser, err := NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	res, err := parser.ParseTextToDicts("user admin password hunter2\n")
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	exp := map[string]interface{}{
+		"pw": DEFAULT_REDACT_MASK, "user": "admin", "copy": DEFAULT_REDACT_MASK,
+		"shout": DEFAULT_REDACT_MASK, "size": DEFAULT_REDACT_MASK, "name": "ADMIN",
+	}
+	if len(res) != 1 || !reflect.DeepEqual(res[0], exp) {
+		t.Errorf("Error in 'Test computed secret values': expected %+v got %+v", exp, res)
+	}
+}
+
+func TestSecretKeys(t *testing.T) {
+	tmpl := `Value Key,Secret psk (\S+)
+Value List peer (\S+)
+
+Start
+  ^${psk} ${peer} -> Record
+`
+	// The records are merged by the keys in clear, the key is redacted in the result
+	parser, err := NewTextFSMParserFromString(tmpl, WithKeyMode(KEY_MERGE))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test secret keys", parser, "hunter2 r1\ns3cr3t r2\nhunter2 r3\n", []map[string]interface{}{
+		{KEY_FIELD: []string{DEFAULT_REDACT_MASK}, "psk": DEFAULT_REDACT_MASK, "peer": []string{"r1", "r3"}},
+		{KEY_FIELD: []string{DEFAULT_REDACT_MASK}, "psk": DEFAULT_REDACT_MASK, "peer": []string{"r2"}},
+	})
+}
+
+func TestSecretErrors(t *testing.T) {
+	var errorTestCases = []struct {
+		description string
+		template    string
+		text        string
+		opts        []ParserOption
+	}{
+		{
+			description: "Test conversion error",
+			template:    "Value Secret,Type=int pw (\\S+)\n\nStart\n  ^pw ${pw} -> Record\n",
+			text:        "pw hunter2\n",
+		},
+		{
+			description: "Test conversion error of a transformed text",
+			template:    "Value Secret,Transform=lower,Type=int pw (\\S+)\n\nStart\n  ^pw ${pw} -> Record\n",
+			text:        "pw HUNTER2\n",
+		},
+		{
+			description: "Test Computed value error",
+			template:    "Value Secret pw (\\S+)\nValue Computed n = int(pw)\n\nStart\n  ^pw ${pw} -> Record\n",
+			text:        "pw hunter2\n",
+		},
+		{
+			description: "Test Error action",
+			template:    "Value Secret pw (\\S+)\n\nStart\n  ^pw ${pw} -> Error \"weak password\"\n",
+			text:        "pw hunter2\n",
+		},
+		{
+			description: "Test validation error",
+			template:    "Value Secret pw (\\S+)\nValidate Unique pw\n\nStart\n  ^pw ${pw} -> Record\n",
+			text:        "pw hunter2\npw hunter2\n",
+		},
+		{
+			description: "Test key conflict",
+			template:    "Value Key,Secret user (\\S+)\nValue Secret pw (\\S+)\n\nStart\n  ^${user} ${pw} -> Record\n",
+			text:        "hunter2 s3cr3t\nhunter2 HUNTER2\n",
+			opts:        []ParserOption{WithKeyMode(KEY_MERGE)},
+		},
+	}
+
+	for _, tc := range errorTestCases {
+		parser, err := NewTextFSMParserFromString(tc.template, tc.opts...)
+		if err != nil {
+			t.Fatalf("Error in '%s': unexpected error '%s'", tc.description, err)
+		}
+		_, err = parser.ParseTextToDicts(tc.text)
+		if err == nil {
+			t.Errorf("Error in '%s': expected error, no errors got", tc.description)
+			continue
+		}
+
+		// The error, and the fields of the typed errors, reveal no secret
+		texts := []string{err.Error()}
+		var conv_err *ConversionError
+		if errors.As(err, &conv_err) {
+			texts = append(texts, conv_err.Text, conv_err.Line, conv_err.Err.Error())
+		}
+		var val_err *ValidationError
+		if errors.As(err, &val_err) {
+			texts = append(texts, val_err.Line, val_err.Msg, fmt.Sprint(val_err.Record))
+		}
+		var conflict KeyConflict
+		if errors.As(err, &conflict) {
+			texts = append(texts, fmt.Sprint(conflict.Key, conflict.Old, conflict.New))
+		}
+		for _, text := range texts {
+			if strings.Contains(strings.ToLower(text), "hunter2") || strings.Contains(text, "s3cr3t") {
+				t.Errorf("Error in '%s': secret leaked in '%s'", tc.description, text)
+			}
+		}
+		if !strings.Contains(err.Error(), DEFAULT_REDACT_MASK) {
+			t.Errorf("Error in '%s': the secret is not redacted in '%s'", tc.description, err)
+		}
+	}
+}
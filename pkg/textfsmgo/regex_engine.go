@@ -0,0 +1,65 @@
+package textfsmgo
+
+import (
+	"regexp"
+
+	"github.com/claudiolor/textfsmgo/pkg/pyregex"
+)
+
+// Matcher is a compiled regular expression used to match the values and the rules of a
+// template
+type Matcher interface {
+	// FindStringSubmatch(string) returns the text of the leftmost match followed by the
+	// text of each group, nil if there is no match. An error is returned when the
+	// match cannot be completed.
+	FindStringSubmatch(s string) ([]string, error)
+	// SubexpNames() returns the names of the groups, the first one being the whole match
+	SubexpNames() []string
+	// NumSubexp() returns the number of groups
+	NumSubexp() int
+	// String() returns the source of the regular expression
+	String() string
+}
+
+// RegexEngine compiles the regular expressions of a template into Matchers
+type RegexEngine interface {
+	Compile(expr string) (Matcher, error)
+}
+
+// RE2Engine is the default engine, based on the regexp package of the standard library.
+// It guarantees linear matching time, but it does not support the Perl/Python specific
+// syntax such as lookarounds and backreferences.
+type RE2Engine struct{}
+
+// re2Matcher adapts a *regexp.Regexp to the Matcher interface
+type re2Matcher struct {
+	*regexp.Regexp
+}
+
+func (m re2Matcher) FindStringSubmatch(s string) ([]string, error) {
+	return m.Regexp.FindStringSubmatch(s), nil
+}
+
+func (RE2Engine) Compile(expr string) (Matcher, error) {
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return re2Matcher{regex}, nil
+}
+
+// PythonRegexEngine is a backtracking engine supporting the syntax of the Python re
+// module, so that templates written for Python TextFSM can be used unchanged. A match
+// fails with an error when it takes more than MaxSteps steps, zero means
+// pyregex.DEFAULT_MAX_STEPS.
+type PythonRegexEngine struct {
+	MaxSteps int
+}
+
+func (e PythonRegexEngine) Compile(expr string) (Matcher, error) {
+	regex, err := pyregex.CompileWithLimit(expr, e.MaxSteps)
+	if err != nil {
+		return nil, err
+	}
+	return regex, nil
+}
@@ -0,0 +1,745 @@
+package textfsmgo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/claudiolor/textfsmgo/pkg/utils"
+	"golang.org/x/exp/slices"
+)
+
+// Record is a row extracted by the FSM, it maps the name of each value to its content
+type Record = map[string]interface{}
+
+// Session holds the state of a single parse run against a Template. Sessions are cheap
+// to create, but they are not safe for concurrent use: each goroutine should use its own.
+type Session struct {
+	tmpl           *Template              // the template driving the fsm
+	state          string                 // current state of the fsm
+	prev_state     string                 // the state the fsm was in before the current one
+	stack          []stackFrame           // the states to go back to, saved by Call and Block
+	line_no        int                    // the number of the last parsed line of the text
+	line           string                 // the last parsed line of the text
+	lookahead      []string               // the lines provided but not yet parsed, available to the multi-line rules
+	line_secrets   []string               // the secret texts matched in the line being parsed, redacted in the errors
+	filldown       Record                 // the last value assigned to each filldown value
+	current_record *Record                // the record that the fsm is currently filling
+	table_current  map[string]*Record     // the record being filled for each named table
+	tables         map[string]*tableState // the records collected for each table, the default one has an empty name
+	columns        map[string][2]int      // the columns learned from the last header, for the Column values with a title
+	option_ctxs    []OptionContext        // the contexts of the hooks of the value options
+	failures       ValidationErrors       // the failures of the Validate rules, collected when there is no handler
+}
+
+// NewSession() creates a new parsing session for the template
+func (t *Template) NewSession() *Session {
+	new_session := &Session{tmpl: t, table_current: map[string]*Record{}, tables: map[string]*tableState{"": {}}}
+	for _, table := range t.table_names {
+		state := &tableState{}
+		state.emit = state.collect
+		new_session.tables[table] = state
+	}
+	new_session.option_ctxs = new_session.newOptionContexts()
+	new_session.Reset()
+	return new_session
+}
+
+// ParseTextToDicts(string) parse the string provided as argument.
+// Returns a map slice of maps with all the retrieved records. When some records fail the
+// Validate rules, the records are returned anyway, along with the ValidationErrors.
+func (s *Session) ParseTextToDicts(text string) ([]map[string]interface{}, error) {
+	records := []Record{}
+	s.begin(func(r Record) error {
+		records = append(records, r)
+		return nil
+	})
+	// Do not keep a reference to the returned records, the session could be reused
+	defer s.Reset()
+
+	if err := s.parseText(text); err != nil {
+		if validationResults(err) {
+			return records, err
+		}
+		return nil, err
+	}
+	return records, nil
+}
+
+// parseText(string) parses the whole text provided as argument, then completes the
+// parsing passing the pending records to the emit function
+func (s *Session) parseText(text string) error {
+	if s.tmpl.semantics == SEMANTICS_PYTHON {
+		for _, line := range splitPythonLines(text) {
+			if stop, err := s.feedLine(line); err != nil {
+				return err
+			} else if stop {
+				break
+			}
+		}
+	} else {
+		for stop := false; !stop; {
+			line := text
+			if i := strings.IndexByte(text, '\n'); i != -1 {
+				line, text = text[:i], text[i+1:]
+			} else {
+				stop = true
+			}
+
+			done, err := s.feedLine(line)
+			if err != nil {
+				return err
+			}
+			stop = stop || done
+		}
+	}
+
+	return s.finish()
+}
+
+// Reset() resets the state of the session, so that a new text can be parsed
+func (s *Session) Reset() {
+	s.current_record = nil
+	for _, table := range s.tmpl.table_names {
+		delete(s.table_current, table)
+	}
+	for _, state := range s.tables {
+		state.reset()
+	}
+	s.columns = nil
+	s.failures = nil
+	s.line_no = 0
+	s.line = ""
+	s.lookahead = s.lookahead[:0]
+	s.line_secrets = s.line_secrets[:0]
+	s.filldown = Record{}
+	s.state = START_STATE
+	s.prev_state = ""
+	s.stack = s.stack[:0]
+	s.tables[""].emit = nil
+	for i := range s.option_ctxs {
+		s.option_ctxs[i].store = nil
+	}
+}
+
+// begin(func(Record) error) resets the session and prepares it to parse a new text,
+// the final records are passed to the given function
+func (s *Session) begin(emit func(Record) error) {
+	s.Reset()
+	s.tables[""].emit = emit
+}
+
+// feedLine(string) adds the next line of the text to the lookahead buffer, then parses
+// the lines followed by enough lines for the longest multi-line rule. The boolean is true
+// when the FSM reached a stop state, so no more lines should be provided.
+func (s *Session) feedLine(line string) (bool, error) {
+	s.lookahead = append(s.lookahead, line)
+	for len(s.lookahead) > 0 && len(s.lookahead) >= s.tmpl.window {
+		if stop, err := s.nextLine(); err != nil || stop {
+			return stop, err
+		}
+	}
+	return false, nil
+}
+
+// nextLine() parses the first line of the lookahead buffer, the following ones are
+// available to the multi-line rules, which consume them. The boolean is true when the FSM
+// reached a stop state.
+func (s *Session) nextLine() (bool, error) {
+	s.line_no++
+	s.line = s.lookahead[0]
+	consumed, err := s.parseLine(s.line)
+	if err != nil {
+		return false, err
+	}
+	s.line_no += consumed
+	s.line = s.lookahead[consumed]
+
+	// Shift the buffer instead of slicing it, so that its array is reused
+	n := copy(s.lookahead, s.lookahead[1+consumed:])
+	s.lookahead = s.lookahead[:n]
+	return slices.Contains(STOP_STATES, s.state), nil
+}
+
+// finish() completes the parsing once all the lines have been provided, emitting the
+// records still pending
+func (s *Session) finish() error {
+	// The lines left in the lookahead buffer can only match the rules as long as they are
+	for len(s.lookahead) > 0 && !slices.Contains(STOP_STATES, s.state) {
+		if _, err := s.nextLine(); err != nil {
+			return err
+		}
+	}
+
+	if _, eof_overwritten := s.tmpl.rules["EOF"]; s.state != "End" && !eof_overwritten {
+		if err := s.appendRecord("", s.current_record); err != nil {
+			return err
+		}
+		s.current_record = nil
+		// The filldown values alone do not make a record of a named table at the end of
+		// the text, only the tables with some value set since their last record
+		for _, table := range s.tmpl.table_names {
+			if s.table_current[table] != nil {
+				if err := s.appendRecord(table, s.table_current[table]); err != nil {
+					return err
+				}
+				s.table_current[table] = nil
+			}
+		}
+	}
+
+	// No more records will come, so the pending ones cannot change anymore
+	for _, table := range append([]string{""}, s.tmpl.table_names...) {
+		if err := s.emitRecords(table, len(s.tables[table].records)); err != nil {
+			return err
+		}
+		if err := s.emitKeyedRecords(table); err != nil {
+			return err
+		}
+	}
+	if err := s.validateTable(); err != nil {
+		return err
+	}
+	// The records failing the rules have all been emitted, the failures come along with them
+	if len(s.failures) > 0 {
+		return s.failures
+	}
+	return nil
+}
+
+// emitRecords(string, int) passes the first n pending records of the table to the emit
+// function
+func (s *Session) emitRecords(table string, n int) error {
+	state := s.tables[table]
+	for i := 0; i < n; i++ {
+		if err := s.emitRecord(table, state.records[i]); err != nil {
+			return err
+		}
+		state.records[i] = nil
+	}
+	state.records = state.records[n:]
+	return nil
+}
+
+// emitSettledRecords(string) emits the pending records of the table which cannot be
+// changed by a fillup anymore. A record is settled when all of its fillup values are set,
+// as the fillup stops at the first non empty value. The records are emitted in order, so
+// a record waits for the previous ones to be settled.
+func (s *Session) emitSettledRecords(table string) error {
+	settled := 0
+	for _, record := range s.tables[table].records {
+		for _, fup_key := range s.tmpl.tables[table].fillup {
+			if s.isEmpty(record[fup_key]) {
+				return s.emitRecords(table, settled)
+			}
+		}
+		settled++
+	}
+	return s.emitRecords(table, settled)
+}
+
+// isEmpty(interface{}, RecordType) returns a boolean telling if the given interface{}
+// contains an empty value
+func (s *Session) isEmpty(val interface{}) bool {
+	switch val := val.(type) {
+	case string:
+		return val == ""
+	case []string:
+		return len(val) == 0
+	case []map[string]string:
+		return len(val) == 0
+	case []interface{}:
+		return len(val) == 0
+	case []Record:
+		return len(val) == 0
+	case nil:
+		// a typed value not set
+		return true
+	}
+	return false
+}
+
+// emptyValue() returns the empty value for the type of the value: typed and aggregated
+// values are nil when not set, and the lists of typed values can hold any type
+func (v TextFSMValue) emptyValue() interface{} {
+	switch {
+	case v.aggregate != nil && v.rtype == STRING_RECORD, v.expr != nil:
+		return nil
+	case v.rtype == LIST_RECORD && v.vtype != TYPE_STRING:
+		return []interface{}{}
+	case v.rtype == LIST_RECORD:
+		return []string{}
+	case v.rtype == DICT_LIST_RECORD:
+		return []map[string]string{}
+	case v.vtype != TYPE_STRING:
+		return nil
+	}
+	return ""
+}
+
+// cloneValue(interface{}) returns a copy of the value, so that lists carried from a
+// record to another do not share their content
+func cloneValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case []string:
+		return append([]string{}, val...)
+	case []map[string]string:
+		return append([]map[string]string{}, val...)
+	case []interface{}:
+		return append([]interface{}{}, val...)
+	}
+	return val
+}
+
+// generateEmptyRecord() returns a map of a new record, with all the values empty unless
+// the options of the values set them, e.g. the "filldown" values
+func (s *Session) generateEmptyRecord() map[string]interface{} {
+	new_record := map[string]interface{}{}
+	for k, val_prop := range s.tmpl.values {
+		new_record[k] = val_prop.emptyValue()
+	}
+	for _, set := range s.tmpl.child_sets {
+		new_record[set] = []Record{}
+	}
+	for i := range s.option_ctxs {
+		if ctx := &s.option_ctxs[i]; ctx.option.OnRecordCreate != nil {
+			ctx.option.OnRecordCreate(ctx, new_record)
+		}
+	}
+	return new_record
+}
+
+// setValue(string, string, *map[string]interface{}) set the given value on the key of the
+// map provided as argument. If the pointer to the map is null, a new one is created from
+// scratch. The function returns back a pointer to the map where the value as been added
+func (s *Session) setValue(key string, val string, current_record *map[string]interface{}) (*map[string]interface{}, error) {
+	// Transform the text and convert it to the type of the value, an empty text leaves
+	// the typed values unset
+	value := s.tmpl.values[key]
+	for _, transform := range value.transforms {
+		transformed, err := transform.apply(val)
+		if err != nil {
+			return current_record, &ConversionError{
+				Value: key, Type: value.vtype, Transform: transform.name, Text: val, Err: err}
+		}
+		val = transformed
+	}
+	var typed_val interface{}
+	if value.vtype != TYPE_STRING && val != "" {
+		var err error
+		if typed_val, err = s.tmpl.convertValue(value.vtype, val); err != nil {
+			return current_record, &ConversionError{Value: key, Type: value.vtype, Text: val, Err: err}
+		}
+	}
+
+	if current_record == nil {
+		new_record := s.generateEmptyRecord()
+		current_record = &new_record
+	}
+
+	if value.aggregate != nil {
+		// The aggregating option combines the new match with the previous ones
+		var new_val interface{} = val
+		if value.vtype != TYPE_STRING {
+			new_val = typed_val
+		}
+		if val != "" && new_val != nil {
+			aggregated, err := value.aggregate.Aggregate(
+				s.optionContext(key, value.aggregate), (*current_record)[key], new_val)
+			if err != nil {
+				return current_record, err
+			}
+			(*current_record)[key] = aggregated
+		}
+	} else {
+		switch value.rtype {
+		case STRING_RECORD:
+			if value.vtype != TYPE_STRING {
+				(*current_record)[key] = typed_val
+			} else {
+				(*current_record)[key] = val
+			}
+		case LIST_RECORD:
+			if value.vtype == TYPE_STRING {
+				(*current_record)[key] = append((*current_record)[key].([]string), val)
+			} else if typed_val != nil {
+				(*current_record)[key] = append((*current_record)[key].([]interface{}), typed_val)
+			}
+		case DICT_LIST_RECORD:
+			nested, err := value.nestedValue(val)
+			if err != nil {
+				return current_record, err
+			}
+			(*current_record)[key] = append((*current_record)[key].([]map[string]string), nested)
+		}
+	}
+
+	for i := range s.option_ctxs {
+		ctx := &s.option_ctxs[i]
+		if ctx.Value != key || ctx.option.OnSet == nil {
+			continue
+		}
+		if err := ctx.option.OnSet(ctx, *current_record, val); err != nil {
+			return current_record, err
+		}
+	}
+	return current_record, nil
+}
+
+// fillUp(string, interface{}) sets the given value in the pending records, going backward
+// until a record having that value already set is found. The function tells if any
+// record has been filled. The records already emitted have all the fillup values set, so
+// there is no need to look further than the pending ones.
+func (s *Session) fillUp(key string, fill_val interface{}) bool {
+	records := s.tables[s.tmpl.values[key].table].records
+	filled := false
+	for i := len(records) - 1; i >= 0; i-- {
+		if !s.isEmpty(records[i][key]) {
+			break
+		}
+		records[i][key] = cloneValue(fill_val)
+		filled = true
+	}
+	return filled
+}
+
+// clearRecord(*map[string]interface{}) implements the Clear operation, so it clear all the
+// values stored so far, filldown excluded. The function returns the pointer to the
+// cleared record.
+func (s *Session) clearRecord(current_record *map[string]interface{}) *map[string]interface{} {
+	if s.tmpl.semantics == SEMANTICS_PYTHON {
+		// The record will be generated again, with the filldown values, when needed
+		return nil
+	}
+
+	if current_record != nil {
+		*current_record = s.generateEmptyRecord()
+	}
+	return current_record
+}
+
+// clearAllRecord(*map[string]interface{}) implements the ClearAll operation, so it
+// clears all the values stored so far. The function returns the pointer to the cleared
+// record.
+func (s *Session) clearAllRecord(current_record *map[string]interface{}) *map[string]interface{} {
+	if s.tmpl.semantics == SEMANTICS_PYTHON {
+		// Filldown values are forgotten too
+		s.filldown = Record{}
+		return nil
+	}
+
+	if current_record != nil {
+		for k := range *current_record {
+			if s.tmpl.isChildSet(k) {
+				(*current_record)[k] = []Record{}
+			} else {
+				(*current_record)[k] = s.tmpl.values[k].emptyValue()
+			}
+		}
+	}
+	return current_record
+}
+
+// isRecordEmpty(string, Record) tells if all the values of the given table are empty in
+// the record
+func (s *Session) isRecordEmpty(table string, record Record) bool {
+	for _, name := range s.tmpl.tables[table].names {
+		if !s.isEmpty(record[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendRecord(string, *map[string]interface{}) append the record filled so far to the
+// list of records of the given table, the default one if the name is empty. It applies the
+// fillup if any, then it emits the records which are now final.
+func (s *Session) appendRecord(table string, current_record *map[string]interface{}) error {
+	if current_record == nil && s.tmpl.semantics == SEMANTICS_PYTHON {
+		// As in Python, the filldown values alone make a record
+		new_record := s.generateEmptyRecord()
+		if s.isRecordEmpty(table, new_record) {
+			return nil
+		}
+		current_record = &new_record
+	}
+
+	if current_record != nil {
+		if table == "" {
+			s.collectChildren(*current_record)
+		}
+		record := s.tableRecord(table, *current_record)
+		if err := s.computeValues(table, record); err != nil {
+			return err
+		}
+
+		// The options can drop the record, e.g. when a Required value is not set, or
+		// change the records collected so far, e.g. filling them up
+		for i := range s.option_ctxs {
+			ctx := &s.option_ctxs[i]
+			value := s.tmpl.values[ctx.Value]
+			if ctx.option.OnAppend == nil || value.table != table || value.child != "" {
+				continue
+			}
+			if keep, err := ctx.option.OnAppend(ctx, record); err != nil || !keep {
+				return err
+			}
+		}
+
+		// Add the new record, the secret values are redacted once it is validated
+		state := s.tables[table]
+		state.records = append(state.records, record)
+		state.last_record = record
+	}
+	return s.emitSettledRecords(table)
+}
+
+// handleConversionError(*ConversionError, Record) passes the error, about the last parsed
+// line, to the handler of the template, with the secret texts of the line and of the given
+// record redacted. The error is returned when the parsing should stop.
+func (s *Session) handleConversionError(conv_err *ConversionError, record Record) error {
+	conv_err.Line = s.line
+	conv_err.LineNo = s.line_no
+	s.redactConversionError(conv_err, record)
+	if s.tmpl.conversion_handler == nil {
+		return conv_err
+	}
+	return s.tmpl.conversion_handler(conv_err)
+}
+
+// computeValues(string, Record) evaluates the expressions of the Computed values of the
+// given table on the record, in declaration order. The values whose expression fails are
+// left unset, if the conversion error handler allows it.
+func (s *Session) computeValues(table string, record Record) error {
+	for _, name := range s.tmpl.tables[table].computed {
+		expr := s.tmpl.values[name].expr
+		val, err := expr.root.eval(record)
+		if err != nil {
+			conv_err := &ConversionError{Value: name, Expr: expr.source, Err: err}
+			if err := s.handleConversionError(conv_err, record); err != nil {
+				return err
+			}
+		}
+		record[name] = val
+	}
+	return nil
+}
+
+// parseLine(string) parses the line provided as argument checking if it matches one of
+// the rules defined in the template, if so it fills the values in the current record
+// and perform the related actions. The function returns the number of the following
+// lines consumed by a multi-line rule.
+func (s *Session) parseLine(line string) (int, error) {
+	s.leaveBlocks(line)
+	text := s.blockLine(line)
+	s.line_secrets = s.line_secrets[:0]
+	for _, rule := range s.tmpl.rules[s.state] {
+		submatch, err := rule.regex.FindStringSubmatch(text)
+		if err != nil {
+			return 0, fmt.Errorf("error matching rule %s in %s: %w", rule.regex, s.redactText(line, nil), err)
+		}
+
+		// Check if the next rule matches
+		if submatch == nil {
+			continue
+		}
+		detected_vars := []map[string]string{utils.GetNamedGroups(rule.regex.SubexpNames(), submatch)}
+
+		// A multi-line rule matches the following lines too
+		if len(rule.next_regexes) > 0 {
+			next_vars, err := s.matchNextLines(rule)
+			if err != nil {
+				return 0, err
+			} else if next_vars == nil {
+				continue
+			}
+			detected_vars = append(detected_vars, next_vars...)
+		}
+
+		// A rule whose guard does not hold is skipped, as if it did not match
+		if holds, err := s.guardHolds(rule.guard); err != nil {
+			return 0, fmt.Errorf("error evaluating the guard of the rule in line %d of the template: %w", rule.line_no,
+				s.redactError(err, s.guardRecord()))
+		} else if !holds {
+			continue
+		}
+
+		// The secret texts matched by the rule are not shown in the errors about the line
+		s.addLineSecrets(detected_vars)
+
+		// Check if we need to raise an error
+		if rule.error_str != "" {
+			return 0, fmt.Errorf("state error raised by FSM: %s in %s", rule.error_str, s.redactText(line, nil))
+		}
+
+		// A block forgets the filldown values set from its first line on
+		var scope Record
+		if rule.state_op == BLOCK_STATE_OP {
+			scope = s.filldownScope()
+		}
+
+		// Store the variables, if any, line by line so that the errors point to the line
+		// the text comes from
+		line_no := s.line_no
+		for i, line_vars := range detected_vars {
+			s.line_no, s.line = line_no+i, s.lookahead[i]
+			for key, val := range line_vars {
+				if column := s.tmpl.values[key].column; column != nil {
+					val = s.columnText(key, column, s.line)
+				}
+				// The values of the named tables are filled in the records of their table
+				if table := s.tmpl.values[key].table; table != "" {
+					s.table_current[table], err = s.setValue(key, val, s.table_current[table])
+				} else {
+					s.current_record, err = s.setValue(key, val, s.current_record)
+				}
+				if err != nil {
+					var conv_err *ConversionError
+					if !errors.As(err, &conv_err) {
+						return 0, fmt.Errorf("error setting value %s in %s: %w", key, s.redactText(s.line, nil),
+							s.redactError(err, nil))
+					}
+
+					if err := s.handleConversionError(conv_err, nil); err != nil {
+						return 0, err
+					}
+				}
+			}
+		}
+		s.line_no, s.line = line_no, line
+
+		// Handle the record options
+		switch {
+		case rule.child != "" && s.current_record != nil:
+			if rule.rec_op == RECORD_REC_OP {
+				s.recordChild(*s.current_record, rule.child)
+			} else {
+				s.clearChild(*s.current_record, rule.child)
+			}
+		case rule.child != "":
+			// No value has been set, there is no child to record or clear
+		case rule.table != "" && rule.rec_op == RECORD_REC_OP:
+			if err := s.appendRecord(rule.table, s.table_current[rule.table]); err != nil {
+				return 0, err
+			}
+			s.table_current[rule.table] = nil
+		case rule.table != "":
+			s.table_current[rule.table] = nil
+		case rule.rec_op == RECORD_REC_OP:
+			if err := s.appendRecord("", s.current_record); err != nil {
+				return 0, err
+			}
+			s.current_record = nil
+		case rule.rec_op == HEADER_REC_OP:
+			s.learnColumns(line)
+		case rule.rec_op == CLEAR_REC_OP:
+			s.current_record = s.clearRecord(s.current_record)
+		case rule.rec_op == CLEAR_ALL_REC_OP:
+			s.current_record = s.clearAllRecord(s.current_record)
+			for _, table := range s.tmpl.table_names {
+				s.table_current[table] = nil
+			}
+		}
+
+		// Handle the line options
+		from, from_depth := s.state, len(s.stack)
+		if rule.line_op != CONTINUE_LINE_OP {
+			// Apply the new state if needed
+			if err := s.changeState(rule, scope); err != nil {
+				return 0, err
+			}
+		}
+		s.traceRule(rule, from, from_depth)
+		if rule.line_op != CONTINUE_LINE_OP {
+			// Parse the next line, the multi-line rules cannot be used with Continue
+			return len(rule.next_regexes), nil
+		}
+	}
+	return 0, nil
+}
+
+// addLineSecrets([]map[string]string) adds the texts of the secret values matched by a rule,
+// in each of its lines, to the secrets of the line being parsed
+func (s *Session) addLineSecrets(detected_vars []map[string]string) {
+	for i, line_vars := range detected_vars {
+		for key, val := range line_vars {
+			value := s.tmpl.values[key]
+			if !value.secret {
+				continue
+			}
+			if value.column != nil {
+				val = s.columnText(key, value.column, s.lookahead[i])
+			}
+			if val != "" {
+				s.line_secrets = append(s.line_secrets, val)
+			}
+		}
+	}
+}
+
+// matchNextLines(TextFSMRule) matches the lines following the first one of a multi-line
+// rule, in the lookahead buffer. The function returns the values found in each line, nil
+// if any line does not match or the text ends before.
+func (s *Session) matchNextLines(rule TextFSMRule) ([]map[string]string, error) {
+	if len(s.lookahead) <= len(rule.next_regexes) {
+		return nil, nil
+	}
+
+	next_vars := make([]map[string]string, len(rule.next_regexes))
+	for i, regex := range rule.next_regexes {
+		line := s.blockLine(s.lookahead[1+i])
+		submatch, err := regex.FindStringSubmatch(line)
+		if err != nil {
+			return nil, fmt.Errorf("error matching rule %s in %s: %w", regex, s.redactText(line, nil), err)
+		} else if submatch == nil {
+			return nil, nil
+		}
+		next_vars[i] = utils.GetNamedGroups(regex.SubexpNames(), submatch)
+	}
+	return next_vars, nil
+}
+
+// changeState(TextFSMRule, Record) moves the fsm to the new state of the rule, if any. Call
+// and Block save the current state on the stack before the change, Return goes back to the
+// saved state. Block saves the indentation of the line too, and the filldown scope to
+// restore leaving the block.
+func (s *Session) changeState(rule TextFSMRule, scope Record) error {
+	switch rule.state_op {
+	case CALL_STATE_OP, BLOCK_STATE_OP:
+		if len(s.stack) >= s.tmpl.maxCallDepth() {
+			return fmt.Errorf("state stack overflow calling %s in line %d: more than %d nested calls",
+				rule.new_state, s.line_no, s.tmpl.maxCallDepth())
+		}
+		frame := stackFrame{state: s.state, indent: -1}
+		if rule.state_op == BLOCK_STATE_OP {
+			frame.indent, frame.filldown = lineIndent(s.line), scope
+		}
+		s.stack = append(s.stack, frame)
+		s.prev_state, s.state = s.state, rule.new_state
+	case RETURN_STATE_OP:
+		if len(s.stack) == 0 {
+			return fmt.Errorf("%s with an empty state stack in state %s, line %d", RETURN_STATE_OP, s.state, s.line_no)
+		}
+		s.returnState()
+	default:
+		if rule.new_state != "" {
+			s.prev_state, s.state = s.state, rule.new_state
+		}
+	}
+	return nil
+}
+
+// traceRule(TextFSMRule, string, int) writes the rule matched by the last line to the
+// trace writer of the template, if any, with the state and the depth of the stack before
+// and after the rule
+func (s *Session) traceRule(rule TextFSMRule, from string, from_depth int) {
+	if s.tmpl.trace == nil {
+		return
+	}
+	moved := ""
+	if s.state != from || len(s.stack) != from_depth {
+		moved = fmt.Sprintf(", now in state %s, depth %d", s.state, len(s.stack))
+	}
+	fmt.Fprintf(s.tmpl.trace, "line %d: state %s, depth %d: matched rule in template line %d%s\n",
+		s.line_no, from, from_depth, rule.line_no, moved)
+}
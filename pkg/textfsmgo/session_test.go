@@ -0,0 +1,303 @@
+package textfsmgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSessionReuse(t *testing.T) {
+	parser, err := NewTextFSMParserFromString(testTemplate)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	// Records of a parse must not be affected by the following ones
+	session := parser.Template().NewSession()
+	first, err := session.ParseTextToDicts(testText)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	if _, err := session.ParseTextToDicts("3: eth1:\n    inet 10.0.1.1\n"); err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	if !reflect.DeepEqual(testExpRecords, first) {
+		t.Errorf("Error in 'Test session reuse': expected %+v got %+v", testExpRecords, first)
+	}
+
+	// A parser built from an existing template shares it
+	shared := NewTextFSMParserFromTemplate(parser.Template())
+	if shared.Template() != parser.Template() {
+		t.Errorf("Error in 'Test shared template': the template has been copied")
+	}
+	checkRecords(t, "Test shared template", shared, testText, testExpRecords)
+}
+
+// Run with -race to detect data races on the shared template
+func TestConcurrentParsing(t *testing.T) {
+	const n_goroutines = 300
+	parser, err := NewTextFSMParserFromString(testTemplate)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n_goroutines)
+	for i := 0; i < n_goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every goroutine parses a different text, so that mixed up states are detected
+			text := fmt.Sprintf("%d: eth%d:\n    inet 10.0.0.%d\n", i, i, i%256)
+			exp := []map[string]interface{}{
+				{"ifname": fmt.Sprintf("eth%d", i), "addresses": []string{fmt.Sprintf("10.0.0.%d", i%256)}},
+			}
+			for j := 0; j < 10; j++ {
+				res, err := parser.ParseTextToDicts(text)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !reflect.DeepEqual(exp, res) {
+					errs <- fmt.Errorf("goroutine %d: expected %+v got %+v", i, exp, res)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Error in 'Test concurrent parsing': %s", err)
+	}
+}
+
+func TestStateStack(t *testing.T) {
+	tmpl := `Value Filldown neighbor (\S+)
+Value afi (\S+)
+Value Required prefixes (\d+)
+
+Start
+  ^neighbor ${neighbor} -> Call Neighbor
+
+Neighbor
+  ^  address-family ${afi} -> Call AddressFamily
+  ^exit$$ -> Return
+
+AddressFamily
+  ^    prefixes ${prefixes} -> Record
+  ^  exit-af -> Return
+`
+	text := `neighbor 1.1.1.1
+  address-family ipv4
+    prefixes 10
+  exit-af
+  address-family ipv6
+    prefixes 3
+  exit-af
+exit
+neighbor 2.2.2.2
+  address-family ipv4
+    prefixes 7
+  exit-af
+exit
+`
+	var trace strings.Builder
+	parser, err := NewTextFSMParserFromString(tmpl, WithTrace(&trace))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test state stack", parser, text, []map[string]interface{}{
+		{"neighbor": "1.1.1.1", "afi": "ipv4", "prefixes": "10"},
+		{"neighbor": "1.1.1.1", "afi": "ipv6", "prefixes": "3"},
+		{"neighbor": "2.2.2.2", "afi": "ipv4", "prefixes": "7"},
+	})
+	exp_trace := "line 2: state Neighbor, depth 1: matched rule in template line 9, now in state AddressFamily, depth 2\n" +
+		"line 3: state AddressFamily, depth 2: matched rule in template line 13\n" +
+		"line 4: state AddressFamily, depth 2: matched rule in template line 14, now in state Neighbor, depth 1\n"
+	if !strings.Contains(trace.String(), exp_trace) {
+		t.Errorf("Error in 'Test state stack trace': expected '%s' in '%s'", exp_trace, trace.String())
+	}
+
+	// The calls cannot be nested beyond the maximum depth
+	parser, err = NewTextFSMParserFromString(tmpl, WithMaxCallDepth(1))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	if _, err := parser.ParseTextToDicts(text); err == nil || !strings.Contains(err.Error(), "state stack overflow") {
+		t.Errorf("Error in 'Test state stack overflow': unexpected error %v", err)
+	}
+
+	// Return needs a state to go back to
+	parser, err = NewTextFSMParserFromString("Value a (\\S+)\n\nStart\n  ^${a} -> Return\n")
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	if _, err := parser.ParseTextToDicts("x\n"); err == nil || !strings.Contains(err.Error(), "Return with an empty state stack") {
+		t.Errorf("Error in 'Test Return with empty stack': unexpected error %v", err)
+	}
+}
+
+func TestStateStackErrors(t *testing.T) {
+	var stackTestCases = []struct {
+		description string
+		template    string
+		exp_err     string
+	}{
+		{
+			description: "Test Call of an unknown state",
+			template:    "Value a (\\S+)\n\nStart\n  ^${a} -> Call Other\n",
+			exp_err:     ".*Pointer to unknown state 'Other'",
+		},
+		{
+			description: "Test Call of End",
+			template:    "Value a (\\S+)\n\nStart\n  ^${a} -> Call End\n",
+			exp_err:     ".*State 'End' cannot be reached by Call",
+		},
+		{
+			description: "Test called state with no Return",
+			template:    "Value a (\\S+)\n\nStart\n  ^${a} -> Call Other\n\nOther\n  ^x -> Next\n  ^y -> Third\n\nThird\n  ^z -> Call Other\n",
+			exp_err:     ".*line 4.*State 'Other' is reached by Call in state Start, but it has no path to a Return",
+		},
+		{
+			description: "Test Block of EOF",
+			template:    "Value a (\\S+)\n\nStart\n  ^${a} -> Block EOF\n",
+			exp_err:     ".*State 'EOF' cannot be reached by Block",
+		},
+		{
+			description: "Test Block with no state",
+			template:    "Value a (\\S+)\n\nStart\n  ^${a} -> Next.Record Block\n",
+			exp_err:     ".*line 4, column 24: the Block action requires the state to enter",
+		},
+		{
+			description: "Test reserved state name",
+			template:    "Value a (\\S+)\n\nStart\n  ^${a}\n\nReturn\n  ^x\n",
+			exp_err:     ".*invalid state name Return",
+		},
+	}
+
+	for _, tc := range stackTestCases {
+		_, err := NewTextFSMParserFromString(tc.template)
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+
+	// A Return reached through other states is enough
+	_, err := NewTextFSMParserFromString("Value a (\\S+)\n\nStart\n  ^${a} -> Call Other\n\nOther\n  ^x -> Third\n\nThird\n  ^y -> Return\n")
+	if err != nil {
+		t.Errorf("Error in 'Test indirect Return': unexpected error '%s'", err)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	tmpl := `Value Filldown interface (\S+)
+Value Filldown vrf (\S+)
+Value descr (.*)
+Value Required address (\S+)
+
+Start
+  ^interface ${interface} -> Block Interface
+  ^router -> Block Ignore
+
+Interface
+  ^description ${descr}
+  ^vrf forwarding ${vrf}
+  ^ip address ${address} -> Record
+  ^standby -> Block Standby
+  ^!$$ -> Error "the block should have been left"
+
+Standby
+  ^ip ${address} -> Record
+
+Ignore
+`
+	text := `interface Gi0/1
+ description uplink
+ vrf forwarding red
+ ip address 10.0.0.1/24
+ standby 1
+   ip 10.0.0.254
+
+ ip address 10.0.1.1/24
+!
+interface Gi0/2
+ ip address 10.0.2.1/24
+!
+router bgp 1
+ ip address 1.1.1.1/32
+`
+	var trace strings.Builder
+	parser, err := NewTextFSMParserFromString(tmpl, WithTrace(&trace))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test blocks", parser, text, []map[string]interface{}{
+		{"interface": "Gi0/1", "vrf": "red", "descr": "uplink", "address": "10.0.0.1/24"},
+		{"interface": "Gi0/1", "vrf": "red", "descr": "", "address": "10.0.0.254"},
+		{"interface": "Gi0/1", "vrf": "red", "descr": "", "address": "10.0.1.1/24"},
+		{"interface": "Gi0/2", "vrf": "", "descr": "", "address": "10.0.2.1/24"},
+	})
+	exp_trace := "line 8: left block state Standby, now in state Interface, depth 1\n" +
+		"line 8: state Interface, depth 1: matched rule in template line 13\n" +
+		"line 9: left block state Interface, now in state Start, depth 0\n"
+	if !strings.Contains(trace.String(), exp_trace) {
+		t.Errorf("Error in 'Test blocks trace': expected '%s' in '%s'", exp_trace, trace.String())
+	}
+}
+
+func TestMultiLineRules(t *testing.T) {
+	tmpl := `Value Required name (\S+)
+Value state (up|down)
+Value Type=int mtu (\d+)
+Value descr (.*)
+
+Start
+  ^${name} is ${state}\n^\s+MTU ${mtu}\n^\s+Description: ${descr} -> Record
+  ^${name} is ${state}\n^\s+MTU ${mtu} -> Record
+  ^\s+Description: ${descr} -> Error "orphan description"
+`
+	text := `Gi0/1 is up
+  MTU 1500
+  Description: uplink
+Gi0/2 is down
+  MTU 9000
+Gi0/3 is up
+  MTU 1500`
+	exp := []map[string]interface{}{
+		{"name": "Gi0/1", "state": "up", "mtu": int64(1500), "descr": "uplink"},
+		{"name": "Gi0/2", "state": "down", "mtu": int64(9000), "descr": ""},
+		{"name": "Gi0/3", "state": "up", "mtu": int64(1500), "descr": ""},
+	}
+
+	parser, err := NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test multi-line rules", parser, text, exp)
+
+	// The lookahead buffer works with the streamed input too
+	res := []map[string]interface{}{}
+	err = parser.ParseReader(context.Background(), strings.NewReader(text), func(r Record) error {
+		res = append(res, r)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(exp, res) {
+		t.Errorf("Error in 'Test streamed multi-line rules': expected %+v got %+v (%v)", exp, res, err)
+	}
+
+	// The errors point to the line the text comes from
+	_, err = parser.ParseTextToDicts("Gi0/1 is up\n  MTU 99999999999999999999\n")
+	var conv_err *ConversionError
+	if !errors.As(err, &conv_err) || conv_err.LineNo != 2 {
+		t.Errorf("Error in 'Test multi-line conversion error': unexpected error %+v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package textfsmgo
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"unicode/utf8"
+)
+
+// splitPythonLines(string) splits the text in lines as str.splitlines() does in Python:
+// besides \n, lines can be terminated by \r\n, \r and some other control and unicode
+// chars, and there is no empty line after the last line break
+func splitPythonLines(text string) []string {
+	lines := []string{}
+	start := 0
+	for i, r := range text {
+		switch r {
+		case '\n', '\r', '\v', '\f', '\x1c', '\x1d', '\x1e', '\u0085', '\u2028', '\u2029':
+			if r == '\n' && i > 0 && text[i-1] == '\r' {
+				// \r\n is a single line break
+				start = i + 1
+				continue
+			}
+			lines = append(lines, text[start:i])
+			start = i + utf8.RuneLen(r)
+		}
+	}
+
+	if start < len(text) {
+		lines = append(lines, text[start:])
+	}
+	return lines
+}
+
+// lineReader splits the content of a reader in lines, the same way
+// strings.Split(text, "\n") would do, or splitPythonLines() with the Python semantics,
+// without loading the whole content in memory
+type lineReader struct {
+	reader  *bufio.Reader
+	python  bool     // split the lines as Python does
+	pending []string // lines already split but not yet returned
+	done    bool
+}
+
+func newLineReader(r io.Reader, semantics Semantics) *lineReader {
+	return &lineReader{reader: bufio.NewReader(r), python: semantics == SEMANTICS_PYTHON}
+}
+
+// next() returns the next line, the boolean is false when there are no more lines
+func (l *lineReader) next() (string, bool, error) {
+	if l.python {
+		// A chunk ends with \n, so \r\n is never split between two chunks
+		for len(l.pending) == 0 {
+			if l.done {
+				return "", false, nil
+			}
+
+			chunk, err := l.reader.ReadString('\n')
+			if err == io.EOF {
+				l.done = true
+			} else if err != nil {
+				return "", false, err
+			}
+			l.pending = splitPythonLines(chunk)
+		}
+
+		line := l.pending[0]
+		l.pending = l.pending[1:]
+		return line, true, nil
+	}
+
+	if l.done {
+		return "", false, nil
+	}
+
+	line, err := l.reader.ReadString('\n')
+	if err == io.EOF {
+		// The text after the last newline is a line too, even if empty
+		l.done = true
+		return line, true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return line[:len(line)-1], true, nil
+}
+
+// ParseReader(context.Context, io.Reader, func(Record) error) parses the text read from
+// the reader line by line, calling the given function for each record as soon as it is
+// final. Only the records which could still be changed by a Fillup value are held in
+// memory. The parsing stops at the first error returned by the function or when the
+// context is done. The failures of the Validate rules are returned as ValidationErrors
+// once all the records have been passed to the function.
+func (s *Session) ParseReader(ctx context.Context, r io.Reader, fn func(Record) error) error {
+	s.begin(fn)
+	defer s.Reset()
+
+	lines := newLineReader(r, s.tmpl.semantics)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, ok, err := lines.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		if stop, err := s.feedLine(line); err != nil {
+			return err
+		} else if stop {
+			break
+		}
+	}
+	return s.finish()
+}
+
+// Iterate(context.Context, io.Reader) returns an iterator over the records parsed from
+// the text read from the reader. The session must not be used for anything else until
+// the iterator is exhausted.
+func (s *Session) Iterate(ctx context.Context, r io.Reader) *RecordIterator {
+	it := &RecordIterator{
+		ctx:     ctx,
+		session: s,
+		lines:   newLineReader(r, s.tmpl.semantics),
+	}
+	s.begin(func(r Record) error {
+		it.queue = append(it.queue, r)
+		return nil
+	})
+	return it
+}
+
+// RecordIterator is a pull-style iterator over the records of a text, the text is read
+// and parsed only when more records are requested.
+//
+//	it := parser.Iterate(ctx, reader)
+//	for it.Next() {
+//		record := it.Record()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type RecordIterator struct {
+	ctx      context.Context
+	session  *Session
+	lines    *lineReader
+	queue    []Record // the final records not yet returned
+	record   Record   // the current record
+	err      error    // the error which stopped the iteration
+	finished bool     // tells if the whole text has been parsed
+}
+
+// Next() advances the iterator to the next record, it returns false when there are no
+// more records or an error occurred
+func (it *RecordIterator) Next() bool {
+	for len(it.queue) == 0 {
+		if it.finished || it.err != nil {
+			it.record = nil
+			return false
+		}
+		it.readLine()
+	}
+
+	it.record = it.queue[0]
+	it.queue[0] = nil
+	it.queue = it.queue[1:]
+	return true
+}
+
+// readLine() feeds the next line of the text to the session, completing the parsing
+// when the text is over
+func (it *RecordIterator) readLine() {
+	if it.err = it.ctx.Err(); it.err != nil {
+		return
+	}
+
+	line, ok, err := it.lines.next()
+	if it.err = err; err != nil {
+		return
+	}
+
+	stop := !ok
+	if ok {
+		if stop, it.err = it.session.feedLine(line); it.err != nil {
+			return
+		}
+	}
+
+	if stop {
+		it.finished = true
+		it.err = it.session.finish()
+		it.session.tables[""].emit = nil
+	}
+}
+
+// Record() returns the current record
+func (it *RecordIterator) Record() Record {
+	return it.record
+}
+
+// Err() returns the error which stopped the iteration, if any, or the ValidationErrors of
+// the records failing the Validate rules once all of them have been returned
+func (it *RecordIterator) Err() error {
+	return it.err
+}
+
+// ParseReader(context.Context, io.Reader, func(Record) error) parses the text read from
+// the reader, calling the given function for each record as soon as it is final. It can
+// be called concurrently by multiple goroutines. See Session.ParseReader() for details.
+func (t *TextFSM) ParseReader(ctx context.Context, r io.Reader, fn func(Record) error) error {
+	session := t.sessions.Get().(*Session)
+	defer t.sessions.Put(session)
+	return session.ParseReader(ctx, r, fn)
+}
+
+// Iterate(context.Context, io.Reader) returns an iterator over the records parsed from
+// the text read from the reader. Each iterator uses its own session.
+func (t *TextFSM) Iterate(ctx context.Context, r io.Reader) *RecordIterator {
+	return t.template.NewSession().Iterate(ctx, r)
+}
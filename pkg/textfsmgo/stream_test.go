@@ -0,0 +1,177 @@
+package textfsmgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fillupTemplate = `Value Fillup vrf (\S+)
+Value route (\S+)
+
+Start
+  ^route ${route} -> Record
+  ^vrf ${vrf} -> Record
+`
+
+// infiniteReader produces endlessly the lines generated by the given function
+type infiniteReader struct {
+	line func(int) string
+	n    int
+	buf  []byte
+}
+
+func (r *infiniteReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		r.buf = []byte(r.line(r.n) + "\n")
+		r.n++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestParseReaderMatchesParseText(t *testing.T) {
+	var streamTestCases = []struct {
+		description string
+		template    string
+		text        string
+	}{
+		{
+			description: "Test lists",
+			template:    testTemplate,
+			text:        testText,
+		},
+		{
+			description: "Test text without final newline",
+			template:    testTemplate,
+			text:        strings.TrimSuffix(testText, "\n"),
+		},
+		{
+			description: "Test fillup",
+			template:    fillupTemplate,
+			text:        "route 10.0.0.0/8\nroute 10.1.0.0/16\nvrf red\nroute 192.168.0.0/16\n",
+		},
+	}
+
+	for _, tc := range streamTestCases {
+		t.Log(tc.description)
+		parser, err := NewTextFSMParserFromString(tc.template)
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+
+		exp, err := parser.ParseTextToDicts(tc.text)
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+
+		got := []Record{}
+		err = parser.ParseReader(context.Background(), strings.NewReader(tc.text), func(r Record) error {
+			got = append(got, r)
+			return nil
+		})
+		if err != nil || !reflect.DeepEqual(exp, got) {
+			t.Errorf("Error in '%s': ParseReader expected %+v got %+v (%v)", tc.description, exp, got, err)
+		}
+
+		got = []Record{}
+		it := parser.Iterate(context.Background(), strings.NewReader(tc.text))
+		for it.Next() {
+			got = append(got, it.Record())
+		}
+		if it.Err() != nil || !reflect.DeepEqual(exp, got) {
+			t.Errorf("Error in '%s': Iterate expected %+v got %+v (%v)", tc.description, exp, got, it.Err())
+		}
+	}
+}
+
+func TestParseReaderFillupWindow(t *testing.T) {
+	parser, err := NewTextFSMParserFromString(fillupTemplate)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	// Each record is emitted only once its fillup value is known
+	text := "route r1\nroute r2\nvrf red\nroute r3\nvrf blue\nroute r4\n"
+	exp_vrfs := []string{"red", "red", "red", "blue", "blue", ""}
+	session := parser.Template().NewSession()
+	emitted := 0
+	err = session.ParseReader(context.Background(), strings.NewReader(text), func(r Record) error {
+		if r["vrf"] != exp_vrfs[emitted] {
+			t.Errorf("Error in 'Test fillup window': record %d emitted with vrf '%s', expected '%s'",
+				emitted, r["vrf"], exp_vrfs[emitted])
+		}
+		emitted++
+		return nil
+	})
+	if err != nil || emitted != len(exp_vrfs) {
+		t.Errorf("Error in 'Test fillup window': expected %d records got %d (%v)", len(exp_vrfs), emitted, err)
+	}
+
+	// Memory is bounded by the fillup window, not by the size of the input
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &infiniteReader{line: func(i int) string {
+		if i%3 == 2 {
+			return fmt.Sprintf("vrf vrf%d", i)
+		}
+		return fmt.Sprintf("route r%d", i)
+	}}
+	emitted = 0
+	err = session.ParseReader(ctx, reader, func(r Record) error {
+		if len(session.tables[""].records) > 3 {
+			t.Fatalf("Error in 'Test bounded memory': %d records pending", len(session.tables[""].records))
+		}
+		if emitted++; emitted == 10000 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Error in 'Test bounded memory': expected context canceled, got '%v'", err)
+	}
+}
+
+func TestParseReaderErrors(t *testing.T) {
+	parser, err := NewTextFSMParserFromString(testTemplate)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	// The errors of the callback stop the parsing
+	stop_err := errors.New("stop")
+	calls := 0
+	err = parser.ParseReader(context.Background(), strings.NewReader(testText), func(r Record) error {
+		calls++
+		return stop_err
+	})
+	if !errors.Is(err, stop_err) || calls != 1 {
+		t.Errorf("Error in 'Test callback error': expected 1 call and error '%s', got %d calls and '%v'",
+			stop_err, calls, err)
+	}
+
+	// The errors of the reader are reported by the iterator
+	read_err := errors.New("broken reader")
+	it := parser.Iterate(context.Background(), io.MultiReader(
+		strings.NewReader(testText), &errReader{read_err}))
+	records := 0
+	for it.Next() {
+		records++
+	}
+	if !errors.Is(it.Err(), read_err) || records != 1 {
+		t.Errorf("Error in 'Test reader error': expected 1 record and error '%s', got %d records and '%v'",
+			read_err, records, it.Err())
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
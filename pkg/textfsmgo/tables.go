@@ -0,0 +1,180 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Option placing a value in a named table, e.g. Table=summary
+const TABLE_OPTION = "Table"
+
+// Name of the table of the values with no Table option, in the result of ParseTextToTables()
+const DEFAULT_TABLE = "default"
+
+// tableValues are the values of a table, the default one or a named one, grouped by the
+// part they play when the records of the table are collected
+type tableValues struct {
+	names    []string // the values of the table, in declaration order
+	fillup   []string // the values with the fillup option enabled
+	secret   []string // the values with the secret option enabled, but the child ones
+	computed []string // the computed values, in declaration order
+	keys     []string // the values identifying a record, in declaration order
+}
+
+// tableState holds the records of a table while they are collected: a record is pending
+// while a fillup can change it, then it is emitted through the key handling and the
+// validations
+type tableState struct {
+	records     []Record           // the records that could still be changed by a fillup
+	last_record Record             // the last collected record, source of the legacy filldown values
+	keys        *keyIndex          // the records held to be merged or replaced by key
+	emitted     int                // the number of records emitted so far
+	unique_seen []map[string]int   // for each Unique rule, the record where each combination of values was found
+	emit        func(Record) error // receives the records once they are final
+	collected   []Record           // the final records of a named table
+}
+
+// reset() forgets the records of the table, so that a new text can be parsed
+func (ts *tableState) reset() {
+	ts.records = []Record{}
+	ts.last_record = nil
+	ts.keys = nil
+	ts.emitted = 0
+	ts.unique_seen = nil
+	ts.collected = nil
+}
+
+// collect(Record) is the emit function of the named tables, it keeps the final records
+// to be returned by ParseTextToTables()
+func (ts *tableState) collect(record Record) error {
+	ts.collected = append(ts.collected, record)
+	return nil
+}
+
+// tableName(string) returns the name of the given table as shown to the user
+func tableName(table string) string {
+	if table == "" {
+		return DEFAULT_TABLE
+	}
+	return table
+}
+
+// Tables() returns the names of the tables declared with the Table option, in declaration
+// order. The default table is not included.
+func (t *Template) Tables() []string {
+	return append([]string{}, t.table_names...)
+}
+
+// isTable(string) tells if the name is the one of a table declared by the template
+func (t *Template) isTable(name string) bool {
+	_, present := t.tables[name]
+	return name != "" && present
+}
+
+// refTable(string) returns the table of a name used in an expression: the table of a
+// value, or the default one for a child record set. The boolean is false for an unknown name.
+func (t *Template) refTable(name string) (string, bool) {
+	if value, present := t.values[name]; present {
+		return value.table, true
+	}
+	return "", t.isChildSet(name)
+}
+
+// checkTables() checks the references among the values of different tables, once all the
+// values have been declared. The expressions of the Computed values are evaluated on the
+// records of their table, so they can refer only to the values of the same table, and the
+// Validate rules apply to the table of their values, which cannot be mixed.
+func (t *Template) checkTables() TemplateErrors {
+	errs := TemplateErrors{}
+	refError := func(line_no int, column int, name string, format string, args ...interface{}) {
+		errs = append(errs, &TemplateError{
+			Line:     line_no,
+			Column:   column,
+			Token:    name,
+			Severity: SEVERITY_ERROR,
+			Msg:      fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, name := range t.value_names {
+		value := t.values[name]
+		if value.expr == nil {
+			continue
+		}
+		for _, ref := range value.expr.refs {
+			if table, known := t.refTable(ref.name); known && table != value.table {
+				refError(value.line_no, value.expr.column+ref.pos, ref.name,
+					"the value %s of table %s cannot be used in the expression of %s", ref.name, tableName(table), name)
+			}
+		}
+	}
+	for i, rule := range t.validations {
+		refs := []exprRef{}
+		switch rule.kind {
+		case VALIDATE_EXPR:
+			refs = rule.expr.refs
+		case VALIDATE_UNIQUE:
+			for _, name := range rule.names {
+				refs = append(refs, exprRef{name: name, pos: strings.Index(rule.source, name)})
+			}
+		}
+		for j, ref := range refs {
+			table, known := t.refTable(ref.name)
+			if !known {
+				continue
+			}
+			if j == 0 {
+				// The rule applies to the records of the table of its first value
+				t.validations[i].table = table
+			} else if table != t.validations[i].table {
+				refError(rule.line_no, rule.column+ref.pos, ref.name,
+					"the value %s of table %s cannot be used with the values of table %s in the validations",
+					ref.name, tableName(table), tableName(t.validations[i].table))
+			}
+		}
+	}
+	return errs
+}
+
+// ParseTextToTables(string) parses the string provided as argument, returning the records
+// of every table: the default one, named DEFAULT_TABLE, and the ones declared with the
+// Table option. A table with no records has an empty list. As ParseTextToDicts() does, the
+// records are returned along with the ValidationErrors of the records failing the rules.
+func (s *Session) ParseTextToTables(text string) (map[string][]Record, error) {
+	records := []Record{}
+	s.begin(func(r Record) error {
+		records = append(records, r)
+		return nil
+	})
+	// Do not keep a reference to the returned records, the session could be reused
+	defer s.Reset()
+
+	err := s.parseText(text)
+	if err != nil && !validationResults(err) {
+		return nil, err
+	}
+	tables := map[string][]Record{DEFAULT_TABLE: records}
+	for _, name := range s.tmpl.table_names {
+		tables[name] = append([]Record{}, s.tables[name].collected...)
+	}
+	return tables, err
+}
+
+// tableRecord(string, Record) returns the record of the given table out of a record being
+// filled, which carries all the values: the record of a named table holds only its values,
+// while the record of the default table loses the values of the named tables.
+func (s *Session) tableRecord(table string, record Record) Record {
+	if table != "" {
+		table_record := make(Record, len(s.tmpl.tables[table].names))
+		for _, name := range s.tmpl.tables[table].names {
+			table_record[name] = record[name]
+		}
+		return table_record
+	}
+	for _, name := range s.tmpl.table_names {
+		for _, value := range s.tmpl.tables[name].names {
+			delete(record, value)
+		}
+	}
+	return record
+}
@@ -0,0 +1,232 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestTables(t *testing.T) {
+	tmpl := `Value Table=summary hostname (\S+)
+Value Table=summary,Type=int uptime (\d+)
+Value Table=summary,Filldown,Required version (\S+)
+Value Table=default port (\S+)
+Value status (up|down)
+
+Start
+  ^Hostname ${hostname}
+  ^Version ${version}
+  ^Uptime ${uptime} -> Record summary
+  ^Reload -> Clear summary
+  ^Port -> Next.Record Ports
+
+Ports
+  ^${port}\s+${status} -> Record
+  ^Hostname ${hostname} -> Record summary Start
+`
+	text := "Hostname r1\nVersion 15.2\nUptime 120\nPort\nGi0/1  up\nGi0/2  down\nHostname r2\nReload\nHostname r3\n"
+	exp := map[string][]Record{
+		DEFAULT_TABLE: {
+			{"port": "Gi0/1", "status": "up"},
+			{"port": "Gi0/2", "status": "down"},
+		},
+		"summary": {
+			{"hostname": "r1", "uptime": int64(120), "version": "15.2"},
+			{"hostname": "r2", "uptime": nil, "version": "15.2"},
+			{"hostname": "r3", "uptime": nil, "version": "15.2"},
+		},
+	}
+
+	for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+		parser, err := NewTextFSMParserFromString(tmpl, WithSemantics(semantics))
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		if tables := parser.Template().Tables(); !reflect.DeepEqual(tables, []string{"summary"}) {
+			t.Errorf("Error in 'Test tables': unexpected tables %v", tables)
+		}
+		res, err := parser.ParseTextToTables(text)
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		if !reflect.DeepEqual(exp, res) {
+			t.Errorf("Error in 'Test tables': expected %+v got %+v", exp, res)
+		}
+
+		// The default table alone is returned by ParseTextToDicts
+		checkRecords(t, "Test default table", parser, text, exp[DEFAULT_TABLE])
+	}
+}
+
+func TestTablesEndOfText(t *testing.T) {
+	tmpl := `Value Table=summary hostname (\S+)
+Value Table=summary,Filldown version (\S+)
+Value port (\S+)
+Value status (up|down)
+
+Start
+  ^Hostname ${hostname}
+  ^Version ${version} -> Record summary
+  ^${port}\s+${status} -> Record
+`
+	text := "Hostname r1\nVersion 15.2\nGi0/1  up\nGi0/2  down\n"
+	exp := map[string][]Record{
+		DEFAULT_TABLE: {
+			{"port": "Gi0/1", "status": "up"},
+			{"port": "Gi0/2", "status": "down"},
+		},
+		// The filldown version alone does not make a record at the end of the text
+		"summary": {
+			{"hostname": "r1", "version": "15.2"},
+		},
+	}
+
+	for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+		parser, err := NewTextFSMParserFromString(tmpl, WithSemantics(semantics))
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		res, err := parser.ParseTextToTables(text)
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		if !reflect.DeepEqual(exp, res) {
+			t.Errorf("Error in 'Test tables end of text': expected %+v got %+v", exp, res)
+		}
+	}
+}
+
+func TestTableSecretValues(t *testing.T) {
+	tmpl := `Value Table=auth,Secret pw (\S+)
+Value Table=auth user (\S+)
+Value port (\S+)
+
+Start
+  ^user ${user} password ${pw} -> Record auth
+  ^port ${port} -> Record
+`
+	text := "user admin password hunter2\nport Gi0/1\n"
+	// The secret of the named table is redacted there, and the default table does not carry it
+	exp := map[string][]Record{
+		DEFAULT_TABLE: {{"port": "Gi0/1"}},
+		"auth":        {{"user": "admin", "pw": DEFAULT_REDACT_MASK}},
+	}
+
+	parser, err := NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	res, err := parser.ParseTextToTables(text)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	if !reflect.DeepEqual(exp, res) {
+		t.Errorf("Error in 'Test table secret values': expected %+v got %+v", exp, res)
+	}
+}
+
+func TestTableRecordOptions(t *testing.T) {
+	registerTestValueOptions(t)
+
+	// The records of the named tables are collected as the default ones: the options, the
+	// Computed values, the keys and the validations apply to them
+	tmpl := `Value Table=ports,Key port (\S+)
+Value Table=ports,List vlans (\d+)
+Value Table=ports,Computed name = lower(port)
+Value Table=users,Required,Unique user (\S+)
+Value Table=users,Fillup role (\S+)
+Validate match(user, "^[a-z]+$")
+
+Start
+  ^port ${port} vlan ${vlans} -> Record ports
+  ^user ${user} -> Record users
+  ^role ${role}
+`
+	text := "port Gi1 vlan 10\nport Gi2 vlan 20\nport Gi1 vlan 30\nuser alice\nuser bob\nuser alice\nuser Eve\nrole admin\n"
+	exp := map[string][]Record{
+		DEFAULT_TABLE: {},
+		"ports": {
+			{KEY_FIELD: []string{"Gi1"}, "port": "Gi1", "vlans": []string{"10", "30"}, "name": "gi1"},
+			{KEY_FIELD: []string{"Gi2"}, "port": "Gi2", "vlans": []string{"20"}, "name": "gi2"},
+		},
+		"users": {
+			{"user": "alice", "role": "admin"},
+			{"user": "bob", "role": "admin"},
+			{"user": "Eve", "role": "admin"},
+		},
+	}
+
+	failed := []string{}
+	parser, err := NewTextFSMParserFromString(tmpl, WithKeyMode(KEY_MERGE),
+		WithValidationHandler(func(val_err *ValidationError) error {
+			failed = append(failed, fmt.Sprint(val_err.Record["user"]))
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	res, err := parser.ParseTextToTables(text)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	if !reflect.DeepEqual(exp, res) {
+		t.Errorf("Error in 'Test table record options': expected %+v got %+v", exp, res)
+	}
+	if !reflect.DeepEqual(failed, []string{"Eve"}) {
+		t.Errorf("Error in 'Test table record options': unexpected validation failures %v", failed)
+	}
+}
+
+func TestTableErrors(t *testing.T) {
+	var tableTestCases = []struct {
+		description string
+		template    string
+		exp_err     string
+	}{
+		{
+			description: "Test unknown table",
+			template:    "Value Table=t a (\\S+)\n\nStart\n  ^${a} -> Record x Other\n",
+			exp_err:     ".*line 4, column 19: unknown table x",
+		},
+		{
+			description: "Test invalid operation on a table",
+			template:    "Value Table=t a (\\S+)\n\nStart\n  ^${a} -> Next.NoRecord t\n",
+			exp_err:     ".*line 4, column 26: the NoRecord operation cannot be applied to a table",
+		},
+		{
+			description: "Test table value in a guard",
+			template:    "Value Table=t a (\\S+)\n\nStart\n  ^${a} -> Record t if a\n",
+			exp_err:     ".*line 4, column 24: the value a of table t cannot be used in the guards",
+		},
+		{
+			description: "Test table value in a Computed value",
+			template:    "Value Table=t a (\\S+)\nValue Computed b = a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 20: the value a of table t cannot be used in the expression of b",
+		},
+		{
+			description: "Test default value in a Computed value of a table",
+			template:    "Value a (\\S+)\nValue Table=t,Computed b = a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 28: the value a of table default cannot be used in the expression of b",
+		},
+		{
+			description: "Test values of different tables in a validation",
+			template:    "Value Table=t a (\\S+)\nValue b (\\S+)\nValidate a == b\n\nStart\n  ^${a} ${b}\n",
+			exp_err:     ".*line 3, column 15: the value b of table default cannot be used with the values of table t in the validations",
+		},
+		{
+			description: "Test Table with Child",
+			template:    "Value Table=t,Child=c a (\\S+)\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 1, column 15: conflicting option Child",
+		},
+	}
+
+	for _, tc := range tableTestCases {
+		_, err := NewTextFSMParserFromString(tc.template)
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+}
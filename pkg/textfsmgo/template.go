@@ -0,0 +1,140 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/slices"
+)
+
+// Template is the compiled representation of a template. Once created it is never
+// modified, so a single Template can be shared among goroutines, each one parsing its
+// text through its own Session.
+type Template struct {
+	template_parsed_line int                          // last parsed line of the template
+	template_line_indent int                          // indentation of the last parsed line of the template
+	state_names          []string                     // names of the states in declaration order
+	state_lines          map[string]int               // the line declaring each state
+	source               string                       // name of the source of the template, used in the diagnostics
+	value_names          []string                     // names of the values in declaration order
+	child_sets           []string                     // names of the child record sets in declaration order
+	children             map[string][]string          // the values of each child record set, in declaration order
+	table_names          []string                     // names of the tables declared with the Table option, in declaration order
+	tables               map[string]*tableValues      // the values of each table, the default one has an empty name
+	header_vals          []string                     // list of the Column values whose columns are learned from a header
+	values               map[string]TextFSMValue      // the collection of values declared in the template
+	hooks                []optionHook                 // the hooks of the value options, in the order they are called
+	rules                map[string][]TextFSMRule     // the list of rules to match line against
+	regex_engine         RegexEngine                  // the engine compiling the regexes of the template
+	semantics            Semantics                    // the runtime semantics of the FSM
+	key_mode             KeyMode                      // how the records sharing the same key are handled
+	key_conflict_handler func(KeyConflict) error      // handles the conflicts found merging records
+	time_layouts         []string                     // the layouts of the values of type time, TIME_LAYOUTS if nil
+	conversion_handler   func(*ConversionError) error // handles the values which cannot be converted to their type
+	transforms           map[string]TransformFunc     // the custom transforms which can be used by the values
+	redaction            RedactionPolicy              // how the secret values are redacted in the records
+	validations          []validationRule             // the Validate rules, in declaration order
+	validation_handler   func(*ValidationError) error // handles the records and the tables failing a Validate rule
+	strict_validation    bool                         // tells if the first failure of a Validate rule stops the parsing
+	max_call_depth       int                          // the maximum depth of the state stack, MAX_CALL_DEPTH if 0
+	trace                io.Writer                    // receives the rules matched by each line, if set
+	window               int                          // the number of lines matched by the longest rule
+}
+
+// maxCallDepth() returns the maximum depth of the state stack
+func (t *Template) maxCallDepth() int {
+	if t.max_call_depth <= 0 {
+		return MAX_CALL_DEPTH
+	}
+	return t.max_call_depth
+}
+
+// returnsFrom(string) tells if a Return can be reached from the given state, following the
+// changes of state. The states called or entered as blocks from there are left out, as
+// they return there.
+func (t *Template) returnsFrom(state string) bool {
+	visited := map[string]bool{state: true}
+	to_visit := []string{state}
+	for len(to_visit) > 0 {
+		state := to_visit[0]
+		to_visit = to_visit[1:]
+		for _, r := range t.rules[state] {
+			if r.state_op == RETURN_STATE_OP {
+				return true
+			}
+			if r.state_op == CALL_STATE_OP || r.state_op == BLOCK_STATE_OP || r.new_state == "" || visited[r.new_state] {
+				continue
+			}
+			visited[r.new_state] = true
+			to_visit = append(to_visit, r.new_state)
+		}
+	}
+	return false
+}
+
+// validateFSM() checks if the defined FSM is valid and returns the TemplateErrors found,
+// if any
+func (t *Template) validateFSM() error {
+	errs := TemplateErrors{}
+	fsmError := func(line_no int, token string, format string, args ...interface{}) {
+		errs = append(errs, &TemplateError{
+			Line:     line_no,
+			Token:    token,
+			Severity: SEVERITY_ERROR,
+			Msg:      "invalid FSM: " + fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Check that the Start state is always present
+	if _, present := t.rules[START_STATE]; !present {
+		fsmError(0, START_STATE, "'%s' should always be present", START_STATE)
+	}
+
+	// Check that End and EOF state are always empty
+	// when explicitly declared
+	for _, s := range STOP_STATES {
+		if rules, present := t.rules[s]; present && len(rules) > 0 {
+			fsmError(rules[0].line_no, s, "State '%s', if declared, should be empty", s)
+		}
+	}
+
+	// The field holding the key of the records cannot be shadowed by a value
+	if value, present := t.values[KEY_FIELD]; present && t.key_mode != KEY_IGNORE {
+		fsmError(value.line_no, KEY_FIELD, "value '%s' is reserved for the key of the records", KEY_FIELD)
+	}
+
+	// Check that the pointers to states are all valid
+	for _, state := range t.state_names {
+		for _, r := range t.rules[state] {
+			// End or EOF are implicit states, no need to check if they have been declared
+			if r.new_state == "End" || r.new_state == "EOF" || r.new_state == "" {
+				continue
+			}
+
+			// Check if the new state is valid
+			if _, present := t.rules[r.new_state]; !present {
+				fsmError(r.line_no, r.new_state, "Pointer to unknown state '%s' in rules of state %s",
+					r.new_state,
+					state)
+			}
+		}
+	}
+
+	// Check that the states reached by Call can go back to the calling state, the blocks are
+	// left when the indentation decreases
+	for _, state := range t.state_names {
+		for _, r := range t.rules[state] {
+			if r.state_op != CALL_STATE_OP && r.state_op != BLOCK_STATE_OP {
+				continue
+			}
+			if slices.Contains(STOP_STATES, r.new_state) {
+				fsmError(r.line_no, r.new_state, "State '%s' cannot be reached by %s", r.new_state, r.state_op)
+			} else if _, present := t.rules[r.new_state]; present && r.state_op == CALL_STATE_OP && !t.returnsFrom(r.new_state) {
+				fsmError(r.line_no, r.new_state, "State '%s' is reached by %s in state %s, but it has no path to a %s",
+					r.new_state, CALL_STATE_OP, state, RETURN_STATE_OP)
+			}
+		}
+	}
+
+	return errs.asError()
+}
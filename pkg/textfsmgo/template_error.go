@@ -0,0 +1,175 @@
+package textfsmgo
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/claudiolor/textfsmgo/pkg/pyregex"
+)
+
+// TemplateError describes a problem found in a template. It can be retrieved with
+// errors.As() from the errors returned by the constructors of the parser.
+type TemplateError struct {
+	File     string   `json:"file"`     // the source of the template
+	Line     int      `json:"line"`     // the line of the template, starting from 1, zero when not related to a line
+	Column   int      `json:"column"`   // the byte column in the line, starting from 1, zero when unknown
+	Token    string   `json:"token"`    // the offending token, if any
+	Severity Severity `json:"severity"` // tells if the problem makes the template invalid
+	Code     string   `json:"code"`     // the kind of problem, set by the linter
+	Msg      string   `json:"message"`  // the description of the problem
+	Err      error    `json:"-"`        // the underlying error, e.g. the regex compile error
+}
+
+func (e *TemplateError) Error() string {
+	var res strings.Builder
+	if e.File != "" {
+		res.WriteString(e.File + ": ")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&res, "%s in line %d", e.Severity, e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&res, ", column %d", e.Column)
+		}
+		res.WriteString(": ")
+	}
+	res.WriteString(e.Msg)
+	return res.String()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateErrors collects all the problems found in a template, so that they can be fixed
+// at once
+type TemplateErrors []*TemplateError
+
+func (e TemplateErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap() returns the single errors, so that errors.As() can find them
+func (e TemplateErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// asError() returns the collected errors as an error, nil if there are none
+func (e TemplateErrors) asError() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// setFile(string) sets the source of the template in all the errors
+func (e TemplateErrors) setFile(file string) {
+	for _, err := range e {
+		err.File = file
+	}
+}
+
+// lineError(int, int, string, string, ...interface{}) creates an error about the last
+// parsed line of the template, the offset is the position of the token in the line
+// stripped of its indentation
+func (t *Template) lineError(line_no int, offset int, token string, format string, args ...interface{}) *TemplateError {
+	return &TemplateError{
+		Line:     line_no,
+		Column:   t.template_line_indent + offset + 1,
+		Token:    token,
+		Severity: SEVERITY_ERROR,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// tokenError(int, string, string, string, ...interface{}) creates an error about the
+// last parsed line of the template, pointing out the first occurrence of the token in it
+func (t *Template) tokenError(line_no int, line string, token string, format string, args ...interface{}) *TemplateError {
+	offset := 0
+	if token != "" {
+		if i := strings.Index(line, token); i != -1 {
+			offset = i
+		}
+	}
+	return t.lineError(line_no, offset, token, format, args...)
+}
+
+// regexError(error, string) returns the offset in the regex where the compile error has
+// been detected, -1 when it is unknown, and the offending part of the regex. Some RE2
+// errors carry the whole regex, the unbalanced parenthesis is looked for instead.
+func regexError(err error, expr string) (int, string) {
+	var py_err *pyregex.Error
+	var re2_err *syntax.Error
+	switch {
+	case errors.As(err, &py_err):
+		return py_err.Pos, expr[min(py_err.Pos, len(expr)):]
+	case errors.As(err, &re2_err):
+		switch re2_err.Code {
+		case syntax.ErrMissingParen, syntax.ErrUnexpectedParen:
+			if pos := unbalancedParen(expr, re2_err.Code); pos != -1 {
+				return pos, expr[pos:]
+			}
+		case syntax.ErrLarge, syntax.ErrNestingDepth, syntax.ErrInvalidUTF8:
+			// The error is about the regex as a whole
+		default:
+			if re2_err.Expr != "" {
+				return strings.Index(expr, re2_err.Expr), re2_err.Expr
+			}
+		}
+	}
+	return -1, expr
+}
+
+// unbalancedParen(string, syntax.ErrorCode) returns the offset of the innermost parenthesis
+// left open, for ErrMissingParen, or of the first one closing no group, for
+// ErrUnexpectedParen. The escaped parentheses and the ones in the character classes are
+// skipped. The function returns -1 if there is no such parenthesis.
+func unbalancedParen(expr string, code syntax.ErrorCode) int {
+	open := []int{}
+	in_class := false
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == '\\':
+			i++
+		case in_class:
+			in_class = c != ']'
+		case c == '[':
+			in_class = true
+			// The negation and a leading ] do not close the class
+			if i+1 < len(expr) && expr[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(expr) && expr[i+1] == ']' {
+				i++
+			}
+		case c == '(':
+			open = append(open, i)
+		case c == ')' && len(open) == 0:
+			if code == syntax.ErrUnexpectedParen {
+				return i
+			}
+		case c == ')':
+			open = open[:len(open)-1]
+		}
+	}
+	if code == syntax.ErrMissingParen && len(open) > 0 {
+		return open[len(open)-1]
+	}
+	return -1
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,162 @@
+package textfsmgo
+
+import (
+	"errors"
+	"regexp/syntax"
+	"strings"
+	"testing"
+
+	"github.com/claudiolor/textfsmgo/pkg/pyregex"
+)
+
+const invalidTemplate = `Value Required,Bogus other (\S+)
+Value port ((\d+)
+Value name (\S+)
+Value port2 (\d+)
+
+Start
+  ^${name} ${missing} -> Record
+  ^${port2} ([a-z -> Record
+  ^x -> Next Nowhere
+`
+
+func TestTemplateErrors(t *testing.T) {
+	var errorTestCases = []struct {
+		description string
+		opts        []ParserOption
+		exp_errs    []TemplateError
+	}{
+		{
+			description: "Test all errors reported",
+			exp_errs: []TemplateError{
+				{Line: 1, Column: 16, Token: "Bogus"},
+				{Line: 2, Column: 12, Token: `((\d+)`},
+				{Line: 7, Column: 12, Token: "${missing}"},
+				{Line: 8, Column: 14, Token: "[a-z"},
+				{Line: 9, Column: 0, Token: "Nowhere"},
+			},
+		},
+		{
+			description: "Test regex errors mapped with the Python engine",
+			opts:        []ParserOption{WithRegexEngine(PythonRegexEngine{})},
+			exp_errs: []TemplateError{
+				{Line: 1, Column: 16, Token: "Bogus"},
+				{Line: 2, Column: 12, Token: `((\d+)`},
+				{Line: 7, Column: 12, Token: "${missing}"},
+				{Line: 8, Column: 14, Token: "[a-z"},
+				{Line: 9, Column: 0, Token: "Nowhere"},
+			},
+		},
+	}
+
+	for _, tc := range errorTestCases {
+		t.Log(tc.description)
+		_, err := NewTextFSMParserFromString(invalidTemplate, tc.opts...)
+
+		var errs TemplateErrors
+		if !errors.As(err, &errs) {
+			t.Errorf("Error in '%s': expected TemplateErrors, got '%v'", tc.description, err)
+			continue
+		}
+		if len(errs) != len(tc.exp_errs) {
+			t.Errorf("Error in '%s': expected %d errors, got %d: %s", tc.description, len(tc.exp_errs), len(errs), err)
+			continue
+		}
+
+		for i, exp := range tc.exp_errs {
+			got := errs[i]
+			if got.File != STRING_SOURCE || got.Line != exp.Line || got.Column != exp.Column ||
+				got.Token != exp.Token || got.Severity != SEVERITY_ERROR {
+				t.Errorf("Error in '%s': expected error %d in line %d, column %d, token '%s', got %+v",
+					tc.description, i, exp.Line, exp.Column, exp.Token, got)
+			}
+		}
+	}
+}
+
+func TestTemplateErrorUnwrap(t *testing.T) {
+	_, err := NewTextFSMParserFromString("Value name ([a-z)\n\nStart\n  ^foo\n")
+
+	// The first error can be retrieved directly
+	var tmpl_err *TemplateError
+	if !errors.As(err, &tmpl_err) || tmpl_err.Line != 1 {
+		t.Fatalf("Error in 'Test errors.As': expected a TemplateError in line 1, got '%v'", err)
+	}
+
+	// The error of the regex engine is kept
+	var re2_err *syntax.Error
+	if !errors.As(err, &re2_err) || re2_err.Code != syntax.ErrMissingBracket {
+		t.Errorf("Error in 'Test regex error': expected missing bracket error, got '%v'", err)
+	}
+
+	_, err = NewTextFSMParserFromString("Value name ([a-z)\n\nStart\n  ^foo\n",
+		WithRegexEngine(PythonRegexEngine{}))
+	var py_err *pyregex.Error
+	if !errors.As(err, &py_err) {
+		t.Errorf("Error in 'Test Python regex error': expected pyregex error, got '%v'", err)
+	}
+
+	exp_msg := "<string>: error in line 1, column 13: invalid regex error parsing regexp: " +
+		"missing closing ]: `[a-z)`"
+	if _, err = NewTextFSMParserFromString("Value name ([a-z)\n\nStart\n  ^foo\n"); err.Error() != exp_msg {
+		t.Errorf("Error in 'Test error message': expected '%s', got '%s'", exp_msg, err)
+	}
+}
+
+func TestRegexErrorColumns(t *testing.T) {
+	var columnTestCases = []struct {
+		description string
+		template    string
+		exp_column  int
+		python      bool
+	}{
+		{
+			description: "Test missing closing parenthesis in a rule",
+			template:    "Value name (\\S+)\n\nStart\n  ^foo ${name} (bar -> Record\n",
+			exp_column:  16,
+			python:      true,
+		},
+		{
+			description: "Test innermost parenthesis left open",
+			template:    "Value name (\\S+)\n\nStart\n  ^(foo ${name} (bar)(\\d+ -> Record\n",
+			exp_column:  22,
+			python:      true,
+		},
+		{
+			description: "Test unexpected closing parenthesis in a rule",
+			template:    "Value name (\\S+)\n\nStart\n  ^foo ${name} [)]bar) -> Record\n",
+			exp_column:  22,
+			python:      true,
+		},
+		{
+			description: "Test missing closing parenthesis in a value",
+			template:    "Value name (a(\\(b)\n\nStart\n  ^foo\n",
+			exp_column:  12,
+			python:      true,
+		},
+		{
+			description: "Test error about the whole regex",
+			template: "Value name (\\S+)\n\nStart\n  ^${name} " + strings.Repeat("(", 1001) + "a" +
+				strings.Repeat(")", 1001) + " -> Record\n",
+			exp_column: 0,
+		},
+	}
+
+	for _, tc := range columnTestCases {
+		engines := []ParserOption{WithRegexEngine(RE2Engine{})}
+		if tc.python {
+			engines = append(engines, WithRegexEngine(PythonRegexEngine{}))
+		}
+		for _, engine := range engines {
+			_, err := NewTextFSMParserFromString(tc.template, engine)
+			var errs TemplateErrors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Errorf("Error in '%s': expected a TemplateError, got '%v'", tc.description, err)
+				continue
+			}
+			if errs[0].Column != tc.exp_column {
+				t.Errorf("Error in '%s': expected column %d, got '%s'", tc.description, tc.exp_column, errs[0])
+			}
+		}
+	}
+}
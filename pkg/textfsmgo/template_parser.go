@@ -3,9 +3,10 @@ package textfsmgo
 import (
 	"bufio"
 	"fmt"
-	"os"
+	"io"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/claudiolor/textfsmgo/pkg/utils"
 	"golang.org/x/exp/slices"
@@ -17,79 +18,209 @@ const VALUE_FORMAT = "Value VARNAME [Flags, comma separated (no spaces)] (regex
 // regex for matching the name of a state
 var STATE_NAME_REGEX = regexp.MustCompile(`^\w+$`)
 
+// Separator of the lines matched by a multi-line rule, e.g. ^${name} is up\n^  MTU ${mtu}
+const RULE_LINE_SEPARATOR = `\n^`
+
 // regex for matching the rule
 var RULE_REGEX = regexp.MustCompile(`(?P<match>.*)\s->(?P<action>.*)`)
 
-// regex for matching a variable in a rule
-var VARIABLE_REGEX = regexp.MustCompile(`\${\w+}`)
+// regex for splitting a Value line in the first token and the rest of the line, tokens
+// can be separated by any number of spaces or tabs
+var VALUE_LINE_REGEX = regexp.MustCompile(`^Value\s+(\S+)\s+(.+)$`)
+
+// regex for splitting the rest of a Value line with options in the name and the regex
+var VALUE_NAME_REGEX = regexp.MustCompile(`^(\S+)\s+(.+)$`)
+
+// regex for validating the name of a value
+var VALUE_NAME_VALID_REGEX = regexp.MustCompile(`^\w+$`)
 
-// regex for matching a new state action in a rule
-var STATE_ACTION_REGEX_STR = `(?P<newstate>\w+)`
+// Max length of the name of a value, as in Python TextFSM
+const MAX_NAME_LEN = 48
+
+// regex for matching a variable in a rule, as Python string.Template does: $$ is an
+// escaped dollar, $name and ${name} are variables. A ${ not forming a valid variable
+// is matched with no groups.
+var VARIABLE_REGEX = regexp.MustCompile(`\$(?:(\$)|([_a-zA-Z]\w*)|\{(\w+)\}|\{)`)
+
+// regex for matching a new state action in a rule, the state can be called, entered as a
+// block or it can be Return, to go back to the calling state
+var STATE_ACTION_REGEX_STR = `(?:(?P<stateop>Call|Block)\s+)?(?P<newstate>\w+)`
 
 // regex for matching a record operation actions defined in a rule
 var LINE_REC_ACTION_REGEX = regexp.MustCompile(
-	fmt.Sprintf(`^(?P<lineop>%s)(\.(?P<recop>%s))?(\s+%s)?$`,
+	fmt.Sprintf(`^(?P<lineop>%s)(\.(?P<recop>%s)(?:\[(?P<child>\w+)\])?(?:\s+(?P<table>\w+))?)?(\s+%s)?$`,
 		strings.Join(LINE_OP, "|"),
-		strings.Join(RECORD_OP, "|"),
+		strings.Join(append(append([]string{}, RECORD_OP...), QUALIFIED_RECORD_OP...), "|"),
 		STATE_ACTION_REGEX_STR,
 	),
 )
 
 // regex for matching a line operation actions defined in a rule
 var REC_ACTION_REGEX = regexp.MustCompile(
-	fmt.Sprintf(`^(?P<recop>%s)(\s+%s)?$`,
+	fmt.Sprintf(`^(?P<recop>%s)(?:\[(?P<child>\w+)\])?(?:\s+(?P<table>\w+))?(\s+%s)?$`,
 		strings.Join(RECORD_OP, "|"),
 		STATE_ACTION_REGEX_STR,
 	),
 )
 
-// regex for matching an error action in a rule
-var ERROR_ACTION_REGEX = regexp.MustCompile(`^Error(?: (\".*\"|\w+))?$`)
+// regex for matching an error action in a rule, the record operation is accepted as
+// Python TextFSM does, but it has no effect
+var ERROR_ACTION_REGEX = regexp.MustCompile(
+	fmt.Sprintf(`^Error(?:\.(?:%s))?(?:\s+(\".*\"|\w+))?$`, strings.Join(RECORD_OP, "|")),
+)
 
 // regex for matching the change of state in a rule
 var STATE_ACTION_REGEX = regexp.MustCompile(
 	fmt.Sprintf(`^%s$`, STATE_ACTION_REGEX_STR),
 )
 
+// compileRegex(string) compiles the given regex with the regex engine of the parser,
+// RE2 is used when no engine has been set
+func (t *Template) compileRegex(expr string) (Matcher, error) {
+	if t.regex_engine == nil {
+		return RE2Engine{}.Compile(expr)
+	}
+	return t.regex_engine.Compile(expr)
+}
+
 func isComment(line *string) bool {
 	return strings.HasPrefix(*line, "#")
 }
 
 // getNextLine(*bufio.Scanner) given a scanner returns the next line in the buffer, the
-// number of the current line and its length
-func (t *TextFSM) getNextLine(t_file_scanner *bufio.Scanner) (string, int, int) {
+// number of the current line and its length. The indentation of the line is stripped
+// and remembered, so that the errors can point out the right column.
+func (t *Template) getNextLine(t_file_scanner *bufio.Scanner) (string, int, int) {
 	t.template_parsed_line += 1
 	line_no := t.template_parsed_line
-	current_line := strings.TrimSpace(t_file_scanner.Text())
+	raw_line := strings.TrimRightFunc(t_file_scanner.Text(), unicode.IsSpace)
+	current_line := strings.TrimLeftFunc(raw_line, unicode.IsSpace)
+	t.template_line_indent = len(raw_line) - len(current_line)
 	return current_line, line_no, len(current_line)
 }
 
-// parseTemplateFile(string) given the path of a template file it parses the file and
-// builds the TextFSM data structure
-func (t *TextFSM) parseTemplateFile(template_file string) error {
-	t_file, err := os.Open(template_file)
-	if err != nil {
-		return err
-	}
-	defer t_file.Close()
-
-	t_file_scanner := bufio.NewScanner(t_file)
+// parseTemplate(io.Reader) reads a template from the given reader, parses it and builds
+// the TextFSM data structure. The parsing goes on after an error, so that all the
+// problems of the template are reported at once as TemplateErrors.
+func (t *Template) parseTemplate(template io.Reader) error {
+	t_file_scanner := bufio.NewScanner(template)
+	errs := TemplateErrors{}
 	if err := t.parseTemplateFileValues(t_file_scanner); err != nil {
-		return err
+		errs = append(errs, err.(TemplateErrors)...)
 	}
 
 	if err := t.parseTemplateFileStates(t_file_scanner); err != nil {
-		return err
+		errs = append(errs, err.(TemplateErrors)...)
 	}
 
-	return nil
+	// The scanner stops silently on read errors, make sure they are reported
+	if err := t_file_scanner.Err(); err != nil {
+		return fmt.Errorf("error reading the template: %w", err)
+	}
+
+	return errs.asError()
+}
+
+// regexSegment maps a piece of a rule regex, after the substitution of the variables, to
+// the position of the rule it comes from
+type regexSegment struct {
+	expanded int  // offset of the piece in the regex with the variables substituted
+	original int  // offset of the piece in the rule
+	variable bool // tells if the piece comes from a variable, or from the rule itself
+}
+
+// originalOffset([]regexSegment, int) maps an offset in the regex with the variables
+// substituted to the offset in the rule. The offsets inside the regex of a variable are
+// mapped to the variable.
+func originalOffset(segments []regexSegment, offset int) int {
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i].expanded > offset {
+			continue
+		}
+		if segments[i].variable {
+			return segments[i].original
+		}
+		return segments[i].original + offset - segments[i].expanded
+	}
+	return offset
+}
+
+// substituteVariables(string, int) replaces the variables of a rule with the regex of the
+// corresponding values, following the syntax of Python string.Template: $$ is a literal
+// dollar, $name and ${name} are variables. Unlike Python, a $ not followed by a name is
+// kept as is, so it can be used as end-of-line anchor. The function returns the
+// segments mapping the resulting regex to the rule, too.
+func (t *Template) substituteVariables(regex_str string, line_no int) (string, []regexSegment, *TemplateError) {
+	var res strings.Builder
+	segments := []regexSegment{{}}
+	last := 0
+	for _, loc := range VARIABLE_REGEX.FindAllStringSubmatchIndex(regex_str, -1) {
+		res.WriteString(regex_str[last:loc[0]])
+		segments = append(segments, regexSegment{expanded: res.Len(), original: loc[0], variable: true})
+		last = loc[1]
+		token := regex_str[loc[0]:loc[1]]
+
+		var name string
+		switch {
+		case loc[2] != -1:
+			res.WriteByte('$')
+		case loc[4] != -1:
+			name = regex_str[loc[4]:loc[5]]
+		case loc[6] != -1:
+			name = regex_str[loc[6]:loc[7]]
+		default:
+			return "", nil, t.lineError(line_no, loc[0], token, "invalid variable substitution in %s", regex_str)
+		}
+
+		if name != "" {
+			value, found := t.values[name]
+			if !found {
+				return "", nil, t.lineError(line_no, loc[0], token, "unknown variable %s in %s", token, regex_str)
+			}
+			if value.expr != nil {
+				return "", nil, t.lineError(line_no, loc[0], token,
+					"%s value %s cannot be used in the rules", COMPUTED_OPTION, name)
+			}
+			res.WriteString(value.regex)
+		}
+		segments = append(segments, regexSegment{expanded: res.Len(), original: loc[1]})
+	}
+	res.WriteString(regex_str[last:])
+	return res.String(), segments, nil
+}
+
+// ruleLine is the regex matching a line of a multi-line rule
+type ruleLine struct {
+	regex  string // the regex of the line, starting with ^
+	offset int    // the offset of the regex in the regex of the whole rule
+}
+
+// splitRuleLines(string) splits the regex of a rule in the regexes of the lines it
+// matches, separated by RULE_LINE_SEPARATOR. A backslash escaped by another one does not
+// start a separator.
+func splitRuleLines(regex_str string) []ruleLine {
+	lines := []ruleLine{}
+	start := 0
+	for i := 0; i < len(regex_str); i++ {
+		if regex_str[i] != '\\' {
+			continue
+		}
+		if strings.HasPrefix(regex_str[i:], RULE_LINE_SEPARATOR) {
+			lines = append(lines, ruleLine{regex: regex_str[start:i], offset: start})
+			// The next line starts with the ^ of the separator
+			start = i + len(RULE_LINE_SEPARATOR) - 1
+		}
+		i++ // skip the escaped char
+	}
+	return append(lines, ruleLine{regex: regex_str[start:], offset: start})
 }
 
 // parseStateRules(string, *bufio.Scanner) given a string containing the state name,
 // extract the rules related to that state by reading the template file. The function
-// returns an error if the template file is not valid.
-func (t *TextFSM) parseStateRules(state_name string, t_file_scanner *bufio.Scanner) error {
+// returns the TemplateErrors found in the rules, if any.
+func (t *Template) parseStateRules(state_name string, t_file_scanner *bufio.Scanner) error {
 	t.rules[state_name] = []TextFSMRule{}
+	errs := TemplateErrors{}
 	for t_file_scanner.Scan() {
 		current_line, line_no, line_size := t.getNextLine(t_file_scanner)
 		if line_size == 0 {
@@ -102,36 +233,59 @@ func (t *TextFSM) parseStateRules(state_name string, t_file_scanner *bufio.Scann
 			continue
 		}
 
-		new_rule := TextFSMRule{}
-
-		if !strings.HasPrefix(current_line, "^") {
-			return fmt.Errorf("error in line %d: missing ^ in rule definition", line_no)
+		new_rule, err := t.parseRule(state_name, current_line, line_no)
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
+		t.rules[state_name] = append(t.rules[state_name], new_rule)
+		if lines := 1 + len(new_rule.next_regexes); lines > t.window {
+			t.window = lines
+		}
+	}
+	return errs.asError()
+}
 
-		rule_match := RULE_REGEX.FindStringSubmatch(current_line)
-		regex_str := current_line
-		actions_str := ""
+// parseRule(string, string, int) parses a rule of the given state
+func (t *Template) parseRule(state_name string, current_line string, line_no int) (TextFSMRule, *TemplateError) {
+	new_rule := TextFSMRule{line_no: line_no}
 
-		if len(rule_match) != 0 {
-			regex_str = rule_match[1]
-			actions_str = strings.TrimSpace(rule_match[2])
-		}
+	if !strings.HasPrefix(current_line, "^") {
+		return new_rule, t.lineError(line_no, 0, current_line, "missing ^ in rule definition")
+	}
 
-		// Replace the variables in the regex
-		variables := VARIABLE_REGEX.FindAllString(regex_str, -1)
-		for _, v := range variables {
-			var_reg, found := t.values[v[2:len(v)-1]]
-			if !found {
-				return fmt.Errorf(
-					"error in line %d: unknown variable %s in %s", line_no, v, current_line)
-			}
-			regex_str = strings.Replace(regex_str, v, var_reg.regex, -1)
-		}
+	rule_match := RULE_REGEX.FindStringSubmatchIndex(current_line)
+	regex_str := current_line
+	actions_str := ""
+	actions_offset := 0
+
+	if rule_match != nil {
+		regex_str = current_line[rule_match[2]:rule_match[3]]
+		actions_str = strings.TrimSpace(current_line[rule_match[4]:rule_match[5]])
+		actions_offset = strings.Index(current_line[rule_match[4]:], actions_str) + rule_match[4]
+	}
+
+	// Replace the variables in the regex
+	regex_str, segments, tmpl_err := t.substituteVariables(regex_str, line_no)
+	if tmpl_err != nil {
+		return new_rule, tmpl_err
+	}
 
+	// A multi-line rule has a regex for each line it matches
+	for i, rule_line := range splitRuleLines(regex_str) {
 		// Compile the regex and check its validity
-		regex, err := regexp.Compile(regex_str)
+		regex, err := t.compileRegex(rule_line.regex)
 		if err != nil {
-			return fmt.Errorf("error in line %d: invalid regex %s", line_no, err)
+			offset, token := regexError(err, rule_line.regex)
+			tmpl_err := t.lineError(line_no, 0, token, "invalid regex %s", err)
+			if offset != -1 {
+				tmpl_err = t.lineError(line_no, originalOffset(segments, rule_line.offset+offset), token, "invalid regex %s", err)
+			} else {
+				// Better no column than a wrong one
+				tmpl_err.Column = 0
+			}
+			tmpl_err.Err = err
+			return new_rule, tmpl_err
 		}
 
 		// Check that the rule regex does not contain any named match groups,
@@ -139,81 +293,148 @@ func (t *TextFSM) parseStateRules(state_name string, t_file_scanner *bufio.Scann
 		for _, mgroup_name := range regex.SubexpNames() {
 			if mgroup_name != "" {
 				if _, present := t.values[mgroup_name]; !present {
-					return fmt.Errorf(
-						"error in line %d: named match groups are not allowed in rule strings, use values instead",
-						line_no)
+					return new_rule, t.tokenError(line_no, current_line, "(?P<"+mgroup_name+">",
+						"named match groups are not allowed in rule strings, use values instead")
 				}
 			}
 		}
 
-		new_rule.regex = regex
-
-		// Parse the actions if provided
-		var actions map[string]string
-		if actions_str != "" {
-			// Parse all the possible combinations of actions formats
-			if submatch := LINE_REC_ACTION_REGEX.FindStringSubmatch(actions_str); submatch != nil {
-				actions = utils.GetRegexpNamedGroups(LINE_REC_ACTION_REGEX, submatch)
-			} else if submatch := REC_ACTION_REGEX.FindStringSubmatch(actions_str); submatch != nil {
-				actions = utils.GetRegexpNamedGroups(REC_ACTION_REGEX, submatch)
-			} else if submatch := ERROR_ACTION_REGEX.FindStringSubmatch(actions_str); submatch != nil {
-				actions = make(map[string]string)
-				if submatch[1] != "" {
-					new_rule.error_str = submatch[1]
-				} else {
-					new_rule.error_str = "NoMessage"
-				}
-			} else if submatch := STATE_ACTION_REGEX.FindStringSubmatch(actions_str); submatch != nil {
-				actions = utils.GetRegexpNamedGroups(STATE_ACTION_REGEX, submatch)
-			} else {
-				return fmt.Errorf(
-					"error in line %d: badly formatted rule in %s", line_no, current_line)
-			}
+		if i == 0 {
+			new_rule.regex = regex
+		} else {
+			new_rule.next_regexes = append(new_rule.next_regexes, regex)
+		}
+	}
 
-			// Store all the actions
-			if line_op, present := actions["lineop"]; present {
-				new_rule.line_op = LineOperation(line_op)
-			}
+	// The guard follows the actions, if any
+	if actions, guard, guard_offset := splitGuard(actions_str); guard != "" {
+		new_rule.guard, tmpl_err = t.parseGuard(guard, line_no, actions_offset+guard_offset)
+		if tmpl_err != nil {
+			return new_rule, tmpl_err
+		}
+		actions_str = actions
+	}
 
-			if rec_op, present := actions["recop"]; present {
-				new_rule.rec_op = RecordOperation(rec_op)
-			}
+	// Parse the actions if provided
+	if actions_str == "" {
+		return new_rule, nil
+	}
 
-			if new_state, present := actions["newstate"]; present {
-				// Return an error for circular references, they have no effects but it is a signal
-				// of a user error. Better pointing it out
-				if state_name == new_state {
-					return fmt.Errorf(
-						"error in line %d: circular pointer to new state %s in %s",
-						line_no,
-						new_state,
-						current_line)
-				}
+	// Parse all the possible combinations of actions formats
+	var actions map[string]string
+	if submatch := LINE_REC_ACTION_REGEX.FindStringSubmatch(actions_str); submatch != nil {
+		actions = utils.GetRegexpNamedGroups(LINE_REC_ACTION_REGEX, submatch)
+	} else if submatch := REC_ACTION_REGEX.FindStringSubmatch(actions_str); submatch != nil {
+		actions = utils.GetRegexpNamedGroups(REC_ACTION_REGEX, submatch)
+	} else if submatch := ERROR_ACTION_REGEX.FindStringSubmatch(actions_str); submatch != nil {
+		actions = make(map[string]string)
+		if submatch[1] != "" {
+			// The quotes only delimit the message
+			new_rule.error_str = strings.TrimSuffix(strings.TrimPrefix(submatch[1], `"`), `"`)
+		} else {
+			new_rule.error_str = "NoMessage"
+		}
+	} else if submatch := STATE_ACTION_REGEX.FindStringSubmatch(actions_str); submatch != nil {
+		actions = utils.GetRegexpNamedGroups(STATE_ACTION_REGEX, submatch)
+	} else {
+		return new_rule, t.lineError(line_no, actions_offset, actions_str,
+			"badly formatted rule in %s", current_line)
+	}
 
-				new_rule.new_state = new_state
-			}
+	// Store all the actions
+	if line_op, present := actions["lineop"]; present {
+		new_rule.line_op = LineOperation(line_op)
+	}
 
-			// Validate the provided actions
-			// A new state can be provided only with the Next line operation
-			if new_rule.line_op != "" &&
-				new_rule.line_op != NEXT_LINE_OP &&
-				new_rule.new_state != "" {
-				return fmt.Errorf(
-					"error in line %d: a new state cannot be specified with line operation %s in %s",
-					line_no,
-					new_rule.line_op,
-					current_line)
-			}
+	if rec_op, present := actions["recop"]; present {
+		new_rule.rec_op = RecordOperation(rec_op)
+	}
+
+	// The record operation can name a table, e.g. Record summary: with no table having that
+	// name the word is the new state, or the Call preceding it
+	if table := actions["table"]; table != "" {
+		offset := actions_offset + strings.Index(actions_str, " "+table) + 1
+		switch {
+		case (table == CALL_STATE_OP || table == BLOCK_STATE_OP) && actions["newstate"] != "":
+			actions["stateop"] = table
+		case !t.isTable(table) && actions["newstate"] == "":
+			actions["newstate"] = table
+		case !t.isTable(table):
+			return new_rule, t.lineError(line_no, offset, table, "unknown table %s in %s", table, current_line)
+		case new_rule.rec_op != RECORD_REC_OP && new_rule.rec_op != CLEAR_REC_OP:
+			return new_rule, t.lineError(line_no, offset, table,
+				"the %s operation cannot be applied to a table in %s", new_rule.rec_op, current_line)
+		case actions["child"] != "":
+			return new_rule, t.lineError(line_no, offset, table,
+				"the operations on a child record set cannot name a table in %s", current_line)
+		default:
+			new_rule.table = table
 		}
-		t.rules[state_name] = append(t.rules[state_name], new_rule)
 	}
-	return nil
+
+	// The record operation can apply to a child record set, e.g. Record[interfaces]
+	if child := actions["child"]; child != "" {
+		offset := actions_offset + strings.Index(actions_str, "["+child+"]") + 1
+		if new_rule.rec_op != RECORD_REC_OP && new_rule.rec_op != CLEAR_REC_OP {
+			return new_rule, t.lineError(line_no, offset, child,
+				"the %s operation cannot be applied to a child record set in %s", new_rule.rec_op, current_line)
+		}
+		if !t.isChildSet(child) {
+			return new_rule, t.lineError(line_no, offset, child, "unknown child record set %s in %s", child, current_line)
+		}
+		new_rule.child = child
+	}
+
+	if new_state, present := actions["newstate"]; present {
+		switch {
+		case new_state == CALL_STATE_OP || (new_state == RETURN_STATE_OP && actions["stateop"] == CALL_STATE_OP):
+			return new_rule, t.lineError(line_no, actions_offset+strings.LastIndex(actions_str, new_state),
+				new_state, "the %s action requires the state to call in %s", CALL_STATE_OP, current_line)
+		case new_state == BLOCK_STATE_OP || (new_state == RETURN_STATE_OP && actions["stateop"] == BLOCK_STATE_OP):
+			return new_rule, t.lineError(line_no, actions_offset+strings.LastIndex(actions_str, new_state),
+				new_state, "the %s action requires the state to enter in %s", BLOCK_STATE_OP, current_line)
+		case new_state == RETURN_STATE_OP:
+			new_rule.state_op = RETURN_STATE_OP
+			new_state = ""
+		case actions["stateop"] != "":
+			// A state can call itself, as the depth of the stack is bounded
+			new_rule.state_op = StateOperation(actions["stateop"])
+		case state_name == new_state:
+			// Return an error for circular references, they have no effects but it is a signal
+			// of a user error. Better pointing it out
+			return new_rule, t.lineError(line_no, actions_offset+strings.LastIndex(actions_str, new_state),
+				new_state, "circular pointer to new state %s in %s", new_state, current_line)
+		}
+
+		new_rule.new_state = new_state
+	}
+
+	// Validate the provided actions
+	// The lines matched by a multi-line rule are consumed together, so they cannot be
+	// matched again by the following rules
+	if len(new_rule.next_regexes) > 0 && new_rule.line_op == CONTINUE_LINE_OP {
+		return new_rule, t.lineError(line_no, actions_offset, actions_str,
+			"a multi-line rule cannot be used with line operation %s in %s", CONTINUE_LINE_OP, current_line)
+	}
+
+	// A new state can be provided only with the Next line operation
+	if new_rule.line_op != "" &&
+		new_rule.line_op != NEXT_LINE_OP &&
+		(new_rule.new_state != "" || new_rule.state_op != "") {
+		return new_rule, t.lineError(line_no, actions_offset, actions_str,
+			"a new state cannot be specified with line operation %s in %s", new_rule.line_op, current_line)
+	}
+	return new_rule, nil
 }
 
 // parseTemplateFileStates(*bufio.Scanner) parses the state section of a template file.
-// The function returns an error if the file is invalid.
-func (t *TextFSM) parseTemplateFileStates(t_file_scanner *bufio.Scanner) error {
+// The function returns the TemplateErrors found in the states, if any.
+func (t *Template) parseTemplateFileStates(t_file_scanner *bufio.Scanner) error {
 	t.rules = map[string][]TextFSMRule{}
+	t.state_names = []string{}
+	t.state_lines = map[string]int{}
+	t.window = 1
+	errs := TemplateErrors{}
 	for t_file_scanner.Scan() {
 		current_line, line_no, line_size := t.getNextLine(t_file_scanner)
 
@@ -225,23 +446,37 @@ func (t *TextFSM) parseTemplateFileStates(t_file_scanner *bufio.Scanner) error {
 		if !STATE_NAME_REGEX.MatchString(current_line) ||
 			slices.Contains(LINE_OP, current_line) ||
 			slices.Contains(RECORD_OP, current_line) ||
+			slices.Contains(STATE_OP, current_line) ||
 			slices.Contains(WITH_ARGUMENT_OP, current_line) {
-			return fmt.Errorf("error in line %d: invalid state name %s", line_no, current_line)
+			// Go on parsing the rules anyway, to find their errors too
+			errs = append(errs, t.lineError(line_no, 0, current_line, "invalid state name %s", current_line))
+		} else if _, present := t.rules[current_line]; present {
+			errs = append(errs, t.lineError(line_no, 0, current_line, "duplicate declaration of state %s", current_line))
+		} else {
+			t.state_names = append(t.state_names, current_line)
+			t.state_lines[current_line] = line_no
 		}
 
 		if err := t.parseStateRules(current_line, t_file_scanner); err != nil {
-			return err
+			errs = append(errs, err.(TemplateErrors)...)
 		}
 
 	}
-	return nil
+	return errs.asError()
 }
 
 // parseTemplateFileValues(*bufio.Scanner) parse the values section of the template file.
-// The function returns an error if the file is invalid.
-func (t *TextFSM) parseTemplateFileValues(t_file_scanner *bufio.Scanner) error {
-	t.fillup_vals = []string{}
-	t.required_vals = []string{}
+// The function returns the TemplateErrors found in the values, if any.
+func (t *Template) parseTemplateFileValues(t_file_scanner *bufio.Scanner) error {
+	t.value_names = []string{}
+	t.child_sets = []string{}
+	t.children = map[string][]string{}
+	t.table_names = []string{}
+	t.tables = map[string]*tableValues{"": {}}
+	t.header_vals = []string{}
+	t.hooks = []optionHook{}
+	t.validations = []validationRule{}
+	errs := TemplateErrors{}
 	for t_file_scanner.Scan() {
 		current_line, line_no, line_size := t.getNextLine(t_file_scanner)
 		if line_size == 0 {
@@ -254,88 +489,295 @@ func (t *TextFSM) parseTemplateFileValues(t_file_scanner *bufio.Scanner) error {
 			continue
 		}
 
-		// Validate the Value line
-		if !strings.HasPrefix(current_line, "Value") {
-			return fmt.Errorf("error in line %d: expected Value token, got: %s", line_no, current_line)
+		// The Validate rules are declared among the values
+		parse := t.parseValue
+		if strings.HasPrefix(current_line, VALIDATE_KEYWORD) {
+			parse = t.parseValidation
+		}
+		if err := parse(current_line, line_no); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, t.checkComputedValues()...)
+	errs = append(errs, t.checkValidations()...)
+	errs = append(errs, t.checkChildSets()...)
+	errs = append(errs, t.checkTables()...)
+	t.propagateSecrets()
+	t.sortHooks()
+	return errs.asError()
+}
+
+// parseValue(string, int) parses a Value line and adds the value to the template
+func (t *Template) parseValue(current_line string, line_no int) *TemplateError {
+	// Validate the Value line
+	if !strings.HasPrefix(current_line, "Value") {
+		return t.lineError(line_no, 0, current_line, "expected Value token, got: %s", current_line)
+	}
+
+	tokens := VALUE_LINE_REGEX.FindStringSubmatch(current_line)
+	// A Column value has no regex, its text is sliced from the lines by position
+	column_tokens := COLUMN_VALUE_REGEX.FindStringSubmatch(current_line)
+	if tokens == nil && column_tokens == nil {
+		return t.lineError(line_no, 0, current_line,
+			"the Value declaration doesn't follow the format: %s", VALUE_FORMAT)
+	}
+
+	var name string
+	var options []string = nil
+	var regex string
+	if column_tokens != nil {
+		tokens = column_tokens
+		if tokens[1] != "" {
+			options = splitTopLevel(tokens[1], ',')
 		}
+		name = tokens[3]
+	} else if !strings.HasPrefix(tokens[2], "(") {
+		// Probably some options have been provided
+		name_tokens := VALUE_NAME_REGEX.FindStringSubmatch(tokens[2])
+		if name_tokens == nil {
+			return t.lineError(line_no, 0, current_line,
+				"the Value declaration doesn't follow the format: %s", VALUE_FORMAT)
+		}
+		options = splitTopLevel(tokens[1], ',')
+		name = name_tokens[1]
+		regex = name_tokens[2]
+
+		// A Computed value is followed by = and its expression, instead of the regex
+		if slices.Contains(options, COMPUTED_OPTION) {
+			name_part, expr_part, found := strings.Cut(tokens[2], "=")
+			regex = strings.TrimLeft(expr_part, " \t")
+			if !found || regex == "" {
+				return t.lineError(line_no, len(current_line)-len(tokens[2]), tokens[2],
+					"the %s value should be followed by = and the expression", COMPUTED_OPTION)
+			}
+			name = strings.TrimSpace(name_part)
+		}
+	} else {
+		name = tokens[1]
+		regex = tokens[2]
+	}
+	// The regex is always the last token of the line
+	regex_offset := len(current_line) - len(regex)
+	name_offset := strings.LastIndex(current_line[:regex_offset], name)
 
-		tokens := strings.Split(current_line, " ")
-		if token_n := len(tokens); token_n < 3 {
-			return fmt.Errorf("error in line %d: the Value declaration doesn't follow the format: %s", line_no, VALUE_FORMAT)
+	// Validate the name
+	if !VALUE_NAME_VALID_REGEX.MatchString(name) || len(name) > MAX_NAME_LEN {
+		return t.lineError(line_no, name_offset, name, "invalid value name '%s' or name too long", name)
+	}
+	if _, present := t.values[name]; present {
+		return t.lineError(line_no, name_offset, name, "duplicate declaration of value %s", name)
+	}
+
+	// Parse options, each one configures the value through its declaration
+	value := TextFSMValue{line_no: line_no}
+	decl := &ValueDecl{Name: name, Regex: regex, value: &value, tmpl: t}
+	given := []string{}
+	hooks := []optionHook{}
+	for i, op := range options {
+		if op == "" {
+			return t.tokenError(line_no, current_line, tokens[1],
+				"empty option, options should be separated by commas with no spaces")
+		}
+		if slices.Contains(options[:i], op) {
+			return t.tokenError(line_no, current_line, tokens[1], "duplicate option %s", op)
 		}
 
-		var name string
-		var options []string = nil
-		var regex string
-		if !strings.HasPrefix(tokens[2], "(") {
-			name = tokens[2]
-			// Probably some options have been provided
-			options = strings.Split(tokens[1], ",")
-			regex = strings.Join(tokens[3:], " ")
-		} else {
-			name = tokens[1]
-			regex = strings.Join(tokens[2:], " ")
-		}
-
-		// Parse options
-		fill_op := NO_FILL_OP
-		required_op := false
-		key_op := false
-		rtype := STRING_RECORD
-		for _, op := range options {
-			if op == "Fillup" {
-				if fill_op == NO_FILL_OP {
-					fill_op = FILL_UP_OP
-					t.fillup_vals = append(t.fillup_vals, name)
-				} else {
-					return fmt.Errorf("error in line %d: conflicting option %s", line_no, op)
-				}
-			} else if op == "Filldown" {
-				if fill_op == NO_FILL_OP {
-					fill_op = FILL_DOWN_OP
-				} else {
-					return fmt.Errorf("error in line %d: conflicting option %s", line_no, op)
-				}
-			} else if op == "Required" {
-				required_op = true
-				t.required_vals = append(t.required_vals, name)
-			} else if op == "Key" {
-				key_op = true
-			} else if op == "List" {
-				rtype = LIST_RECORD
-			} else {
-				return fmt.Errorf("error in line %d: unknown option %s", line_no, op)
+		op_name, arg, has_arg := strings.Cut(op, "=")
+		option, order := lookupValueOption(op_name)
+		if option == nil {
+			return t.tokenError(line_no, current_line, op, "unknown option %s", op)
+		}
+		for _, prev_op := range given {
+			prev_name, _, _ := strings.Cut(prev_op, "=")
+			prev, _ := lookupValueOption(prev_name)
+			if prev == option || slices.Contains(prev.Conflicts, op_name) || slices.Contains(option.Conflicts, prev_name) {
+				return t.tokenError(line_no, current_line, op, "conflicting option %s", op)
 			}
 		}
+		if has_arg && !option.TakesArg {
+			return t.tokenError(line_no, current_line, op, "option %s takes no argument", op_name)
+		} else if !has_arg && option.TakesArg {
+			return t.tokenError(line_no, current_line, op, "option %s requires an argument, e.g. %s=...", op_name, op_name)
+		}
 
-		// Validate regex
-		if regex[0] != '(' || regex[len(regex)-1] != ')' {
-			return fmt.Errorf("error in line %d: regex should be enclosed by ()", line_no)
+		if option.Aggregate != nil {
+			if value.aggregate != nil {
+				return t.tokenError(line_no, current_line, op, "conflicting option %s, value %s is already aggregated by %s",
+					op, name, value.aggregate.Name)
+			}
+			value.aggregate = option
 		}
 
-		if compiled_regex, err := regexp.Compile(regex); err != nil {
-			return fmt.Errorf("error in line %d: invalid regex %s", line_no, err)
-		} else if matchgroups := compiled_regex.SubexpNames(); len(matchgroups) > 2 {
-			// In Python Textfsm it is possible to define some named match groups in the value
-			// regex. This creates a dictionary. At the moment we do not support
-			// this feature, so raise an error in case of additional match groups (so if more than 2)
-			for _, group_name := range matchgroups {
-				if group_name != "" {
-					return fmt.Errorf("error in line %d: match groups in values' regex are not supported", line_no)
-				}
+		if option.Parse != nil {
+			if err := option.Parse(decl, arg); err != nil {
+				return t.tokenError(line_no, current_line, op, "%s", err)
+			}
+		}
+		given = append(given, op)
+		if option.hasHooks() {
+			hooks = append(hooks, optionHook{option: option, order: order, value: name, arg: arg})
+		}
+	}
+	for _, op := range given {
+		op_name, _, _ := strings.Cut(op, "=")
+		if option, _ := lookupValueOption(op_name); option.Validate != nil {
+			if err := option.Validate(decl); err != nil {
+				return t.tokenError(line_no, current_line, op, "%s", err)
 			}
 		}
+	}
+
+	if column_tokens != nil {
+		spec_offset := strings.Index(current_line, COLUMN_KEYWORD+"(") + len(COLUMN_KEYWORD) + 1
+		if slices.Contains(given, COMPUTED_OPTION) {
+			return t.lineError(line_no, spec_offset, tokens[2], "a %s value cannot be %s", COLUMN_KEYWORD, COMPUTED_OPTION)
+		}
+		column, err := parseColumn(tokens[2])
+		if err != nil {
+			return t.lineError(line_no, spec_offset, tokens[2], "%s", err)
+		}
+		// The rules only mark where the value is set, its text comes from the column
+		value.column = column
+		value.regex = fmt.Sprintf("(?P<%s>)", name)
+		t.addValue(name, value, hooks)
+		return nil
+	}
 
-		// Create a named match group
-		regex = fmt.Sprintf("(?P<%s>%s)", name, regex[1:len(regex)-1])
+	if slices.Contains(given, COMPUTED_OPTION) {
+		expr, err := t.parseExpr(regex)
+		if err != nil {
+			expr_err := err.(*exprError)
+			return t.lineError(line_no, regex_offset+expr_err.pos, expr_err.token, "invalid expression: %s", expr_err.msg)
+		}
+		expr.column = t.template_line_indent + regex_offset + 1
+		value.expr = expr
+		t.addValue(name, value, hooks)
+		return nil
+	}
+
+	// Validate regex
+	if regex[0] != '(' || regex[len(regex)-1] != ')' {
+		return t.lineError(line_no, regex_offset, regex, "regex should be enclosed by ()")
+	}
 
-		t.values[name] = TextFSMValue{
-			regex:    regex,
-			fill:     FillOption(fill_op),
-			required: required_op,
-			key:      key_op,
-			rtype:    RecordType(rtype),
+	// The outermost group becomes the named group of the value, so it cannot be
+	// a named or a non-capturing group itself
+	if strings.HasPrefix(regex, "(?") {
+		return t.lineError(line_no, regex_offset, regex, "the outermost group of the regex should be a plain group")
+	}
+
+	compiled_regex, err := t.compileRegex(regex)
+	if err != nil {
+		offset, token := regexError(err, regex)
+		tmpl_err := t.lineError(line_no, regex_offset+offset, token, "invalid regex %s", err)
+		if offset == -1 {
+			// Better no column than a wrong one
+			tmpl_err.Column = 0
+		}
+		tmpl_err.Err = err
+		return tmpl_err
+	}
+
+	// As in Python Textfsm, the named match groups of a List value make it a list of
+	// dictionaries. The groups are extracted by matching again the value regex, so
+	// they are removed from the regex used in the rules to avoid clashing names.
+	var nested_regex Matcher
+	for _, group_name := range compiled_regex.SubexpNames() {
+		if group_name == "" {
+			continue
+		}
+
+		if value.rtype == LIST_RECORD {
+			for _, op := range given {
+				op_name, _, _ := strings.Cut(op, "=")
+				if op_name == TYPE_OPTION || op_name == TRANSFORM_OPTION || op_name == SET_OPTION {
+					return t.lineError(line_no, regex_offset, regex,
+						"the %s option cannot be used with the named groups of a List", op_name)
+				}
+			}
+			value.rtype = DICT_LIST_RECORD
+			// Cannot fail, the same regex has just been compiled
+			nested_regex, _ = t.compileRegex("^" + regex)
 		}
+		regex = utils.StripRegexpGroupNames(regex)
+		break
 	}
+
+	// Create a named match group
+	regex = fmt.Sprintf("(?P<%s>%s)", name, regex[1:len(regex)-1])
+
+	value.regex = regex
+	value.nested_regex = nested_regex
+	t.addValue(name, value, hooks)
 	return nil
 }
+
+// addValue(string, TextFSMValue, []optionHook) adds a parsed value to the template, with
+// the hooks of its options
+func (t *Template) addValue(name string, value TextFSMValue, hooks []optionHook) {
+	if value.table != "" && !t.isTable(value.table) {
+		t.table_names = append(t.table_names, value.table)
+		t.tables[value.table] = &tableValues{}
+	}
+	table := t.tables[value.table]
+	table.names = append(table.names, name)
+	if value.fill == FILL_UP_OP {
+		table.fillup = append(table.fillup, name)
+	}
+	if value.key {
+		table.keys = append(table.keys, name)
+	}
+	if value.secret && value.child == "" {
+		// The child values are redacted when the child records are collected
+		table.secret = append(table.secret, name)
+	}
+	if value.expr != nil {
+		table.computed = append(table.computed, name)
+	}
+	if value.child != "" {
+		if !t.isChildSet(value.child) {
+			t.child_sets = append(t.child_sets, value.child)
+		}
+		t.children[value.child] = append(t.children[value.child], name)
+	}
+	if value.column != nil && value.column.title != "" {
+		t.header_vals = append(t.header_vals, name)
+	}
+	t.hooks = append(t.hooks, hooks...)
+	t.value_names = append(t.value_names, name)
+	t.values[name] = value
+}
+
+// checkComputedValues() checks the references of the expressions of the Computed values,
+// once all the values have been declared. A Computed value can refer to the Computed
+// values declared before it, as they are evaluated in order.
+func (t *Template) checkComputedValues() TemplateErrors {
+	errs := TemplateErrors{}
+	for i, name := range t.value_names {
+		value := t.values[name]
+		if value.expr == nil {
+			continue
+		}
+		for _, ref := range value.expr.refs {
+			ref_err := &TemplateError{
+				Line:     value.line_no,
+				Column:   value.expr.column + ref.pos,
+				Token:    ref.name,
+				Severity: SEVERITY_ERROR,
+			}
+			target, present := t.values[ref.name]
+			switch {
+			case !present && t.isChildSet(ref.name):
+				continue
+			case !present:
+				ref_err.Msg = fmt.Sprintf("unknown value %s in the expression of %s", ref.name, name)
+			case target.expr != nil && slices.Index(t.value_names, ref.name) >= i:
+				ref_err.Msg = fmt.Sprintf("%s value %s should be declared before %s", COMPUTED_OPTION, ref.name, name)
+			default:
+				continue
+			}
+			errs = append(errs, ref_err)
+		}
+	}
+	return errs
+}
@@ -20,7 +20,8 @@ var valTestCases = []struct {
 		line:        "Value myval (.*)",
 		exp_data_structure: map[string]TextFSMValue{
 			"myval": {
-				regex: "(?P<myval>.*)",
+				line_no: 1,
+				regex:   "(?P<myval>.*)",
 			},
 		},
 	},
@@ -29,7 +30,8 @@ var valTestCases = []struct {
 		line:        `Value myval (\(.*\) welcome!)`,
 		exp_data_structure: map[string]TextFSMValue{
 			"myval": {
-				regex: `(?P<myval>\(.*\) welcome!)`,
+				line_no: 1,
+				regex:   `(?P<myval>\(.*\) welcome!)`,
 			},
 		},
 	},
@@ -38,7 +40,8 @@ var valTestCases = []struct {
 		line:        "# This is a comment \n Value myval (.*)",
 		exp_data_structure: map[string]TextFSMValue{
 			"myval": {
-				regex: "(?P<myval>.*)",
+				line_no: 2,
+				regex:   "(?P<myval>.*)",
 			},
 		},
 	},
@@ -48,8 +51,9 @@ var valTestCases = []struct {
 		line:        "Value List myval (.*)",
 		exp_data_structure: map[string]TextFSMValue{
 			"myval": {
-				regex: "(?P<myval>.*)",
-				rtype: LIST_RECORD,
+				line_no: 1,
+				regex:   "(?P<myval>.*)",
+				rtype:   LIST_RECORD,
 			},
 		},
 	},
@@ -58,8 +62,9 @@ var valTestCases = []struct {
 		line:        "Value Fillup myval (.*)",
 		exp_data_structure: map[string]TextFSMValue{
 			"myval": {
-				regex: "(?P<myval>.*)",
-				fill:  FILL_UP_OP,
+				line_no: 1,
+				regex:   "(?P<myval>.*)",
+				fill:    FILL_UP_OP,
 			},
 		},
 	},
@@ -68,8 +73,9 @@ var valTestCases = []struct {
 		line:        "Value Filldown myval (.*)",
 		exp_data_structure: map[string]TextFSMValue{
 			"myval": {
-				regex: "(?P<myval>.*)",
-				fill:  FILL_DOWN_OP,
+				line_no: 1,
+				regex:   "(?P<myval>.*)",
+				fill:    FILL_DOWN_OP,
 			},
 		},
 	},
@@ -78,6 +84,7 @@ var valTestCases = []struct {
 		line:        "Value Required myval (.*)",
 		exp_data_structure: map[string]TextFSMValue{
 			"myval": {
+				line_no:  1,
 				regex:    "(?P<myval>.*)",
 				required: true,
 			},
@@ -88,6 +95,7 @@ var valTestCases = []struct {
 		line:        "Value Required,Fillup,List myval (.*)",
 		exp_data_structure: map[string]TextFSMValue{
 			"myval": {
+				line_no:  1,
 				regex:    "(?P<myval>.*)",
 				required: true,
 				fill:     FILL_UP_OP,
@@ -95,16 +103,127 @@ var valTestCases = []struct {
 			},
 		},
 	},
+	{
+		description: "Test named-match groups in list value",
+		line:        `Value List neighbors ((?P<ip>\S+)\s+(?P<as>\d+))`,
+		exp_data_structure: map[string]TextFSMValue{
+			"neighbors": {
+				line_no:      1,
+				regex:        `(?P<neighbors>(\S+)\s+(\d+))`,
+				nested_regex: re2Matcher{regexp.MustCompile(`^((?P<ip>\S+)\s+(?P<as>\d+))`)},
+				rtype:        DICT_LIST_RECORD,
+			},
+		},
+	},
+	{
+		description: "Test named-match groups in string value",
+		line:        `Value neighbor ((?P<ip>\S+)\s+(?P<as>\d+))`,
+		exp_data_structure: map[string]TextFSMValue{
+			"neighbor": {
+				line_no: 1,
+				regex:   `(?P<neighbor>(\S+)\s+(\d+))`,
+			},
+		},
+	},
+	{
+		description: "Test tabs and multiple spaces between tokens",
+		line:        "Value \tRequired,List   myval\t(a  b)",
+		exp_data_structure: map[string]TextFSMValue{
+			"myval": {
+				line_no:  1,
+				regex:    "(?P<myval>a  b)",
+				required: true,
+				rtype:    LIST_RECORD,
+			},
+		},
+	},
+	{
+		description: "Test tabs between tokens without options",
+		line:        "Value\tmyval\t\t(.*)",
+		exp_data_structure: map[string]TextFSMValue{
+			"myval": {
+				line_no: 1,
+				regex:   "(?P<myval>.*)",
+			},
+		},
+	},
+	{
+		description: "Test value with Type option",
+		line:        "Value List,Type=int myval (\\d+)",
+		exp_data_structure: map[string]TextFSMValue{
+			"myval": {
+				line_no: 1,
+				regex:   "(?P<myval>\\d+)",
+				rtype:   LIST_RECORD,
+				vtype:   TYPE_INT,
+			},
+		},
+	},
 	// Invalid formats
+	{
+		description: "Test unknown type",
+		line:        "Value Type=complex myval (.*)",
+		exp_err:     ".*unknown type complex.*",
+	},
+	{
+		description: "Test conflicting types",
+		line:        "Value Type=int,Type=float myval (.*)",
+		exp_err:     ".*conflicting option Type=float.*",
+	},
+	{
+		description: "Test type on named groups",
+		line:        "Value List,Type=int myval ((?P<a>\\d+))",
+		exp_err:     ".*Type option cannot be used with the named groups.*",
+	},
+	{
+		description: "Test unknown transform",
+		line:        "Value Transform=trim|reverse myval (.*)",
+		exp_err:     ".*column 7: unknown transform reverse.*",
+	},
+	{
+		description: "Test transform with bad arguments",
+		line:        "Value Transform=replace(x) myval (.*)",
+		exp_err:     ".*invalid transform replace\\(x\\): expected 2 arguments.*",
+	},
+	{
+		description: "Test conflicting transforms",
+		line:        "Value Transform=trim,Transform=lower myval (.*)",
+		exp_err:     ".*conflicting option Transform=lower.*",
+	},
+	{
+		description: "Test transform on named groups",
+		line:        "Value List,Transform=trim myval ((?P<a>\\d+))",
+		exp_err:     ".*Transform option cannot be used with the named groups.*",
+	},
+	{
+		description: "Test spaces between options",
+		line:        "Value Required, List myval (.*)",
+		exp_err:     ".*empty option, options should be separated by commas with no spaces.*",
+	},
+	{
+		description: "Test duplicate option",
+		line:        "Value List,List myval (.*)",
+		exp_err:     ".*duplicate option List.*",
+	},
+	{
+		description: "Test duplicate value",
+		line:        "Value myval (.*)\nValue List myval (.*)",
+		exp_err:     ".*duplicate declaration of value myval.*",
+	},
+	{
+		description: "Test invalid value name",
+		line:        "Value my-val (.*)",
+		exp_err:     ".*invalid value name 'my-val'.*",
+	},
 	{
 		description: "Test completly wrong format",
 		line:        "Wrong wrong wrong!",
 		exp_err:     ".*expected Value token.*",
 	},
 	{
-		description: "Test named-match groups in regex",
+		description: "Test named-match groups as outermost group",
 		line:        "Value Required myval (?P<hostname>Hostname (/s).*)",
-		exp_err:     ".*match groups in values' regex are not supported.*",
+		exp_err:     ".*outermost group of the regex should be a plain group.*",
 	},
 	{
 		description: "Test invalid line",
@@ -205,7 +324,7 @@ var ruleTestCases = []struct {
 		line:        "^Hello ${var1}",
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex: regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex: re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 			},
 		},
 	},
@@ -214,7 +333,7 @@ var ruleTestCases = []struct {
 		line:        fmt.Sprintf("^Hello ${var1} -> %s", NEXT_LINE_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:   regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:   re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				line_op: NEXT_LINE_OP,
 			},
 		},
@@ -224,7 +343,7 @@ var ruleTestCases = []struct {
 		line:        fmt.Sprintf("^Hello ${var1} -> %s", CONTINUE_LINE_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:   regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:   re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				line_op: CONTINUE_LINE_OP,
 			},
 		},
@@ -234,7 +353,7 @@ var ruleTestCases = []struct {
 		line:        fmt.Sprintf("^Hello ${var1} -> %s", RECORD_REC_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:  regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:  re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				rec_op: RECORD_REC_OP,
 			},
 		},
@@ -244,7 +363,7 @@ var ruleTestCases = []struct {
 		line:        fmt.Sprintf("^Hello ${var1} -> %s", CLEAR_REC_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:  regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:  re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				rec_op: CLEAR_REC_OP,
 			},
 		},
@@ -254,7 +373,7 @@ var ruleTestCases = []struct {
 		line:        fmt.Sprintf("^Hello ${var1} -> %s", CLEAR_ALL_REC_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:  regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:  re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				rec_op: CLEAR_ALL_REC_OP,
 			},
 		},
@@ -264,7 +383,7 @@ var ruleTestCases = []struct {
 		line:        fmt.Sprintf("^Hello ${var1} -> %s", NO_RECORD_REC_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:  regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:  re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				rec_op: NO_RECORD_REC_OP,
 			},
 		},
@@ -274,7 +393,7 @@ var ruleTestCases = []struct {
 		line:        "^Hello ${var1} -> Error",
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:     regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:     re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				error_str: "NoMessage",
 			},
 		},
@@ -284,17 +403,75 @@ var ruleTestCases = []struct {
 		line:        `^Hello ${var1} -> Error "This is an error"`,
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:     regexp.MustCompile(`^Hello (?P<var1>.*)`),
-				error_str: `"This is an error"`,
+				regex:     re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
+				error_str: "This is an error",
+			},
+		},
+	},
+	{
+		description: "Test Error operation with record operation and unquoted message",
+		line:        "^Hello ${var1} -> Error.Record failure",
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex:     re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
+				error_str: "failure",
+			},
+		},
+	},
+	// Variables syntax
+	{
+		description: "Test $var form",
+		line:        "^Hello $var1 and ${var2}",
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex: re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*) and (?P<var2>.*)`)},
 			},
 		},
 	},
+	{
+		description: "Test $$ escape as end of line anchor",
+		line:        `^Hello ${var1}$$`,
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex: re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)$`)},
+			},
+		},
+	},
+	{
+		description: "Test plain $ as end of line anchor",
+		line:        `^Hello (a|$) ${var1}$ -> Record`,
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex:  re2Matcher{regexp.MustCompile(`^Hello (a|$) (?P<var1>.*)$`)},
+				rec_op: RECORD_REC_OP,
+			},
+		},
+	},
+	{
+		description: "Test $$ escaping a variable",
+		line:        `^Hello \$${var1}`,
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex: re2Matcher{regexp.MustCompile(`^Hello \${var1}`)},
+			},
+		},
+	},
+	{
+		description: "Test not existing variable in $var form",
+		line:        "^hello $donotexist",
+		exp_err:     `.*unknown variable \$donotexist.*`,
+	},
+	{
+		description: "Test invalid variable substitution",
+		line:        "^hello ${var1",
+		exp_err:     `.*line \d+, column 8: invalid variable substitution.*`,
+	},
 	{
 		description: "Test Line + Record operation",
 		line:        fmt.Sprintf("^Hello ${var1} -> %s.%s", CONTINUE_LINE_OP, NO_RECORD_REC_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:   regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:   re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				rec_op:  NO_RECORD_REC_OP,
 				line_op: CONTINUE_LINE_OP,
 			},
@@ -305,7 +482,7 @@ var ruleTestCases = []struct {
 		line:        fmt.Sprintf("^Hello ${var1} -> %s new_state", RECORD_REC_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:     regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:     re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				rec_op:    RECORD_REC_OP,
 				new_state: "new_state",
 			},
@@ -316,16 +493,88 @@ var ruleTestCases = []struct {
 		line:        fmt.Sprintf("^Hello ${var1} -> %s new_state", NEXT_LINE_OP),
 		exp_data_structure: map[string]TextFSMRule{
 			"curstate": {
-				regex:     regexp.MustCompile(`^Hello (?P<var1>.*)`),
+				regex:     re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
 				line_op:   NEXT_LINE_OP,
 				new_state: "new_state",
 			},
 		},
 	},
+	// Multi-line rules
+	{
+		description: "Test multi-line rule",
+		line:        `^Hello ${var1}\n^\s+world ${var2} -> Record`,
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex:  re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
+				rec_op: RECORD_REC_OP,
+			},
+		},
+	},
+	{
+		description: "Test invalid regex in the second line",
+		line:        `^Hello ${var1}\n^world (`,
+		exp_err:     `.*column 24: invalid regex.*`,
+	},
+	{
+		description: "Test multi-line rule with Continue",
+		line:        `^Hello ${var1}\n^world -> Continue`,
+		exp_err:     `.*a multi-line rule cannot be used with line operation Continue.*`,
+	},
+	// State stack operations
+	{
+		description: "Test Record + Call operation",
+		line:        "^Hello ${var1} -> Next.Record Call other",
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex:     re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
+				line_op:   NEXT_LINE_OP,
+				rec_op:    RECORD_REC_OP,
+				new_state: "other",
+				state_op:  CALL_STATE_OP,
+			},
+		},
+	},
+	{
+		description: "Test Call of the current state",
+		line:        "^Hello ${var1} -> Call curstate",
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex:     re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
+				new_state: "curstate",
+				state_op:  CALL_STATE_OP,
+			},
+		},
+	},
+	{
+		description: "Test Return operation",
+		line:        "^Hello ${var1} -> Record Return",
+		exp_data_structure: map[string]TextFSMRule{
+			"curstate": {
+				regex:    re2Matcher{regexp.MustCompile(`^Hello (?P<var1>.*)`)},
+				rec_op:   RECORD_REC_OP,
+				state_op: RETURN_STATE_OP,
+			},
+		},
+	},
+	{
+		description: "Test Call without state",
+		line:        "^Hello ${var1} -> Next Call",
+		exp_err:     `.*column 24: the Call action requires the state to call.*`,
+	},
+	{
+		description: "Test Call of Return",
+		line:        "^Hello ${var1} -> Call Return",
+		exp_err:     `.*the Call action requires the state to call.*`,
+	},
+	{
+		description: "Test Return with Continue",
+		line:        "^Hello ${var1} -> Continue Return",
+		exp_err:     `.*new state cannot be specified with line operation.*`,
+	},
 }
 
 func TestParseTemplateRules(t *testing.T) {
-	textFSM := TextFSM{
+	textFSM := Template{
 		values: map[string]TextFSMValue{},
 	}
 
@@ -392,6 +641,11 @@ func TestParseTemplateRules(t *testing.T) {
 					tc.description, got_rule.new_state, data_structure.new_state)
 			}
 
+			if got_rule.state_op != data_structure.state_op {
+				t.Errorf("Error in '%s': expected state operation '%s', got '%s'",
+					tc.description, data_structure.state_op, got_rule.state_op)
+			}
+
 			if got_rule.error_str != data_structure.error_str {
 				t.Errorf("Error in '%s': expected error '%s', got '%s'",
 					tc.description, got_rule.error_str, data_structure.error_str)
@@ -401,13 +655,14 @@ func TestParseTemplateRules(t *testing.T) {
 }
 
 func TestParseTemplateFileValues(t *testing.T) {
-	textFSM := TextFSM{
+	textFSM := Template{
 		values: map[string]TextFSMValue{},
 	}
 
 	for _, tc := range valTestCases {
 		t.Log(tc.description)
 		textFSM.values = map[string]TextFSMValue{}
+		textFSM.template_parsed_line = 0
 		reader := bytes.NewBufferString(tc.line)
 		scanner := bufio.NewScanner(reader)
 
@@ -0,0 +1,224 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TransformFunc transforms the text matched by a value, the arguments are the ones given
+// to the transform in the template, e.g. Transform=myfunc(a,b)
+type TransformFunc func(text string, args ...string) (string, error)
+
+// transformFactory validates the arguments of a transform, given in the template, and
+// returns the function applying it
+type transformFactory func(args []string) (func(string) (string, error), error)
+
+// valueTransform is a step of the transform chain of a value
+type valueTransform struct {
+	name  string                       // the name of the transform
+	apply func(string) (string, error) // the function applying the transform
+}
+
+// Full names of the interfaces, by abbreviation
+var INTERFACE_NAMES = map[string]string{
+	"bdi": "BDI",
+	"be":  "Bundle-Ether",
+	"et":  "Ethernet",
+	"eth": "Ethernet",
+	"fa":  "FastEthernet",
+	"fo":  "FortyGigabitEthernet",
+	"gi":  "GigabitEthernet",
+	"hu":  "HundredGigE",
+	"lo":  "Loopback",
+	"ma":  "Management",
+	"po":  "Port-channel",
+	"se":  "Serial",
+	"te":  "TenGigabitEthernet",
+	"tu":  "Tunnel",
+	"twe": "TwentyFiveGigE",
+	"vl":  "Vlan",
+}
+
+// regex splitting the name of an interface in its type and its number
+var INTERFACE_NAME_REGEX = regexp.MustCompile(`^([A-Za-z-]+)(\d.*)$`)
+
+// regex matching the parts of an uptime in the verbose form, e.g. 1 year, 2 weeks, 3 days
+var UPTIME_PART_REGEX = regexp.MustCompile(`(\d+)\s*(years?|weeks?|days?|hours?|minutes?|seconds?)\b`)
+
+// Length of the units of UPTIME_PART_REGEX
+var UPTIME_UNITS = map[string]time.Duration{
+	"year":   365 * 24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"day":    24 * time.Hour,
+	"hour":   time.Hour,
+	"minute": time.Minute,
+	"second": time.Second,
+}
+
+// The transforms available in every template
+var BUILTIN_TRANSFORMS = map[string]transformFactory{
+	"trim":             noArgsTransform(func(text string) string { return strings.TrimSpace(text) }),
+	"lower":            noArgsTransform(strings.ToLower),
+	"upper":            noArgsTransform(strings.ToUpper),
+	"expand_interface": noArgsTransform(expandInterface),
+	"replace":          replaceTransform,
+	"default":          defaultTransform,
+	"uptime":           uptimeTransform,
+}
+
+// noArgsTransform(func(string) string) creates the factory of a transform without arguments
+func noArgsTransform(fn func(string) string) transformFactory {
+	return func(args []string) (func(string) (string, error), error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("no arguments expected")
+		}
+		return func(text string) (string, error) { return fn(text), nil }, nil
+	}
+}
+
+// replaceTransform([]string) creates the transform replacing the matches of a regex, the
+// replacement can refer to the groups of the regex as $1 or ${name}
+func replaceTransform(args []string) (func(string) (string, error), error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, the regex and the replacement")
+	}
+	regex, err := regexp.Compile(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return func(text string) (string, error) {
+		return regex.ReplaceAllString(text, args[1]), nil
+	}, nil
+}
+
+// defaultTransform([]string) creates the transform replacing an empty match with the
+// given text
+func defaultTransform(args []string) (func(string) (string, error), error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, the default text")
+	}
+	return func(text string) (string, error) {
+		if text == "" {
+			return args[0], nil
+		}
+		return text, nil
+	}, nil
+}
+
+// uptimeTransform([]string) creates the transform converting an uptime to seconds
+func uptimeTransform(args []string) (func(string) (string, error), error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("no arguments expected")
+	}
+	return func(text string) (string, error) {
+		if text == "" {
+			return text, nil
+		}
+		seconds, err := uptimeSeconds(text)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(seconds, 10), nil
+	}, nil
+}
+
+// uptimeSeconds(string) converts an uptime in one of the forms accepted by the duration
+// type, or in the verbose form (1 year, 2 weeks, 3 days, 4 hours, 5 minutes), to seconds
+func uptimeSeconds(text string) (int64, error) {
+	if duration, err := parseDuration(text); err == nil {
+		return int64(duration / time.Second), nil
+	}
+
+	parts := UPTIME_PART_REGEX.FindAllStringSubmatch(text, -1)
+	if parts == nil {
+		return 0, fmt.Errorf("invalid uptime")
+	}
+	duration := time.Duration(0)
+	for _, part := range parts {
+		n, _ := strconv.ParseInt(part[1], 10, 64)
+		duration += time.Duration(n) * UPTIME_UNITS[strings.TrimSuffix(part[2], "s")]
+	}
+	return int64(duration / time.Second), nil
+}
+
+// expandInterface(string) expands the abbreviated name of an interface, e.g. Gi0/1 becomes
+// GigabitEthernet0/1. Unknown names are left as they are.
+func expandInterface(text string) string {
+	submatch := INTERFACE_NAME_REGEX.FindStringSubmatch(text)
+	if submatch == nil {
+		return text
+	}
+	if full_name, known := INTERFACE_NAMES[strings.ToLower(submatch[1])]; known {
+		return full_name + submatch[2]
+	}
+	return text
+}
+
+// splitTopLevel(string, byte) splits the string on the given separator, ignoring the
+// separators escaped by a backslash or inside brackets
+func splitTopLevel(str string, sep byte) []string {
+	parts := []string{}
+	depth := 0
+	last := 0
+	for i := 0; i < len(str); i++ {
+		switch str[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, str[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, str[last:])
+}
+
+// parseTransforms(string) parses the chain of transforms of the Transform option, e.g.
+// trim|replace(\s+,_)|default(N/A)
+func (t *Template) parseTransforms(chain string) ([]valueTransform, error) {
+	transforms := []valueTransform{}
+	for _, step := range splitTopLevel(chain, '|') {
+		name := step
+		args := []string{}
+		if i := strings.IndexByte(step, '('); i != -1 {
+			if !strings.HasSuffix(step, ")") {
+				return nil, fmt.Errorf("missing closing bracket in transform %s", step)
+			}
+			name = step[:i]
+			if step[i+1:len(step)-1] != "" {
+				args = splitTopLevel(step[i+1:len(step)-1], ',')
+			}
+		}
+
+		apply, known, err := t.lookupTransform(name, args)
+		if !known {
+			return nil, fmt.Errorf("unknown transform %s", name)
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid transform %s: %w", step, err)
+		}
+		transforms = append(transforms, valueTransform{name: name, apply: apply})
+	}
+	return transforms, nil
+}
+
+// lookupTransform(string, []string) returns the function applying the transform with the
+// given name and arguments, looking for it among the custom transforms and then among the
+// builtin ones. The boolean is false when there is no such transform.
+func (t *Template) lookupTransform(name string, args []string) (func(string) (string, error), bool, error) {
+	if custom, present := t.transforms[name]; present {
+		return func(text string) (string, error) { return custom(text, args...) }, true, nil
+	}
+	if factory, present := BUILTIN_TRANSFORMS[name]; present {
+		apply, err := factory(args)
+		return apply, true, err
+	}
+	return nil, false, nil
+}
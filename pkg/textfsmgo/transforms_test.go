@@ -0,0 +1,113 @@
+package textfsmgo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	tmpl := `Value Transform=expand_interface|lower ifname (\S+)
+Value Transform=replace(\s+,_)|upper descr (.*?)
+Value Type=int,Transform=uptime uptime (.+?)
+Value Transform=default(N/A) vrf (\S*)
+
+Start
+  ^${ifname} "${descr}" up ${uptime} vrf ${vrf}$$ -> Record
+`
+	text := `Gi0/1 "to core  switch" up 1 week, 2 days, 3 hours vrf mgmt
+Te1/0/2 "" up 01:02:03 vrf 
+Foo3 "x" up 2d vrf red
+`
+	parser, err := NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test transforms", parser, text, []map[string]interface{}{
+		{"ifname": "gigabitethernet0/1", "descr": "TO_CORE_SWITCH", "uptime": int64(788400), "vrf": "mgmt"},
+		{"ifname": "tengigabitethernet1/0/2", "descr": "", "uptime": int64(3723), "vrf": "N/A"},
+		{"ifname": "foo3", "descr": "X", "uptime": int64(172800), "vrf": "red"},
+	})
+}
+
+func TestCustomTransforms(t *testing.T) {
+	strip_domain := func(text string, args ...string) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("expected the domain")
+		}
+		if !strings.HasSuffix(text, args[0]) {
+			return "", fmt.Errorf("not in domain %s", args[0])
+		}
+		return strings.TrimSuffix(text, args[0]), nil
+	}
+	tmpl := "Value Transform=strip_domain(.example.com) host (\\S+)\n\nStart\n  ^${host} -> Record\n"
+
+	parser, err := NewTextFSMParserFromString(tmpl, WithTransform("strip_domain", strip_domain))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test custom transform", parser, "r1.example.com\n", []map[string]interface{}{
+		{"host": "r1"},
+	})
+
+	// The failures of the transforms are reported as ConversionErrors
+	_, err = parser.ParseTextToDicts("r1.example.com\nr2.example.org\n")
+	var conv_err *ConversionError
+	if !errors.As(err, &conv_err) || conv_err.Transform != "strip_domain" ||
+		conv_err.Text != "r2.example.org" || conv_err.LineNo != 2 {
+		t.Errorf("Error in 'Test transform error': unexpected error %+v", err)
+	}
+
+	// Custom transforms hide the builtin ones
+	parser, err = NewTextFSMParserFromString("Value Transform=upper name (\\S+)\n\nStart\n  ^${name} -> Record\n",
+		WithTransform("upper", func(text string, args ...string) (string, error) { return "<" + text + ">", nil }))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test custom transform hiding builtin", parser, "abc\n", []map[string]interface{}{
+		{"name": "<abc>"},
+	})
+}
+
+func TestExpandInterface(t *testing.T) {
+	var interfaceTestCases = map[string]string{
+		"Gi0/1":           "GigabitEthernet0/1",
+		"gi0/1":           "GigabitEthernet0/1",
+		"Te1/0/1":         "TenGigabitEthernet1/0/1",
+		"Po10":            "Port-channel10",
+		"Eth1/1":          "Ethernet1/1",
+		"Lo0":             "Loopback0",
+		"Vl100":           "Vlan100",
+		"BE1.100":         "Bundle-Ether1.100",
+		"Ethernet1/1":     "Ethernet1/1",
+		"Xyz0/1":          "Xyz0/1",
+		"mgmt":            "mgmt",
+		"GigabitEthernet": "GigabitEthernet",
+	}
+
+	for text, exp := range interfaceTestCases {
+		if got := expandInterface(text); got != exp {
+			t.Errorf("Error expanding '%s': expected '%s', got '%s'", text, exp, got)
+		}
+	}
+}
+
+func TestSplitTopLevel(t *testing.T) {
+	var splitTestCases = []struct {
+		str string
+		exp []string
+	}{
+		{str: "List,Required", exp: []string{"List", "Required"}},
+		{str: "Transform=replace(a,b)|trim,Key", exp: []string{"Transform=replace(a,b)|trim", "Key"}},
+		{str: `replace(\,,;)`, exp: []string{`replace(\,,;)`}},
+		{str: `a\,b,c`, exp: []string{`a\,b`, "c"}},
+		{str: "", exp: []string{""}},
+	}
+
+	for _, tc := range splitTestCases {
+		if got := splitTopLevel(tc.str, ','); fmt.Sprint(got) != fmt.Sprint(tc.exp) || len(got) != len(tc.exp) {
+			t.Errorf("Error splitting '%s': expected %q, got %q", tc.str, tc.exp, got)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts tried, in order, to convert a value of type time when no other layout has
+// been set with WithTimeLayouts()
+var TIME_LAYOUTS = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.UnixDate,
+	time.ANSIC,
+	"15:04:05.000 MST Mon Jan 2 2006", // show clock of Cisco devices
+	"Jan _2 2006 15:04:05",
+	time.Stamp,
+}
+
+// regex for matching a duration in the notation used by network devices, e.g. 1y2w,
+// 3d04h or 5h06m07s
+var DURATION_UNITS_REGEX = regexp.MustCompile(
+	`^(?:(\d+)y)?(?:(\d+)w)?(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?$`)
+
+// regex for matching a duration in the clock notation, e.g. 12:05:01
+var DURATION_CLOCK_REGEX = regexp.MustCompile(`^(\d+):(\d{2})(?::(\d{2}))?$`)
+
+// Length of each unit of DURATION_UNITS_REGEX, in the order of the groups
+var DURATION_UNITS = []time.Duration{
+	365 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	24 * time.Hour,
+	time.Hour,
+	time.Minute,
+	time.Second,
+}
+
+// Strings accepted for the values of type bool, case is ignored
+var BOOL_STRINGS = map[string]bool{
+	"true": true, "yes": true, "on": true, "enabled": true,
+	"false": false, "no": false, "off": false, "disabled": false,
+}
+
+// ConversionError describes a value whose text cannot be converted to its type, or cannot
+// be transformed by one of its transforms
+type ConversionError struct {
+	Value     string    // the name of the value
+	Type      ValueType // the type of the value
+	Transform string    // the name of the failed transform, empty if the conversion failed
+	Expr      string    // the expression which cannot be evaluated, for the Computed values
+	Text      string    // the text which cannot be converted
+	Line      string    // the input line the text comes from
+	LineNo    int       // the number of the input line, starting from 1
+	Err       error     // the reason of the failure
+}
+
+func (e *ConversionError) Error() string {
+	if e.Expr != "" {
+		return fmt.Sprintf("cannot compute value %s with '%s' in line %d (%s): %s",
+			e.Value, e.Expr, e.LineNo, e.Line, e.Err)
+	}
+	if e.Transform != "" {
+		return fmt.Sprintf("cannot transform '%s' with %s for value %s in line %d (%s): %s",
+			e.Text, e.Transform, e.Value, e.LineNo, e.Line, e.Err)
+	}
+	return fmt.Sprintf("cannot convert '%s' to %s for value %s in line %d (%s): %s",
+		e.Text, e.Type, e.Value, e.LineNo, e.Line, e.Err)
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// parseDuration(string) converts a duration in the Go notation (1h2m3.5s), in the clock
+// notation (01:02:03) or in the notation of network devices (1w2d, 3d04h)
+func parseDuration(text string) (time.Duration, error) {
+	if duration, err := time.ParseDuration(text); err == nil {
+		return duration, nil
+	}
+
+	if submatch := DURATION_CLOCK_REGEX.FindStringSubmatch(text); submatch != nil {
+		duration := time.Duration(0)
+		for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+			if submatch[i+1] != "" {
+				n, _ := strconv.ParseInt(submatch[i+1], 10, 64)
+				duration += time.Duration(n) * unit
+			}
+		}
+		return duration, nil
+	}
+
+	if submatch := DURATION_UNITS_REGEX.FindStringSubmatch(text); submatch != nil && text != "" {
+		duration := time.Duration(0)
+		for i, unit := range DURATION_UNITS {
+			if submatch[i+1] != "" {
+				n, _ := strconv.ParseInt(submatch[i+1], 10, 64)
+				duration += time.Duration(n) * unit
+			}
+		}
+		return duration, nil
+	}
+	return 0, fmt.Errorf("invalid duration")
+}
+
+// convertValue(ValueType, string) converts the text matched by a value to its type
+func (t *Template) convertValue(vtype ValueType, text string) (interface{}, error) {
+	switch vtype {
+	case TYPE_INT:
+		return strconv.ParseInt(text, 10, 64)
+	case TYPE_FLOAT:
+		return strconv.ParseFloat(text, 64)
+	case TYPE_BOOL:
+		if val, known := BOOL_STRINGS[strings.ToLower(text)]; known {
+			return val, nil
+		}
+		return nil, fmt.Errorf("invalid boolean")
+	case TYPE_IP:
+		return netip.ParseAddr(text)
+	case TYPE_CIDR:
+		return netip.ParsePrefix(text)
+	case TYPE_MAC:
+		return net.ParseMAC(text)
+	case TYPE_DURATION:
+		return parseDuration(text)
+	case TYPE_TIME:
+		layouts := t.time_layouts
+		if layouts == nil {
+			layouts = TIME_LAYOUTS
+		}
+		for _, layout := range layouts {
+			if val, err := time.Parse(layout, text); err == nil {
+				return val, nil
+			}
+		}
+		return nil, fmt.Errorf("no matching time layout")
+	}
+	return text, nil
+}
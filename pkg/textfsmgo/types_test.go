@@ -0,0 +1,141 @@
+package textfsmgo
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+const typedTemplate = `Value ifname (\S+)
+Value Type=int mtu (\d+)
+Value Type=float load (\S+)
+Value Type=bool enabled (\S+)
+Value Type=ip address (\S+)
+Value Type=cidr network (\S+)
+Value Type=mac macaddr (\S+)
+Value Type=duration uptime (\S+)
+Value Type=time changed (\S+)
+Value List,Type=int vlans (\d+)
+
+Start
+  ^${ifname} mtu ${mtu} load ${load} enabled ${enabled}
+  ^\s+inet ${address} net ${network}
+  ^\s+mac ${macaddr} up ${uptime} changed ${changed}
+  ^\s+vlan ${vlans}
+  ^end -> Record
+`
+
+func TestTypedValues(t *testing.T) {
+	parser, err := NewTextFSMParserFromString(typedTemplate)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	text := `eth0 mtu 1500 load 0.25 enabled yes
+  inet 10.0.0.1 net 10.0.0.0/24
+  mac 00:11:22:33:44:55 up 1w2d changed 2023-08-01T10:00:00Z
+  vlan 10
+  vlan 20
+end
+eth1 mtu 9000 load 1 enabled off
+end
+`
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	checkRecords(t, "Test typed values", parser, text, []map[string]interface{}{
+		{
+			"ifname":  "eth0",
+			"mtu":     int64(1500),
+			"load":    0.25,
+			"enabled": true,
+			"address": netip.MustParseAddr("10.0.0.1"),
+			"network": netip.MustParsePrefix("10.0.0.0/24"),
+			"macaddr": mac,
+			"uptime":  9 * 24 * time.Hour,
+			"changed": time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC),
+			"vlans":   []interface{}{int64(10), int64(20)},
+		},
+		{
+			"ifname":  "eth1",
+			"mtu":     int64(9000),
+			"load":    1.0,
+			"enabled": false,
+			"address": nil,
+			"network": nil,
+			"macaddr": nil,
+			"uptime":  nil,
+			"changed": nil,
+			"vlans":   []interface{}{},
+		},
+	})
+}
+
+func TestParseDuration(t *testing.T) {
+	var durationTestCases = []struct {
+		text    string
+		exp     time.Duration
+		exp_err bool
+	}{
+		{text: "1h2m3.5s", exp: time.Hour + 2*time.Minute + 3500*time.Millisecond},
+		{text: "12:05:01", exp: 12*time.Hour + 5*time.Minute + time.Second},
+		{text: "00:30", exp: 30 * time.Minute},
+		{text: "1y2w", exp: (365 + 14) * 24 * time.Hour},
+		{text: "3d04h", exp: 76 * time.Hour},
+		{text: "5h06m07s", exp: 5*time.Hour + 6*time.Minute + 7*time.Second},
+		{text: "", exp_err: true},
+		{text: "soon", exp_err: true},
+	}
+
+	for _, tc := range durationTestCases {
+		got, err := parseDuration(tc.text)
+		if (err != nil) != tc.exp_err || got != tc.exp {
+			t.Errorf("Error parsing duration '%s': expected %s (error %t), got %s (%v)",
+				tc.text, tc.exp, tc.exp_err, got, err)
+		}
+	}
+}
+
+func TestConversionErrors(t *testing.T) {
+	tmpl := "Value name (\\S+)\nValue Type=int mtu (\\S+)\n\nStart\n  ^${name} ${mtu} -> Record\n"
+	text := "eth0 1500\neth1 big\neth2 9000\n"
+
+	parser, err := NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	_, err = parser.ParseTextToDicts(text)
+	var conv_err *ConversionError
+	if !errors.As(err, &conv_err) || conv_err.Value != "mtu" || conv_err.Type != TYPE_INT ||
+		conv_err.Text != "big" || conv_err.Line != "eth1 big" || conv_err.LineNo != 2 {
+		t.Errorf("Error in 'Test conversion error': unexpected error %+v", err)
+	}
+
+	// The handler can skip the values which cannot be converted
+	handled := []*ConversionError{}
+	parser, err = NewTextFSMParserFromString(tmpl, WithConversionErrorHandler(func(e *ConversionError) error {
+		handled = append(handled, e)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test conversion error handler", parser, text, []map[string]interface{}{
+		{"name": "eth0", "mtu": int64(1500)},
+		{"name": "eth1", "mtu": nil},
+		{"name": "eth2", "mtu": int64(9000)},
+	})
+	if len(handled) != 1 || handled[0].LineNo != 2 {
+		t.Errorf("Error in 'Test conversion error handler': expected 1 error in line 2, got %+v", handled)
+	}
+
+	// Time layouts can be customized
+	parser, err = NewTextFSMParserFromString("Value Type=time at (.+)\n\nStart\n  ^at ${at} -> Record\n",
+		WithTimeLayouts("02/01/2006 15:04"))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test time layouts", parser, "at 25/12/2023 08:30\n", []map[string]interface{}{
+		{"at": time.Date(2023, 12, 25, 8, 30, 0, 0, time.UTC)},
+	})
+}
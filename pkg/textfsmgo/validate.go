@@ -0,0 +1,252 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Keyword of the validation rules, declared in the values section of the template
+const VALIDATE_KEYWORD = "Validate"
+
+// Names of the validation rules on the whole table
+const (
+	UNIQUE_RULE  = "Unique"
+	RECORDS_RULE = "Records"
+)
+
+var VALIDATE_LINE_REGEX = regexp.MustCompile(`^Validate\s+(.+)$`)
+var RECORDS_RULE_REGEX = regexp.MustCompile(`^Records\s*(==|!=|<=|>=|<|>)\s*(\d+)$`)
+
+// validationRule is a Validate rule of the template
+type validationRule struct {
+	kind    ValidationKind // the kind of the rule
+	source  string         // the rule, as written after the Validate keyword
+	line_no int            // the line of the template declaring the rule
+	column  int            // the column of the rule in the template line
+	expr    *valueExpr     // the expression which must hold, for VALIDATE_EXPR
+	names   []string       // the values which must be unique, for VALIDATE_UNIQUE
+	op      string         // the comparison operator, for VALIDATE_RECORDS
+	count   int            // the number of records compared, for VALIDATE_RECORDS
+	table   string         // the table whose records are checked, the default one if empty
+}
+
+// ValidationError describes a record, or the whole table, failing a Validate rule of the
+// template
+type ValidationError struct {
+	Rule     string         // the rule, as written after the Validate keyword
+	RuleLine int            // the line of the template declaring the rule
+	Kind     ValidationKind // the kind of the rule
+	Record   Record         // the failing record, nil for the rules on the number of records
+	Line     string         // the input line being parsed when the rule failed
+	LineNo   int            // the number of the input line, starting from 1
+	Msg      string         // the reason of the failure
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validation '%s' (template line %d) failed in line %d: %s",
+		e.Rule, e.RuleLine, e.LineNo, e.Msg)
+}
+
+// ValidationErrors are the failures of the Validate rules collected in a whole parsing,
+// returned together with the records, which are all kept
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap() returns the single failures, so that errors.As() can find them
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// validationResults(error) tells if the error returned by a parsing only reports the failures
+// of the Validate rules, so that the records parsed can be returned along with it
+func validationResults(err error) bool {
+	_, is_failures := err.(ValidationErrors)
+	return is_failures
+}
+
+// parseValidation(string, int) parses a Validate line and adds the rule to the template.
+// The values are checked once all of them have been declared.
+func (t *Template) parseValidation(current_line string, line_no int) *TemplateError {
+	tokens := VALIDATE_LINE_REGEX.FindStringSubmatch(current_line)
+	if tokens == nil {
+		return t.lineError(line_no, 0, current_line, "the Validate rule should be followed by an expression, %s or %s",
+			UNIQUE_RULE, RECORDS_RULE)
+	}
+
+	source := strings.TrimSpace(tokens[1])
+	offset := len(VALIDATE_KEYWORD) + strings.Index(current_line[len(VALIDATE_KEYWORD):], source)
+	rule := validationRule{source: source, line_no: line_no, column: t.template_line_indent + offset + 1}
+	switch {
+	case source == UNIQUE_RULE || strings.HasPrefix(source, UNIQUE_RULE+" "):
+		rule.kind = VALIDATE_UNIQUE
+		if names := strings.TrimSpace(source[len(UNIQUE_RULE):]); names != "" {
+			for _, name := range strings.Split(names, ",") {
+				rule.names = append(rule.names, strings.TrimSpace(name))
+			}
+		}
+	case strings.HasPrefix(source, RECORDS_RULE):
+		records := RECORDS_RULE_REGEX.FindStringSubmatch(source)
+		if records == nil {
+			return t.lineError(line_no, offset, source, "the %s rule should be a comparison with a number, e.g. %s >= 1",
+				RECORDS_RULE, RECORDS_RULE)
+		}
+		rule.kind = VALIDATE_RECORDS
+		rule.op = records[1]
+		var err error
+		if rule.count, err = strconv.Atoi(records[2]); err != nil {
+			return t.lineError(line_no, offset, source, "invalid number of records %s", records[2])
+		}
+	default:
+		expr, err := t.parseExpr(source)
+		if err != nil {
+			expr_err := err.(*exprError)
+			return t.lineError(line_no, offset+expr_err.pos, expr_err.token, "invalid expression: %s", expr_err.msg)
+		}
+		rule.kind = VALIDATE_EXPR
+		rule.expr = expr
+	}
+	t.validations = append(t.validations, rule)
+	return nil
+}
+
+// checkValidations() checks the values used by the Validate rules, once all the values
+// have been declared. The Unique rules with no values check the Key values.
+func (t *Template) checkValidations() TemplateErrors {
+	errs := TemplateErrors{}
+	ruleError := func(rule validationRule, pos int, token string, format string, args ...interface{}) {
+		errs = append(errs, &TemplateError{
+			Line:     rule.line_no,
+			Column:   rule.column + pos,
+			Token:    token,
+			Severity: SEVERITY_ERROR,
+			Msg:      fmt.Sprintf(format, args...),
+		})
+	}
+
+	for i, rule := range t.validations {
+		switch rule.kind {
+		case VALIDATE_EXPR:
+			for _, ref := range rule.expr.refs {
+				if _, present := t.values[ref.name]; !present && !t.isChildSet(ref.name) {
+					ruleError(rule, ref.pos, ref.name, "unknown value %s in the validation", ref.name)
+				}
+			}
+		case VALIDATE_UNIQUE:
+			if rule.names == nil {
+				if len(t.tables[""].keys) == 0 {
+					ruleError(rule, 0, rule.source, "the %s rule requires the names of the values, or some Key values",
+						UNIQUE_RULE)
+				}
+				t.validations[i].names = t.tables[""].keys
+				continue
+			}
+			for _, name := range rule.names {
+				if _, present := t.values[name]; !present {
+					ruleError(rule, strings.Index(rule.source, name), name, "unknown value %s in the validation", name)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// validationFailed(validationRule, Record, string, ...interface{}) passes the failure of a
+// rule to the handler of the template, or collects it when there is no handler. The error is
+// returned when the parsing should stop. The record is checked in clear, the error carries
+// it, the message and the input line with the secret texts redacted.
+func (s *Session) validationFailed(rule validationRule, record Record, format string, args ...interface{}) error {
+	val_err := &ValidationError{
+		Rule:     rule.source,
+		RuleLine: rule.line_no,
+		Kind:     rule.kind,
+		Line:     s.redactText(s.line, record),
+		LineNo:   s.line_no,
+		Msg:      s.redactText(fmt.Sprintf(format, args...), record),
+	}
+	if record != nil {
+		val_err.Record = s.redactRecord(rule.table, record)
+	}
+	if s.tmpl.validation_handler == nil {
+		if s.tmpl.strict_validation {
+			return val_err
+		}
+		s.failures = append(s.failures, val_err)
+		return nil
+	}
+	return s.tmpl.validation_handler(val_err)
+}
+
+// validateAndEmit(string, Record) checks a final record of the given table against the rules
+// of the template on that table, then passes it to the emit function. The records failing a
+// rule are emitted anyway when the handler lets the parsing continue. The secret values are
+// checked in clear, they leave the session only redacted.
+func (s *Session) validateAndEmit(table string, record Record) error {
+	state := s.tables[table]
+	state.emitted++
+	for i, rule := range s.tmpl.validations {
+		if rule.table != table {
+			continue
+		}
+		switch rule.kind {
+		case VALIDATE_EXPR:
+			val, err := rule.expr.root.eval(record)
+			if err != nil {
+				err = s.validationFailed(rule, record, "cannot evaluate the rule: %s", err)
+			} else if !exprTruthy(val) {
+				err = s.validationFailed(rule, record, "the record does not satisfy the rule")
+			}
+			if err != nil {
+				return err
+			}
+		case VALIDATE_UNIQUE:
+			if state.unique_seen == nil {
+				state.unique_seen = make([]map[string]int, len(s.tmpl.validations))
+			}
+			if state.unique_seen[i] == nil {
+				state.unique_seen[i] = map[string]int{}
+			}
+			id := recordID(record, rule.names)
+			if first, seen := state.unique_seen[i][id]; seen {
+				vals := recordValues(record, rule.names)
+				if err := s.validationFailed(rule, record, "values %v already found in record %d", vals, first); err != nil {
+					return err
+				}
+				continue
+			}
+			state.unique_seen[i][id] = state.emitted
+		}
+	}
+	return state.emit(s.redactRecord(table, record))
+}
+
+// validateTable() checks the number of records emitted against the Records rules of the
+// template, once all the records have been emitted
+func (s *Session) validateTable() error {
+	for _, rule := range s.tmpl.validations {
+		if rule.kind != VALIDATE_RECORDS {
+			continue
+		}
+		emitted := s.tables[rule.table].emitted
+		cmp := compareValues(int64(emitted), int64(rule.count))
+		if !(rule.op == "==" && cmp == 0 || rule.op == "!=" && cmp != 0 || rule.op == "<" && cmp < 0 ||
+			rule.op == "<=" && cmp <= 0 || rule.op == ">" && cmp > 0 || rule.op == ">=" && cmp >= 0) {
+			if err := s.validationFailed(rule, nil, "%d records found", emitted); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package textfsmgo
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestValidations(t *testing.T) {
+	tmpl := `Value Key vlan (\d+)
+Value name (\S+)
+Value Type=int min_mtu (\d+)
+Value Type=int max_mtu (\d+)
+Validate match(name, "^[a-z]+$")
+Validate min_mtu <= max_mtu
+Validate Unique
+Validate Records >= 5
+
+Start
+  ^${vlan} ${name} ${min_mtu} ${max_mtu} -> Record
+`
+	text := "10 users 1500 9000\n20 Voice 1500 9000\n30 guests 9000 1500\n10 users 1500 9000\n"
+
+	// The failing records are reported and kept
+	failures := []*ValidationError{}
+	parser, err := NewTextFSMParserFromString(tmpl, WithValidationHandler(func(e *ValidationError) error {
+		failures = append(failures, e)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	res, err := parser.ParseTextToDicts(text)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	if len(res) != 4 {
+		t.Errorf("Error in 'Test validations': expected 4 records, got %+v", res)
+	}
+
+	exp := []struct {
+		rule    string
+		kind    ValidationKind
+		line_no int
+		record  bool
+	}{
+		{rule: `match(name, "^[a-z]+$")`, kind: VALIDATE_EXPR, line_no: 2, record: true},
+		{rule: `min_mtu <= max_mtu`, kind: VALIDATE_EXPR, line_no: 3, record: true},
+		{rule: `Unique`, kind: VALIDATE_UNIQUE, line_no: 4, record: true},
+		{rule: `Records >= 5`, kind: VALIDATE_RECORDS, line_no: 4},
+	}
+	if len(failures) != len(exp) {
+		t.Fatalf("Error in 'Test validations': expected %d failures, got %+v", len(exp), failures)
+	}
+	for i, e := range exp {
+		got := failures[i]
+		if got.Rule != e.rule || got.Kind != e.kind || got.LineNo != e.line_no || (got.Record != nil) != e.record {
+			t.Errorf("Error in 'Test validations': expected failure %+v, got %+v", e, got)
+		}
+	}
+	if failures[2].Msg != "values [10] already found in record 1" || failures[2].RuleLine != 7 {
+		t.Errorf("Error in 'Test validations': unexpected failure %+v", failures[2])
+	}
+
+	// Without a handler the failures are returned along with all the records
+	parser, err = NewTextFSMParserFromString(tmpl)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	res, err = parser.ParseTextToDicts(text)
+	var val_errs ValidationErrors
+	if !errors.As(err, &val_errs) || len(val_errs) != len(exp) || len(res) != 4 {
+		t.Errorf("Error in 'Test validation failures': unexpected result %+v, error %+v", res, err)
+	} else {
+		for i, e := range exp {
+			if val_errs[i].Rule != e.rule || val_errs[i].LineNo != e.line_no {
+				t.Errorf("Error in 'Test validation failures': expected failure %+v, got %+v", e, val_errs[i])
+			}
+		}
+	}
+
+	// The strict validation stops the parsing at the first failure
+	parser, err = NewTextFSMParserFromString(tmpl, WithStrictValidation())
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	res, err = parser.ParseTextToDicts(text)
+	var val_err *ValidationError
+	if !errors.As(err, &val_err) || val_err.RuleLine != 5 || res != nil ||
+		!reflect.DeepEqual(val_err.Record, Record{"vlan": "20", "name": "Voice", "min_mtu": int64(1500), "max_mtu": int64(9000)}) {
+		t.Errorf("Error in 'Test strict validation': unexpected error %+v", err)
+	}
+}
+
+func TestValidationUniqueIdentity(t *testing.T) {
+	tmpl := `Value List tags (.+)
+Value id (\d+)
+Validate Unique tags
+
+Start
+  ^tag ${tags}
+  ^id ${id} -> Record
+`
+	parser, err := NewTextFSMParserFromString(tmpl, WithStrictValidation())
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	checkRecords(t, "Test unique lists with the same text", parser, "tag a b\nid 1\ntag a\ntag b\nid 2\n",
+		[]map[string]interface{}{
+			{"tags": []string{"a b"}, "id": "1"},
+			{"tags": []string{"a", "b"}, "id": "2"},
+		})
+}
+
+func TestSecretValidations(t *testing.T) {
+	tmpl := `Value Secret pw (\S+)
+Value user (\S+)
+Validate match(pw, "^[a-z0-9]+$")
+Validate Unique pw
+
+Start
+  ^${user} ${pw} -> Record
+`
+	text := "a hunter2\nb s3cr3t\nc hunter2\nd Bad!\n"
+
+	// The rules see the secret values in clear, the failing records are redacted
+	failures := []*ValidationError{}
+	parser, err := NewTextFSMParserFromString(tmpl, WithValidationHandler(func(e *ValidationError) error {
+		failures = append(failures, e)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	res, err := parser.ParseTextToDicts(text)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	for _, record := range res {
+		if record["pw"] != DEFAULT_REDACT_MASK {
+			t.Errorf("Error in 'Test secret validations': secret leaked in %+v", record)
+		}
+	}
+
+	exp := []struct {
+		rule string
+		user string
+	}{
+		{rule: "Unique pw", user: "c"},
+		{rule: `match(pw, "^[a-z0-9]+$")`, user: "d"},
+	}
+	if len(failures) != len(exp) {
+		t.Fatalf("Error in 'Test secret validations': expected %d failures, got %+v", len(exp), failures)
+	}
+	for i, e := range exp {
+		got := failures[i]
+		if got.Rule != e.rule || got.Record["user"] != e.user || got.Record["pw"] != DEFAULT_REDACT_MASK {
+			t.Errorf("Error in 'Test secret validations': expected failure %+v, got %+v", e, got)
+		}
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	var validationTestCases = []struct {
+		description string
+		template    string
+		exp_err     string
+	}{
+		{
+			description: "Test missing rule",
+			template:    "Value a (\\S+)\nValidate\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 1: the Validate rule should be followed by an expression, Unique or Records",
+		},
+		{
+			description: "Test invalid expression",
+			template:    "Value a (\\S+)\nValidate a >\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 13: invalid expression: unexpected end of expression",
+		},
+		{
+			description: "Test unknown value",
+			template:    "Value a (\\S+)\nValidate a != b\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 15: unknown value b in the validation",
+		},
+		{
+			description: "Test invalid match regex",
+			template:    "Value a (\\S+)\nValidate match(a, \"(\")\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 10: invalid expression: invalid regex",
+		},
+		{
+			description: "Test Unique without keys",
+			template:    "Value a (\\S+)\nValidate Unique\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 10: the Unique rule requires the names of the values, or some Key values",
+		},
+		{
+			description: "Test Unique with unknown value",
+			template:    "Value a (\\S+)\nValidate Unique a,b\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 19: unknown value b in the validation",
+		},
+		{
+			description: "Test invalid Records rule",
+			template:    "Value a (\\S+)\nValidate Records > a\n\nStart\n  ^${a}\n",
+			exp_err:     ".*line 2, column 10: the Records rule should be a comparison with a number",
+		},
+	}
+
+	for _, tc := range validationTestCases {
+		_, err := NewTextFSMParserFromString(tc.template)
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+}
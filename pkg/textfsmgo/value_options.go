@@ -0,0 +1,297 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ValueOption describes an option of the Value declarations, e.g. Filldown or Type=int.
+// The builtin options are implemented as ValueOptions too, and new ones can be added with
+// RegisterValueOption(). All the functions are optional.
+type ValueOption struct {
+	Name      string   // the name of the option, as written in the templates
+	TakesArg  bool     // tells if the option is written as Name=arg
+	Conflicts []string // the names of the options which cannot be used together with this one
+
+	// Parse is called when the option is found in a Value declaration, with its argument,
+	// to validate it and configure the value. The error is reported as a TemplateError.
+	Parse func(decl *ValueDecl, arg string) error
+	// Validate is called once all the options of the declaration have been parsed, to check
+	// that the value is configured as the option expects
+	Validate func(decl *ValueDecl) error
+	// Aggregate makes the option combine the matches of the value in a record: it is called
+	// with the content of the value in the record and the new match, converted to the type
+	// of the value, and it returns the new content. A value can have a single aggregating
+	// option, and the empty matches are not passed to it.
+	Aggregate func(ctx *OptionContext, current interface{}, val interface{}) (interface{}, error)
+	// OnRecordCreate is called when a new record is created, after all the values have been
+	// initialized as empty. It can set the initial content of the value.
+	OnRecordCreate func(ctx *OptionContext, record Record)
+	// OnSet is called after the value has been set in the record, with the text matched by
+	// the value, once transformed
+	OnSet func(ctx *OptionContext, record Record, text string) error
+	// OnAppend is called before a record is collected, returning false the record is
+	// dropped and the OnAppend hooks left are not called. It is not called for the values
+	// of the child records, which are no longer in the record.
+	OnAppend func(ctx *OptionContext, record Record) (bool, error)
+}
+
+// hasHooks() tells if the option has to be called while parsing the text
+func (o *ValueOption) hasHooks() bool {
+	return o.OnRecordCreate != nil || o.OnSet != nil || o.OnAppend != nil || o.Aggregate != nil
+}
+
+// ValueDecl is a Value declaration being parsed, passed to the Parse function of its options
+type ValueDecl struct {
+	Name  string        // the name of the value
+	Regex string        // the regex of the value, as written in the template
+	value *TextFSMValue // the value being configured by the options
+	tmpl  *Template     // the template declaring the value
+}
+
+// Type() returns the type of the value, set by the Type option
+func (d *ValueDecl) Type() ValueType {
+	return d.value.vtype
+}
+
+// OptionContext is passed to the hooks of an option, it identifies the value the option is
+// attached to and gives access to the parsing session
+type OptionContext struct {
+	Value   string                 // the name of the value the option is attached to
+	Arg     string                 // the argument of the option, empty if none
+	option  *ValueOption           // the option owning the hooks
+	session *Session               // the session parsing the text
+	store   map[string]interface{} // the data kept by the hooks during the parsing
+}
+
+// LineNo() returns the number of the line of the text being parsed, starting from 1
+func (c *OptionContext) LineNo() int {
+	return c.session.line_no
+}
+
+// Semantics() returns the runtime semantics of the template
+func (c *OptionContext) Semantics() Semantics {
+	return c.session.tmpl.semantics
+}
+
+// Store() returns a map where the hooks can keep their data while a text is parsed. Each
+// value has its own map, which is emptied when the session is reset.
+func (c *OptionContext) Store() map[string]interface{} {
+	if c.store == nil {
+		c.store = map[string]interface{}{}
+	}
+	return c.store
+}
+
+// optionHook is an option with hooks attached to a value of the template
+type optionHook struct {
+	option *ValueOption // the option
+	order  int          // the position of the option in the registry
+	value  string       // the name of the value
+	arg    string       // the argument of the option, empty if none
+}
+
+// The options available in the templates, in registration order: the hooks of the
+// options registered first are called first
+var value_options = append([]*ValueOption{
+	{
+		Name: "Required",
+		Parse: func(decl *ValueDecl, arg string) error {
+			decl.value.required = true
+			return nil
+		},
+		OnAppend: func(ctx *OptionContext, record Record) (bool, error) {
+			return !ctx.session.isEmpty(record[ctx.Value]), nil
+		},
+	},
+	{
+		Name:      "Filldown",
+		Conflicts: []string{"Fillup"},
+		Parse: func(decl *ValueDecl, arg string) error {
+			decl.value.fill = FILL_DOWN_OP
+			return nil
+		},
+		OnRecordCreate: func(ctx *OptionContext, record Record) {
+			s := ctx.session
+			if s.tmpl.semantics == SEMANTICS_PYTHON {
+				if val, present := s.filldown[ctx.Value]; present {
+					record[ctx.Value] = cloneValue(val)
+				}
+			} else if last := s.tables[s.tmpl.values[ctx.Value].table].last_record; last != nil {
+				record[ctx.Value] = cloneValue(last[ctx.Value])
+			}
+		},
+		OnSet: func(ctx *OptionContext, record Record, text string) error {
+			// Remember the value, it will be carried by the next records
+			if ctx.session.tmpl.semantics == SEMANTICS_PYTHON {
+				ctx.session.filldown[ctx.Value] = record[ctx.Value]
+			}
+			return nil
+		},
+	},
+	{
+		Name:      "Fillup",
+		Conflicts: []string{"Filldown"},
+		Parse: func(decl *ValueDecl, arg string) error {
+			decl.value.fill = FILL_UP_OP
+			return nil
+		},
+		OnSet: func(ctx *OptionContext, record Record, text string) error {
+			// Python fills up the collected records as soon as the value is assigned, the
+			// aggregated values are final only when the record is collected
+			s := ctx.session
+			if s.tmpl.semantics == SEMANTICS_PYTHON && s.tmpl.values[ctx.Value].aggregate == nil &&
+				text != "" && s.fillUp(ctx.Value, record[ctx.Value]) {
+				return s.emitSettledRecords(s.tmpl.values[ctx.Value].table)
+			}
+			return nil
+		},
+		OnAppend: func(ctx *OptionContext, record Record) (bool, error) {
+			s := ctx.session
+			if (s.tmpl.semantics == SEMANTICS_LEGACY || s.tmpl.values[ctx.Value].aggregate != nil) &&
+				!s.isEmpty(record[ctx.Value]) {
+				s.fillUp(ctx.Value, record[ctx.Value])
+			}
+			return true, nil
+		},
+	},
+	{
+		Name: COMPUTED_OPTION,
+		Conflicts: []string{"Filldown", "Fillup", "List", TYPE_OPTION, TRANSFORM_OPTION,
+			COUNT_OPTION, SUM_OPTION, MIN_OPTION, MAX_OPTION, FIRST_OPTION, LAST_OPTION, SET_OPTION},
+	},
+	{
+		Name: SECRET_OPTION,
+		Parse: func(decl *ValueDecl, arg string) error {
+			decl.value.secret = true
+			return nil
+		},
+	},
+	{
+		Name:      CHILD_OPTION,
+		TakesArg:  true,
+		Conflicts: []string{"Filldown", "Fillup", "Key", COMPUTED_OPTION},
+		Parse: func(decl *ValueDecl, arg string) error {
+			if !VALUE_NAME_VALID_REGEX.MatchString(arg) {
+				return fmt.Errorf("invalid child record set name %s", arg)
+			}
+			decl.value.child = arg
+			return nil
+		},
+	},
+	{
+		Name:      TABLE_OPTION,
+		TakesArg:  true,
+		Conflicts: []string{CHILD_OPTION},
+		Parse: func(decl *ValueDecl, arg string) error {
+			if !VALUE_NAME_VALID_REGEX.MatchString(arg) {
+				return fmt.Errorf("invalid table name %s", arg)
+			}
+			// The default table can be named explicitly too
+			if arg != DEFAULT_TABLE {
+				decl.value.table = arg
+			}
+			return nil
+		},
+	},
+	{
+		Name: "Key",
+		Parse: func(decl *ValueDecl, arg string) error {
+			decl.value.key = true
+			return nil
+		},
+	},
+	{
+		Name: "List",
+		Parse: func(decl *ValueDecl, arg string) error {
+			decl.value.rtype = LIST_RECORD
+			return nil
+		},
+	},
+	{
+		Name:     TYPE_OPTION,
+		TakesArg: true,
+		Parse: func(decl *ValueDecl, arg string) error {
+			vtype, known := VALUE_TYPES[arg]
+			if !known {
+				return fmt.Errorf("unknown type %s", arg)
+			}
+			decl.value.vtype = vtype
+			return nil
+		},
+	},
+	{
+		Name:     TRANSFORM_OPTION,
+		TakesArg: true,
+		Parse: func(decl *ValueDecl, arg string) error {
+			transforms, err := decl.tmpl.parseTransforms(arg)
+			decl.value.transforms = transforms
+			return err
+		},
+	},
+}, aggregate_options...)
+
+// Protects value_options, as the options can be registered while templates are parsed
+var value_options_lock sync.RWMutex
+
+// RegisterValueOption(ValueOption) makes a new option available in the Value declarations
+// of the templates parsed afterwards. The name cannot be the one of an option already
+// registered, the builtin ones included.
+func RegisterValueOption(option ValueOption) error {
+	if !VALUE_NAME_VALID_REGEX.MatchString(option.Name) {
+		return fmt.Errorf("invalid value option name '%s'", option.Name)
+	}
+
+	value_options_lock.Lock()
+	defer value_options_lock.Unlock()
+	for _, registered := range value_options {
+		if registered.Name == option.Name {
+			return fmt.Errorf("value option %s already registered", option.Name)
+		}
+	}
+	value_options = append(value_options, &option)
+	return nil
+}
+
+// lookupValueOption(string) returns the registered option with the given name and its
+// position in the registry, nil if there is no such option
+func lookupValueOption(name string) (*ValueOption, int) {
+	value_options_lock.RLock()
+	defer value_options_lock.RUnlock()
+	for i, option := range value_options {
+		if option.Name == name {
+			return option, i
+		}
+	}
+	return nil, -1
+}
+
+// sortHooks() sorts the hooks of the template in registration order of their options,
+// keeping the declaration order of the values for the same option
+func (t *Template) sortHooks() {
+	sort.SliceStable(t.hooks, func(i, j int) bool {
+		return t.hooks[i].order < t.hooks[j].order
+	})
+}
+
+// optionContext(string, *ValueOption) returns the context of the hooks of the given
+// option attached to the given value, nil if there is none
+func (s *Session) optionContext(value string, option *ValueOption) *OptionContext {
+	for i := range s.option_ctxs {
+		if ctx := &s.option_ctxs[i]; ctx.Value == value && ctx.option == option {
+			return ctx
+		}
+	}
+	return nil
+}
+
+// newOptionContexts() creates the contexts passed to the hooks of the template, in the
+// same order as the hooks
+func (s *Session) newOptionContexts() []OptionContext {
+	ctxs := make([]OptionContext, len(s.tmpl.hooks))
+	for i, hook := range s.tmpl.hooks {
+		ctxs[i] = OptionContext{Value: hook.value, Arg: hook.arg, option: hook.option, session: s}
+	}
+	return ctxs
+}
@@ -0,0 +1,126 @@
+package textfsmgo
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// The options are registered once, as the registry is shared by the whole package
+var registerTestOptions sync.Once
+
+func registerTestValueOptions(t *testing.T) {
+	registerTestOptions.Do(func() {
+		// Unique drops the records repeating a value already collected
+		unique := ValueOption{
+			Name: "Unique",
+			OnAppend: func(ctx *OptionContext, record Record) (bool, error) {
+				val := fmt.Sprint(record[ctx.Value])
+				if ctx.Store()[val] != nil {
+					return false, nil
+				}
+				ctx.Store()[val] = ctx.LineNo()
+				return true, nil
+			},
+		}
+		// Initial sets the value of the new records to its argument
+		initial := ValueOption{
+			Name:      "Initial",
+			TakesArg:  true,
+			Conflicts: []string{"Filldown", "List"},
+			Parse: func(decl *ValueDecl, arg string) error {
+				if arg == "" {
+					return fmt.Errorf("empty initial text for value %s", decl.Name)
+				}
+				return nil
+			},
+			OnRecordCreate: func(ctx *OptionContext, record Record) {
+				record[ctx.Value] = ctx.Arg
+			},
+		}
+		for _, option := range []ValueOption{unique, initial} {
+			if err := RegisterValueOption(option); err != nil {
+				t.Fatalf("Unexpected error '%s'", err)
+			}
+		}
+	})
+}
+
+func TestCustomValueOptions(t *testing.T) {
+	registerTestValueOptions(t)
+
+	tmpl := `Value Required,Unique name (\S+)
+Value Initial=down status (\S+)
+
+Start
+  ^name ${name} ${status} -> Record
+  ^name ${name} -> Record
+`
+	text := "name a up\nname b\nname a\nname c up\nname b\n"
+	for _, semantics := range []Semantics{SEMANTICS_PYTHON, SEMANTICS_LEGACY} {
+		parser, err := NewTextFSMParserFromString(tmpl, WithSemantics(semantics))
+		if err != nil {
+			t.Fatalf("Unexpected error '%s'", err)
+		}
+		// The sessions are reused, so the stores must be reset each time
+		for i := 0; i < 2; i++ {
+			checkRecords(t, "Test custom value options", parser, text, []map[string]interface{}{
+				{"name": "a", "status": "up"},
+				{"name": "b", "status": "down"},
+				{"name": "c", "status": "up"},
+			})
+		}
+	}
+}
+
+func TestValueOptionErrors(t *testing.T) {
+	registerTestValueOptions(t)
+
+	var optionTestCases = []struct {
+		description string
+		line        string
+		exp_err     string
+	}{
+		{
+			description: "Test option parse error",
+			line:        "Value Initial= myval (.*)",
+			exp_err:     ".*column 7: empty initial text for value myval",
+		},
+		{
+			description: "Test declared conflict",
+			line:        "Value Initial=x,Filldown myval (.*)",
+			exp_err:     ".*column 17: conflicting option Filldown",
+		},
+		{
+			description: "Test conflict declared by the other option",
+			line:        "Value List,Initial=x myval (.*)",
+			exp_err:     ".*column 12: conflicting option Initial=x",
+		},
+		{
+			description: "Test missing argument",
+			line:        "Value Initial myval (.*)",
+			exp_err:     ".*option Initial requires an argument.*",
+		},
+		{
+			description: "Test unexpected argument",
+			line:        "Value Unique=yes myval (.*)",
+			exp_err:     ".*option Unique takes no argument",
+		},
+	}
+
+	for _, tc := range optionTestCases {
+		_, err := NewTextFSMParserFromString(tc.line + "\n\nStart\n  ^${myval}\n")
+		if err == nil {
+			t.Errorf("Error in '%s': expected error '%s', no errors got", tc.description, tc.exp_err)
+		} else if !regexp.MustCompile(tc.exp_err).MatchString(err.Error()) {
+			t.Errorf("Error in '%s': '%s' error does not match pattern '%s'", tc.description, err, tc.exp_err)
+		}
+	}
+
+	for _, option := range []ValueOption{{Name: "Filldown"}, {Name: "Unique"}, {Name: "Bad=Name"}, {}} {
+		if err := RegisterValueOption(option); err == nil {
+			t.Errorf("Error in 'Test registration of %s': expected error, no errors got", option.Name)
+		}
+	}
+}
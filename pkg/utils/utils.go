@@ -2,13 +2,23 @@ package utils
 
 import (
 	"encoding/json"
+	"net"
 	"regexp"
+	"strings"
+	"time"
 )
 
 // GetRegexpNamedGroups(*regexp.Regexp, []string) given a regular expression and the resulting submatch
 // of the FindStringSubmatch() function, it returns a map with for each named group the
 // corresponding match
 func GetRegexpNamedGroups(reg *regexp.Regexp, submatch []string) map[string]string {
+	return GetNamedGroups(reg.SubexpNames(), submatch)
+}
+
+// GetNamedGroups([]string, []string) given the names of the groups of a regular expression
+// and the resulting submatch, it returns a map with for each named group the corresponding
+// match. It is the engine-agnostic version of GetRegexpNamedGroups()
+func GetNamedGroups(names []string, submatch []string) map[string]string {
 	// Return nil in case of no submatch
 	if submatch == nil {
 		return nil
@@ -16,7 +26,7 @@ func GetRegexpNamedGroups(reg *regexp.Regexp, submatch []string) map[string]stri
 
 	// Stores the named matches in a dictionary
 	matches := map[string]string{}
-	for i, gname := range reg.SubexpNames() {
+	for i, gname := range names {
 		if i != 0 && gname != "" {
 			matches[gname] = submatch[i]
 		}
@@ -29,15 +39,136 @@ func GetRegexpNamedGroups(reg *regexp.Regexp, submatch []string) map[string]stri
 	return matches
 }
 
+// StripRegexpGroupNames(string) given a regular expression returns the same expression
+// where all the named groups have been turned into unnamed capturing groups. Escaped
+// brackets and brackets inside character classes are left untouched, a ] right after the
+// opening [ or [^ of a class is part of the class.
+func StripRegexpGroupNames(regex string) string {
+	var res strings.Builder
+	in_class := false
+	for i := 0; i < len(regex); i++ {
+		c := regex[i]
+		switch {
+		case c == '\\' && i+1 < len(regex):
+			// Copy the escaped char as is
+			res.WriteByte(c)
+			i++
+			c = regex[i]
+		case c == '[' && !in_class:
+			in_class = true
+			// Copy the negation and a leading ], which do not close the class
+			res.WriteByte(c)
+			if i+1 < len(regex) && regex[i+1] == '^' {
+				i++
+				res.WriteByte(regex[i])
+			}
+			if i+1 < len(regex) && regex[i+1] == ']' {
+				i++
+				res.WriteByte(regex[i])
+			}
+			continue
+		case c == ']':
+			in_class = false
+		case c == '(' && !in_class && strings.HasPrefix(regex[i:], "(?P<"):
+			if end := strings.IndexByte(regex[i:], '>'); end != -1 {
+				res.WriteByte('(')
+				i += end
+				continue
+			}
+		}
+		res.WriteByte(c)
+	}
+	return res.String()
+}
+
+// jsonValue(interface{}) returns the value to encode in json in place of the given one:
+// MAC addresses and durations are encoded with their string representation, instead of
+// base64 and nanoseconds, also in the lists and in the child records. The boolean tells
+// if the value has been replaced.
+func jsonValue(val interface{}) (interface{}, bool) {
+	switch val := val.(type) {
+	case net.HardwareAddr:
+		return val.String(), true
+	case time.Duration:
+		return val.String(), true
+	case []interface{}:
+		var items []interface{}
+		for i, item := range val {
+			if json_item, replaced := jsonValue(item); replaced {
+				if items == nil {
+					items = append([]interface{}{}, val...)
+				}
+				items[i] = json_item
+			}
+		}
+		if items != nil {
+			return items, true
+		}
+	case []map[string]interface{}:
+		if records, replaced := jsonRecords(val); replaced {
+			return records, true
+		}
+	}
+	return val, false
+}
+
+// jsonRecords([]map[string]interface{}) returns the records to encode in json in place of
+// the given ones. Only the records having values to be replaced are copied, the others are
+// encoded as they are. The boolean tells if any record has been replaced.
+func jsonRecords(records []map[string]interface{}) ([]map[string]interface{}, bool) {
+	res := records
+	res_copied := false
+	for i, record := range records {
+		record_copied := false
+		for k, val := range record {
+			json_val, replaced := jsonValue(val)
+			if !replaced {
+				continue
+			}
+
+			if !res_copied {
+				res = append([]map[string]interface{}{}, records...)
+				res_copied = true
+			}
+			if !record_copied {
+				res[i] = make(map[string]interface{}, len(record))
+				for rk, rval := range record {
+					res[i][rk] = rval
+				}
+				record_copied = true
+			}
+			res[i][k] = json_val
+		}
+	}
+	return res, res_copied
+}
+
 // ConvertResToJson(*[]map[string]interface{}, bool) given the result of the textfsm parsed data
 // returns the json output. When indent is true, the output will be indented
 func ConvertResToJson(map_res *[]map[string]interface{}, indent bool) ([]byte, error) {
+	res, _ := jsonRecords(*map_res)
+	return marshalJson(res, indent)
+}
+
+// ConvertTablesToJson(map[string][]map[string]interface{}, bool) given the tables parsed by
+// textfsm returns the json output, an object with the records of each table. When indent is
+// true, the output will be indented
+func ConvertTablesToJson(tables map[string][]map[string]interface{}, indent bool) ([]byte, error) {
+	res := make(map[string][]map[string]interface{}, len(tables))
+	for name, records := range tables {
+		res[name], _ = jsonRecords(records)
+	}
+	return marshalJson(res, indent)
+}
+
+// marshalJson(interface{}, bool) encodes the value in json, indented when indent is true
+func marshalJson(res interface{}, indent bool) ([]byte, error) {
 	var byteRes []byte
 	var err error
 	if indent {
-		byteRes, err = json.MarshalIndent(*map_res, "", "  ")
+		byteRes, err = json.MarshalIndent(res, "", "  ")
 	} else {
-		byteRes, err = json.Marshal(*map_res)
+		byteRes, err = json.Marshal(res)
 	}
 
 	if err != nil {
@@ -1,9 +1,11 @@
 package utils_test
 
 import (
+	"net"
 	"reflect"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/claudiolor/textfsmgo/pkg/utils"
 )
@@ -57,3 +59,91 @@ func TestGetRegexpNamedGroups(t *testing.T) {
 		}
 	}
 }
+
+var stripTestCases = []struct {
+	description string
+	regex       string
+	exp_regex   string
+}{
+	{
+		description: "Regex without groups",
+		regex:       `\S+\s+\d+`,
+		exp_regex:   `\S+\s+\d+`,
+	},
+	{
+		description: "Regex with named and unnamed groups",
+		regex:       `((?P<ip>\S+)\s+(?P<as>\d+)(?:\s+)(\w+))`,
+		exp_regex:   `((\S+)\s+(\d+)(?:\s+)(\w+))`,
+	},
+	{
+		description: "Escaped brackets and brackets in character classes",
+		regex:       `\(?P<a>x\)[(?P<b>]+(?P<c>y)`,
+		exp_regex:   `\(?P<a>x\)[(?P<b>]+(y)`,
+	},
+	{
+		description: "Character class starting with ]",
+		regex:       `[](?P<a>]+(?P<b>y)`,
+		exp_regex:   `[](?P<a>]+(y)`,
+	},
+	{
+		description: "Negated character class starting with ]",
+		regex:       `[^](?P<a>]+(?P<b>y)`,
+		exp_regex:   `[^](?P<a>]+(y)`,
+	},
+}
+
+func TestStripRegexpGroupNames(t *testing.T) {
+	for _, tc := range stripTestCases {
+		t.Log(tc.description)
+		if res := utils.StripRegexpGroupNames(tc.regex); res != tc.exp_regex {
+			t.Errorf("Error in '%s': expected %s got %s",
+				tc.description, tc.exp_regex, res)
+		}
+	}
+}
+
+func TestConvertResToJson(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	res := []map[string]interface{}{
+		{"name": "eth0", "mtu": int64(1500)},
+		{"mac": mac, "uptime": 90 * time.Minute, "macs": []interface{}{mac}},
+		{"name": "br0", "ports": []map[string]interface{}{{"mac": mac}}},
+	}
+
+	json_res, err := utils.ConvertResToJson(&res, false)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	exp := `[{"mtu":1500,"name":"eth0"},` +
+		`{"mac":"00:11:22:33:44:55","macs":["00:11:22:33:44:55"],"uptime":"1h30m0s"},` +
+		`{"name":"br0","ports":[{"mac":"00:11:22:33:44:55"}]}]`
+	if string(json_res) != exp {
+		t.Errorf("Error in 'Test typed values': expected %s got %s", exp, json_res)
+	}
+
+	// The result is not modified
+	if _, is_mac := res[2]["ports"].([]map[string]interface{})[0]["mac"].(net.HardwareAddr); !is_mac {
+		t.Errorf("Error in 'Test typed values': the result has been modified: %+v", res)
+	}
+	if _, is_mac := res[1]["mac"].(net.HardwareAddr); !is_mac {
+		t.Errorf("Error in 'Test typed values': the result has been modified: %+v", res)
+	}
+}
+
+func TestConvertTablesToJson(t *testing.T) {
+	tables := map[string][]map[string]interface{}{
+		"default": {{"port": "Gi0/1"}},
+		"summary": {{"uptime": 90 * time.Minute}},
+	}
+
+	json_res, err := utils.ConvertTablesToJson(tables, false)
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+
+	exp := `{"default":[{"port":"Gi0/1"}],"summary":[{"uptime":"1h30m0s"}]}`
+	if string(json_res) != exp {
+		t.Errorf("Error in 'Test tables': expected %s got %s", exp, json_res)
+	}
+}